@@ -0,0 +1,115 @@
+// Package authz maps roles to named permissions. Handlers and services ask
+// for a permission instead of checking roles, so new roles only need a
+// policy entry.
+package authz
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"petmatch/internal/models"
+)
+
+type Permission string
+
+const (
+	PetsWrite        Permission = "pets:write"
+	AdoptionsCreate  Permission = "adoptions:create"
+	AdoptionsReadOwn Permission = "adoptions:read_own"
+	AdoptionsReview  Permission = "adoptions:review"
+	AdoptionsDecide  Permission = "adoptions:decide"
+	UsersRead        Permission = "users:read"
+	UsersApprove     Permission = "users:approve"
+	UsersManageRoles Permission = "users:manage_roles"
+	UsersSuspend     Permission = "users:suspend"
+	UsersImpersonate Permission = "users:impersonate"
+	SecurityManage   Permission = "security:manage"
+	AuditRead        Permission = "audit:read"
+)
+
+// Policy lists the permissions granted to each role.
+type Policy map[models.UserRole][]Permission
+
+// DefaultPolicy reproduces the behaviour of the built-in roles.
+func DefaultPolicy() Policy {
+	return Policy{
+		models.RoleAdopter: {AdoptionsCreate, AdoptionsReadOwn},
+		models.RoleShelter: {PetsWrite, AdoptionsReview, AdoptionsDecide},
+		models.RoleAdmin:   {UsersRead, UsersApprove, UsersManageRoles, UsersSuspend, UsersImpersonate, SecurityManage, AuditRead},
+	}
+}
+
+// LoadPolicy returns the default policy, overridden by the roles defined in
+// the JSON file at path (if any). The file maps role names to permission
+// lists, e.g. {"moderator": ["users:read", "users:approve"]}. A role present
+// in the file replaces its default permissions.
+func LoadPolicy(path string) (Policy, error) {
+	policy := DefaultPolicy()
+	if path == "" {
+		return policy, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read permissions file: %w", err)
+	}
+
+	var overrides map[models.UserRole][]Permission
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("parse permissions file: %w", err)
+	}
+	for role, permissions := range overrides {
+		policy[role] = permissions
+	}
+	return policy, nil
+}
+
+type Authorizer struct {
+	grants map[models.UserRole]map[Permission]bool
+}
+
+func NewAuthorizer(policy Policy) *Authorizer {
+	grants := make(map[models.UserRole]map[Permission]bool, len(policy))
+	for role, permissions := range policy {
+		set := make(map[Permission]bool, len(permissions))
+		for _, permission := range permissions {
+			set[permission] = true
+		}
+		grants[role] = set
+	}
+	return &Authorizer{grants: grants}
+}
+
+func (a *Authorizer) Can(user *models.User, permission Permission) bool {
+	if user == nil {
+		return false
+	}
+	return a.grants[user.Role][permission]
+}
+
+// CanAny reports whether the user holds at least one of the permissions.
+func (a *Authorizer) CanAny(user *models.User, permissions ...Permission) bool {
+	for _, permission := range permissions {
+		if a.Can(user, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRole reports whether the role is defined by the policy.
+func (a *Authorizer) HasRole(role models.UserRole) bool {
+	_, ok := a.grants[role]
+	return ok
+}
+
+func (a *Authorizer) Permissions(role models.UserRole) []Permission {
+	permissions := make([]Permission, 0, len(a.grants[role]))
+	for permission := range a.grants[role] {
+		permissions = append(permissions, permission)
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i] < permissions[j] })
+	return permissions
+}
@@ -1,28 +1,180 @@
 package config
 
-import "os"
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type Config struct {
-	DBPath        string
-	HTTPPort      string
-	JWTSecret     string
-	AdminEmail    string
-	AdminPassword string
+	DBPath                          string
+	HTTPPort                        string
+	JWTSecret                       string
+	JWTAlgorithm                    string
+	JWTIssuer                       string
+	JWTKeyRotation                  time.Duration
+	SigningKeySecret                string
+	DevMode                         bool
+	AdminEmail                      string
+	AdminPassword                   string
+	AccessTokenTTL                  time.Duration
+	RefreshTokenTTL                 time.Duration
+	AppURL                          string
+	PasswordResetTTL                time.Duration
+	EmailVerificationTTL            time.Duration
+	ShelterInvitationTTL            time.Duration
+	ImpersonationTTL                time.Duration
+	RequireVerifiedEmailForLogin    bool
+	RequireVerifiedEmailForAdoption bool
+	MaxOpenAdoptionRequests         int
+	VisitReminderLead               time.Duration
+	VisitReminderInterval           time.Duration
+	TwoFactorIssuer                 string
+	TwoFactorRequiredRoles          []string
+	LoginMaxAttempts                int
+	LoginIPMaxAttempts              int
+	LoginAttemptWindow              time.Duration
+	LoginLockoutDuration            time.Duration
+	TrustedProxies                  []string
+	PermissionsFile                 string
+	MailDriver                      string
+	MailFrom                        string
+	MailFilePath                    string
+	SMTPHost                        string
+	SMTPPort                        string
+	SMTPUsername                    string
+	SMTPPassword                    string
+	PublicURL                       string
+	StorageDriver                   string
+	StorageDir                      string
+	MaxPhotoSize                    int
+	MaxVideoSize                    int
+	MediaProcessInterval            time.Duration
+	S3Endpoint                      string
+	S3Region                        string
+	S3Bucket                        string
+	S3AccessKey                     string
+	S3SecretKey                     string
+	S3PathStyle                     bool
 }
 
+const (
+	defaultJWTSecret        = "change-me"
+	defaultSigningKeySecret = "change-me"
+)
+
+var (
+	ErrDefaultJWTSecret        = errors.New("PETMATCH_JWT_SECRET is still the default value; set a real secret or PETMATCH_DEV_MODE=true")
+	ErrDefaultSigningKeySecret = errors.New("PETMATCH_SIGNING_KEY_SECRET is still the default value; set a real secret or PETMATCH_DEV_MODE=true")
+)
+
 func Load() Config {
 	return Config{
-		DBPath:        getEnv("PETMATCH_DB_PATH", "petmatch.db"),
-		HTTPPort:      getEnv("PETMATCH_HTTP_PORT", "8084"),
-		JWTSecret:     getEnv("PETMATCH_JWT_SECRET", "change-me"),
-		AdminEmail:    getEnv("PETMATCH_ADMIN_EMAIL", "admin@petmatch.local"),
-		AdminPassword: getEnv("PETMATCH_ADMIN_PASSWORD", "admin123"),
+		DBPath:                          getEnv("PETMATCH_DB_PATH", "petmatch.db"),
+		HTTPPort:                        getEnv("PETMATCH_HTTP_PORT", "8084"),
+		JWTSecret:                       getEnv("PETMATCH_JWT_SECRET", defaultJWTSecret),
+		JWTAlgorithm:                    getEnv("PETMATCH_JWT_ALG", "EdDSA"),
+		JWTIssuer:                       getEnv("PETMATCH_JWT_ISSUER", "petmatch"),
+		JWTKeyRotation:                  getDuration("PETMATCH_JWT_KEY_ROTATION", 30*24*time.Hour),
+		SigningKeySecret:                getEnv("PETMATCH_SIGNING_KEY_SECRET", defaultSigningKeySecret),
+		DevMode:                         getBool("PETMATCH_DEV_MODE", false),
+		AdminEmail:                      getEnv("PETMATCH_ADMIN_EMAIL", "admin@petmatch.local"),
+		AdminPassword:                   getEnv("PETMATCH_ADMIN_PASSWORD", "admin123"),
+		AccessTokenTTL:                  getDuration("PETMATCH_ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:                 getDuration("PETMATCH_REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		AppURL:                          getEnv("PETMATCH_APP_URL", "http://localhost:4200"),
+		PasswordResetTTL:                getDuration("PETMATCH_PASSWORD_RESET_TTL", time.Hour),
+		EmailVerificationTTL:            getDuration("PETMATCH_EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		ShelterInvitationTTL:            getDuration("PETMATCH_SHELTER_INVITATION_TTL", 7*24*time.Hour),
+		ImpersonationTTL:                getDuration("PETMATCH_IMPERSONATION_TTL", 15*time.Minute),
+		RequireVerifiedEmailForLogin:    getBool("PETMATCH_REQUIRE_VERIFIED_EMAIL_LOGIN", false),
+		RequireVerifiedEmailForAdoption: getBool("PETMATCH_REQUIRE_VERIFIED_EMAIL_ADOPTION", false),
+		MaxOpenAdoptionRequests:         getInt("PETMATCH_MAX_OPEN_ADOPTION_REQUESTS", 5),
+		VisitReminderLead:               getDuration("PETMATCH_VISIT_REMINDER_LEAD", 24*time.Hour),
+		VisitReminderInterval:           getDuration("PETMATCH_VISIT_REMINDER_INTERVAL", 5*time.Minute),
+		TwoFactorIssuer:                 getEnv("PETMATCH_2FA_ISSUER", "PetMatch"),
+		TwoFactorRequiredRoles:          getList("PETMATCH_2FA_REQUIRED_ROLES"),
+		LoginMaxAttempts:                getInt("PETMATCH_LOGIN_MAX_ATTEMPTS", 5),
+		LoginIPMaxAttempts:              getInt("PETMATCH_LOGIN_IP_MAX_ATTEMPTS", 20),
+		LoginAttemptWindow:              getDuration("PETMATCH_LOGIN_ATTEMPT_WINDOW", 15*time.Minute),
+		LoginLockoutDuration:            getDuration("PETMATCH_LOGIN_LOCKOUT", 15*time.Minute),
+		TrustedProxies:                  getList("PETMATCH_TRUSTED_PROXIES"),
+		PermissionsFile:                 getEnv("PETMATCH_PERMISSIONS_FILE", ""),
+		MailDriver:                      getEnv("PETMATCH_MAIL_DRIVER", "log"),
+		MailFrom:                        getEnv("PETMATCH_MAIL_FROM", "PetMatch <no-reply@petmatch.local>"),
+		MailFilePath:                    getEnv("PETMATCH_MAIL_FILE", "mail.log"),
+		SMTPHost:                        getEnv("PETMATCH_SMTP_HOST", "localhost"),
+		SMTPPort:                        getEnv("PETMATCH_SMTP_PORT", "587"),
+		SMTPUsername:                    getEnv("PETMATCH_SMTP_USERNAME", ""),
+		SMTPPassword:                    getEnv("PETMATCH_SMTP_PASSWORD", ""),
+		PublicURL:                       getEnv("PETMATCH_PUBLIC_URL", "http://localhost:8084"),
+		StorageDriver:                   getEnv("PETMATCH_STORAGE_DRIVER", "local"),
+		StorageDir:                      getEnv("PETMATCH_STORAGE_DIR", "uploads"),
+		MaxPhotoSize:                    getInt("PETMATCH_MAX_PHOTO_SIZE", 5<<20),
+		MaxVideoSize:                    getInt("PETMATCH_MAX_VIDEO_SIZE", 50<<20),
+		MediaProcessInterval:            getDuration("PETMATCH_MEDIA_PROCESS_INTERVAL", 30*time.Second),
+		S3Endpoint:                      getEnv("PETMATCH_S3_ENDPOINT", ""),
+		S3Region:                        getEnv("PETMATCH_S3_REGION", "us-east-1"),
+		S3Bucket:                        getEnv("PETMATCH_S3_BUCKET", ""),
+		S3AccessKey:                     getEnv("PETMATCH_S3_ACCESS_KEY", ""),
+		S3SecretKey:                     getEnv("PETMATCH_S3_SECRET_KEY", ""),
+		S3PathStyle:                     getBool("PETMATCH_S3_PATH_STYLE", false),
 	}
 }
 
+// Validate rejects configurations that are only acceptable on a developer
+// machine.
+func (c Config) Validate() error {
+	if c.JWTAlgorithm == "HS256" && c.JWTSecret == defaultJWTSecret && !c.DevMode {
+		return ErrDefaultJWTSecret
+	}
+	// The stored RS256/EdDSA keys are encrypted with this secret.
+	if c.JWTAlgorithm != "HS256" && c.SigningKeySecret == defaultSigningKeySecret && !c.DevMode {
+		return ErrDefaultSigningKeySecret
+	}
+	return nil
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok && value != "" {
 		return value
 	}
 	return fallback
 }
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func getBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// getList reads a comma separated value, dropping blank entries.
+func getList(key string) []string {
+	var values []string
+	for _, item := range strings.Split(getEnv(key, ""), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			values = append(values, item)
+		}
+	}
+	return values
+}
@@ -9,13 +9,56 @@ import (
 )
 
 func Open(cfg config.Config) (*gorm.DB, error) {
-	return gorm.Open(sqlite.Open(cfg.DBPath), &gorm.Config{})
+	// TranslateError turns constraint violations into gorm.ErrDuplicatedKey
+	// and friends, so repositories need not parse SQLite messages.
+	return gorm.Open(sqlite.Open(cfg.DBPath), &gorm.Config{TranslateError: true})
 }
 
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	search := FullTextSearch(db)
+	if !search {
+		if err := disablePetSearch(db); err != nil {
+			return err
+		}
+	}
+
+	if err := db.AutoMigrate(
 		&models.User{},
+		&models.Shelter{},
+		&models.ShelterMember{},
+		&models.ShelterInvitation{},
 		&models.Pet{},
+		&models.AdoptionForm{},
+		&models.AdoptionFormField{},
 		&models.AdoptionRequest{},
-	)
+		&models.AdoptionStatusChange{},
+		&models.AdoptionEvaluation{},
+		&models.AdoptionNote{},
+		&models.AdoptionMessage{},
+		&models.MessageAttachment{},
+		&models.ConversationRead{},
+		&models.VisitSlot{},
+		&models.VisitBooking{},
+		&models.PetMedia{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.UserToken{},
+		&models.TwoFactor{},
+		&models.RecoveryCode{},
+		&models.SigningKey{},
+		&models.APIKey{},
+		&models.Impersonation{},
+		&models.ImpersonatedRequest{},
+		&models.AuditEvent{},
+	); err != nil {
+		return err
+	}
+
+	if err := runDataMigrations(db); err != nil {
+		return err
+	}
+	if !search {
+		return nil
+	}
+	return migratePetSearch(db)
 }
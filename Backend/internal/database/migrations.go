@@ -0,0 +1,270 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"petmatch/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// schemaMigration records a data migration that already ran. AutoMigrate
+// only handles the schema; rewriting existing rows has to happen exactly
+// once.
+type schemaMigration struct {
+	ID        string `gorm:"primaryKey;size:80"`
+	AppliedAt time.Time
+}
+
+type dataMigration struct {
+	id  string
+	run func(tx *gorm.DB) error
+}
+
+var dataMigrations = []dataMigration{
+	{id: "0001_shelter_organizations", run: migrateShelterOrganizations},
+	{id: "0002_user_status", run: migrateUserStatus},
+	{id: "0003_adoption_workflow", run: migrateAdoptionWorkflow},
+	{id: "0004_adoption_history", run: migrateAdoptionHistory},
+	{id: "0005_email_verified", run: migrateEmailVerified},
+	{id: "0006_open_request_index", run: migrateOpenRequestIndex},
+	{id: "0007_booked_visit_index", run: migrateBookedVisitIndex},
+}
+
+func runDataMigrations(db *gorm.DB) error {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+
+	for _, migration := range dataMigrations {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var applied int64
+			if err := tx.Model(&schemaMigration{}).Where("id = ?", migration.id).Count(&applied).Error; err != nil {
+				return err
+			}
+			if applied > 0 {
+				return nil
+			}
+
+			if err := migration.run(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{ID: migration.id, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("data migration %s: %w", migration.id, err)
+		}
+	}
+	return nil
+}
+
+// migrateShelterOrganizations turns every shelter account (and any other
+// user that still owns pets) into the owner of a shelter organization, and
+// points their pets at it. Before organizations existed pets.shelter_id held
+// the user id.
+func migrateShelterOrganizations(tx *gorm.DB) error {
+	var users []models.User
+	if err := tx.
+		Where("role = ? OR id IN (?)", models.RoleShelter, tx.Model(&models.Pet{}).Select("shelter_id")).
+		Order("id asc").
+		Find(&users).Error; err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		name := user.Name
+		if user.ShelterName != nil && *user.ShelterName != "" {
+			name = *user.ShelterName
+		}
+
+		shelter := models.Shelter{
+			Name:       name,
+			Phone:      user.Phone,
+			City:       user.City,
+			IsApproved: user.IsApproved,
+			CreatedAt:  user.CreatedAt,
+		}
+		if err := tx.Create(&shelter).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.ShelterMember{
+			ShelterID: shelter.ID,
+			UserID:    user.ID,
+			Role:      models.ShelterRoleOwner,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	// A single statement so every row is remapped from its original value,
+	// even when a new shelter id equals another owner's user id.
+	if err := tx.Exec(`UPDATE pets SET shelter_id = (
+		SELECT shelter_id FROM shelter_members
+		WHERE shelter_members.user_id = pets.shelter_id AND shelter_members.role = ?
+	) WHERE shelter_id IN (SELECT user_id FROM shelter_members)`, models.ShelterRoleOwner).Error; err != nil {
+		return err
+	}
+
+	if tx.Migrator().HasConstraint(&models.Pet{}, "fk_users_pets") {
+		return tx.Migrator().DropConstraint(&models.Pet{}, "fk_users_pets")
+	}
+	return nil
+}
+
+// migrateUserStatus marks shelter accounts still waiting for approval as
+// pending; every other existing account starts active.
+func migrateUserStatus(tx *gorm.DB) error {
+	return tx.Model(&models.User{}).
+		Where("role = ? AND is_approved = ?", models.RoleShelter, false).
+		Update("status", models.UserStatusPending).Error
+}
+
+// migrateAdoptionWorkflow renames the old pending status to submitted and
+// backfills the decision timestamps from the last update of each request.
+// UpdateColumn keeps updated_at untouched.
+func migrateAdoptionWorkflow(tx *gorm.DB) error {
+	if err := tx.Model(&models.AdoptionRequest{}).
+		Where("status = ?", "pending").
+		UpdateColumn("status", models.AdoptionStatusSubmitted).Error; err != nil {
+		return err
+	}
+
+	for status, column := range map[models.AdoptionStatus]string{
+		models.AdoptionStatusApproved: "approved_at",
+		models.AdoptionStatusRejected: "rejected_at",
+	} {
+		if err := tx.Model(&models.AdoptionRequest{}).
+			Where("status = ?", status).
+			UpdateColumns(map[string]interface{}{
+				column:              gorm.Expr("updated_at"),
+				"status_changed_at": gorm.Expr("updated_at"),
+			}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAdoptionHistory starts the history of existing requests with their
+// submission and, when they have moved on since, their current status. Who
+// made that change was not recorded, so it has no actor.
+func migrateAdoptionHistory(tx *gorm.DB) error {
+	if err := tx.Exec(`INSERT INTO adoption_status_changes (request_id, "from", "to", actor_id, comment, created_at)
+		SELECT id, '', ?, adopter_id, '', created_at FROM adoption_requests`,
+		models.AdoptionStatusSubmitted).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`INSERT INTO adoption_status_changes (request_id, "from", "to", actor_id, comment, created_at)
+		SELECT id, ?, status, NULL, '', COALESCE(status_changed_at, updated_at) FROM adoption_requests
+		WHERE status <> ?`,
+		models.AdoptionStatusSubmitted, models.AdoptionStatusSubmitted).Error
+}
+
+// migrateEmailVerified treats the accounts created before email verification
+// existed as verified, so that requiring it does not lock them out. Accounts
+// that were already sent a verification link keep waiting for it.
+func migrateEmailVerified(tx *gorm.DB) error {
+	return tx.Model(&models.User{}).
+		Where("email_verified = ?", false).
+		Where("id NOT IN (?)", tx.Model(&models.UserToken{}).
+			Select("user_id").
+			Where("purpose = ?", models.TokenPurposeEmailVerification)).
+		UpdateColumns(map[string]interface{}{
+			"email_verified":    true,
+			"email_verified_at": gorm.Expr("created_at"),
+		}).Error
+}
+
+// openRequestStatuses are the statuses of requests still waiting for a
+// decision, the ones an adopter may hold only one of per pet.
+const openRequestStatuses = `'submitted', 'under_review', 'interview_scheduled'`
+
+// duplicateRequestComment explains, in their history, why duplicate open
+// requests were withdrawn.
+const duplicateRequestComment = "Withdrawn as a duplicate of an earlier open request for this pet."
+
+// migrateOpenRequestIndex lets the database refuse a second open request of
+// an adopter for the same pet. Duplicates that concurrent submissions left
+// behind are withdrawn first, keeping the oldest, and lose their visits.
+func migrateOpenRequestIndex(tx *gorm.DB) error {
+	var ids []uint
+	if err := tx.Raw(`SELECT id FROM adoption_requests
+		WHERE status IN (` + openRequestStatuses + `) AND id NOT IN (
+			SELECT MIN(id) FROM adoption_requests WHERE status IN (` + openRequestStatuses + `)
+			GROUP BY adopter_id, pet_id)`).
+		Scan(&ids).Error; err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		now := time.Now()
+		if err := tx.Exec(`INSERT INTO adoption_status_changes (request_id, "from", "to", actor_id, comment, created_at)
+			SELECT id, status, ?, NULL, ?, ? FROM adoption_requests WHERE id IN ?`,
+			models.AdoptionStatusWithdrawn, duplicateRequestComment, now, ids).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.AdoptionRequest{}).
+			Where("id IN ?", ids).
+			UpdateColumns(map[string]interface{}{
+				"status":            models.AdoptionStatusWithdrawn,
+				"status_changed_at": now,
+				"withdrawn_at":      now,
+			}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE visit_slots SET booking_id = NULL WHERE booking_id IN (
+			SELECT id FROM visit_bookings WHERE request_id IN ? AND status = ?)`,
+			ids, models.VisitStatusBooked).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.VisitBooking{}).
+			Where("request_id IN ? AND status = ?", ids, models.VisitStatusBooked).
+			Updates(map[string]interface{}{
+				"status":       models.VisitStatusCancelled,
+				"sequence":     gorm.Expr("sequence + 1"),
+				"cancelled_at": now,
+			}).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_adoption_requests_open_pet
+		ON adoption_requests (adopter_id, pet_id) WHERE status IN (` + openRequestStatuses + `)`).Error
+}
+
+// migrateBookedVisitIndex lets the database refuse a second booked visit for
+// one request. Extra visits that concurrent bookings left behind are
+// cancelled first, keeping the oldest, and free their slots.
+func migrateBookedVisitIndex(tx *gorm.DB) error {
+	var ids []uint
+	if err := tx.Model(&models.VisitBooking{}).
+		Where("status = ? AND id NOT IN (?)", models.VisitStatusBooked,
+			tx.Model(&models.VisitBooking{}).
+				Select("MIN(id)").
+				Where("status = ?", models.VisitStatusBooked).
+				Group("request_id")).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	if len(ids) > 0 {
+		if err := tx.Model(&models.VisitSlot{}).
+			Where("booking_id IN ?", ids).
+			Update("booking_id", nil).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.VisitBooking{}).
+			Where("id IN ?", ids).
+			Updates(map[string]interface{}{
+				"status":       models.VisitStatusCancelled,
+				"sequence":     gorm.Expr("sequence + 1"),
+				"cancelled_at": time.Now(),
+			}).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_visit_bookings_booked_request
+		ON visit_bookings (request_id) WHERE status = 'booked'`).Error
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// petSearchTriggers keep pets_fts, the full-text index of the pets, in step
+// with the pets table. The index stores no text of its own: deleting an
+// entry takes the values it was indexed with.
+var petSearchTriggers = []struct{ name, sql string }{
+	{"pets_fts_insert", `CREATE TRIGGER IF NOT EXISTS pets_fts_insert AFTER INSERT ON pets BEGIN
+	INSERT INTO pets_fts(rowid, name, breed, description, location)
+	VALUES (new.id, new.name, new.breed, new.description, new.location);
+END`},
+	{"pets_fts_update", `CREATE TRIGGER IF NOT EXISTS pets_fts_update AFTER UPDATE OF name, breed, description, location ON pets BEGIN
+	INSERT INTO pets_fts(pets_fts, rowid, name, breed, description, location)
+	VALUES ('delete', old.id, old.name, old.breed, old.description, old.location);
+	INSERT INTO pets_fts(rowid, name, breed, description, location)
+	VALUES (new.id, new.name, new.breed, new.description, new.location);
+END`},
+	{"pets_fts_delete", `CREATE TRIGGER IF NOT EXISTS pets_fts_delete AFTER DELETE ON pets BEGIN
+	INSERT INTO pets_fts(pets_fts, rowid, name, breed, description, location)
+	VALUES ('delete', old.id, old.name, old.breed, old.description, old.location);
+END`},
+}
+
+// FullTextSearch reports whether SQLite has FTS5, which go-sqlite3 only
+// compiles in with the sqlite_fts5 build tag.
+func FullTextSearch(db *gorm.DB) bool {
+	var enabled int
+	if err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&enabled).Error; err != nil {
+		return false
+	}
+	return enabled == 1
+}
+
+// disablePetSearch drops the triggers of the full-text index, which would
+// make every write to pets fail without FTS5. It runs before any other
+// migration, as those may write to pets too.
+func disablePetSearch(db *gorm.DB) error {
+	for _, trigger := range petSearchTriggers {
+		if err := db.Exec("DROP TRIGGER IF EXISTS " + trigger.name).Error; err != nil {
+			return err
+		}
+	}
+	log.Printf("database: SQLite was built without FTS5, pet search is disabled (build with -tags sqlite_fts5)")
+	return nil
+}
+
+// migratePetSearch creates the full-text index of the pets and its
+// triggers. The index ignores case and accents, so "nino" finds "Niño".
+// Whenever the triggers were missing, because the index is new or the
+// server ran without FTS5 for a while, the index is rebuilt from the pets.
+func migratePetSearch(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS pets_fts USING fts5(
+	name, breed, description, location,
+	content = 'pets', content_rowid = 'id',
+	tokenize = "unicode61 remove_diacritics 2"
+)`).Error; err != nil {
+			return err
+		}
+
+		names := make([]string, len(petSearchTriggers))
+		for i, trigger := range petSearchTriggers {
+			names[i] = trigger.name
+		}
+		var existing int64
+		if err := tx.Table("sqlite_master").Where("type = ? AND name IN ?", "trigger", names).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if int(existing) == len(petSearchTriggers) {
+			return nil
+		}
+
+		for _, trigger := range petSearchTriggers {
+			if err := tx.Exec(trigger.sql).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec("INSERT INTO pets_fts(pets_fts) VALUES ('rebuild')").Error
+	})
+}
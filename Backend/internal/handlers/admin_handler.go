@@ -1,10 +1,15 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"petmatch/internal/authz"
+	"petmatch/internal/lockout"
+	"petmatch/internal/middleware"
 	"petmatch/internal/models"
 	"petmatch/internal/repositories"
 	"petmatch/internal/services"
@@ -13,14 +18,38 @@ import (
 )
 
 type AdminHandler struct {
-	users *repositories.UserRepository
-	auth  *services.AuthService
+	users    *repositories.UserRepository
+	auth     *services.AuthService
+	shelters *services.ShelterService
+	audit    *services.Auditor
+	authz    *authz.Authorizer
 }
 
-func NewAdminHandler(users *repositories.UserRepository, auth *services.AuthService) *AdminHandler {
+type changeRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type accountStatusRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+type impersonateRequest struct {
+	Reason string `json:"reason" binding:"required,max=500"`
+}
+
+func NewAdminHandler(
+	users *repositories.UserRepository,
+	auth *services.AuthService,
+	shelters *services.ShelterService,
+	auditor *services.Auditor,
+	authorizer *authz.Authorizer,
+) *AdminHandler {
 	return &AdminHandler{
-		users: users,
-		auth:  auth,
+		users:    users,
+		auth:     auth,
+		shelters: shelters,
+		audit:    auditor,
+		authz:    authorizer,
 	}
 }
 
@@ -37,52 +66,468 @@ func (h *AdminHandler) ListUsers(c *gin.Context) {
 		approvedFilter = &value
 	}
 
-	users, err := h.users.List(repositories.UserFilter{
+	var statusFilter *models.UserStatus
+	if status := c.Query("status"); status != "" {
+		s := models.UserStatus(strings.ToLower(status))
+		statusFilter = &s
+	}
+
+	page, ok := queryListPage(c, defaultUserPageSize, maxUserPageSize, "-created_at")
+	if !ok {
+		return
+	}
+
+	users, info, err := h.users.List(repositories.UserFilter{
 		Role:     roleFilter,
 		Approved: approvedFilter,
-	})
+		Status:   statusFilter,
+	}, page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		switch err {
+		case repositories.ErrInvalidSort, repositories.ErrInvalidCursor:
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"users": users})
+	response := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		response = append(response, userResponse(user))
+	}
+
+	c.JSON(http.StatusOK, pageResponse("users", response, page, info))
 }
 
-func (h *AdminHandler) ApproveShelter(c *gin.Context) {
+// ChangeRole assigns any role defined by the permission policy, including
+// custom ones such as moderator or volunteer.
+func (h *AdminHandler) ChangeRole(c *gin.Context) {
+	admin := middleware.CurrentUser(c)
+	if admin == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
 
-	user, err := h.users.FindByID(uint(id))
+	var req changeRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role := models.UserRole(strings.ToLower(strings.TrimSpace(req.Role)))
+	if !h.authz.HasRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrUnsupportedRole.Error()})
+		return
+	}
+
+	user, err := h.auth.ChangeRole(admin, uint(id), role, middleware.CurrentRequestMeta(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		switch err {
+		case services.ErrUserNotFound:
+			status = http.StatusNotFound
+		case services.ErrCannotChangeOwnRole:
+			status = http.StatusBadRequest
+		case services.ErrLastAdmin, services.ErrRoleNeedsShelter, services.ErrRoleLeavesShelter:
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":        userResponse(*user),
+		"permissions": h.authz.Permissions(role),
+	})
+}
+
+// RejectUser turns down a pending application, e.g. a shelter sign-up.
+func (h *AdminHandler) RejectUser(c *gin.Context) {
+	h.changeStatus(c, h.auth.RejectAccount)
+}
+
+// SuspendUser blocks an active account; its sessions end immediately.
+func (h *AdminHandler) SuspendUser(c *gin.Context) {
+	h.changeStatus(c, h.auth.SuspendAccount)
+}
+
+func (h *AdminHandler) ReinstateUser(c *gin.Context) {
+	h.changeStatus(c, h.auth.ReinstateAccount)
+}
+
+func (h *AdminHandler) changeStatus(c *gin.Context, change func(*models.User, uint, string, services.RequestMeta) (*models.User, error)) {
+	admin := middleware.CurrentUser(c)
+	if admin == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req accountStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-	if user == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+
+	user, err := change(admin, uint(id), req.Reason, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case services.ErrUserNotFound:
+			status = http.StatusNotFound
+		case services.ErrStatusReasonRequired, services.ErrCannotChangeOwnStatus:
+			status = http.StatusBadRequest
+		case services.ErrInvalidStatusTransition:
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	if user.Role != models.RoleShelter {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user is not a shelter"})
+	c.JSON(http.StatusOK, gin.H{"user": userResponse(*user)})
+}
+
+func (h *AdminHandler) ListLockouts(c *gin.Context) {
+	entries, err := h.auth.Lockouts()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if user.IsApproved {
-		c.JSON(http.StatusOK, gin.H{"message": "shelter already approved"})
+	c.JSON(http.StatusOK, gin.H{"lockouts": entries})
+}
+
+// ClearLockout removes the failed-attempt state of an account (by email) or
+// of a client IP.
+func (h *AdminHandler) ClearLockout(c *gin.Context) {
+	kind := c.Param("kind")
+	if kind != lockout.KindAccount && kind != lockout.KindIP {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be account or ip"})
 		return
 	}
 
-	if err := h.auth.ApproveShelter(user); err != nil {
+	if err := h.auth.ClearLockout(middleware.CurrentUser(c), kind, c.Param("value"), middleware.CurrentRequestMeta(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AdminHandler) ListShelters(c *gin.Context) {
+	var approvedFilter *bool
+	if approved := c.Query("approved"); approved != "" {
+		value := strings.EqualFold(approved, "true")
+		approvedFilter = &value
+	}
+
+	shelters, err := h.shelters.List(approvedFilter)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{"shelters": shelters})
+}
+
+// ApproveShelter approves a shelter organization, which lets its members
+// sign in.
+func (h *AdminHandler) ApproveShelter(c *gin.Context) {
+	admin := middleware.CurrentUser(c)
+	if admin == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	shelter, err := h.shelters.Approve(admin, uint(id), middleware.CurrentRequestMeta(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == services.ErrShelterNotFound {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "shelter approved",
-		"user":    user,
+		"shelter": shelter,
+	})
+}
+
+// Impersonate issues a short-lived token to act as the user while helping
+// them. Requests made with it are recorded.
+func (h *AdminHandler) Impersonate(c *gin.Context) {
+	admin := middleware.CurrentUser(c)
+	if admin == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req impersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.auth.Impersonate(admin, uint(id), req.Reason, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case services.ErrUserNotFound:
+			status = http.StatusNotFound
+		case services.ErrStatusReasonRequired, services.ErrCannotImpersonateSelf:
+			status = http.StatusBadRequest
+		case services.ErrCannotImpersonate:
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"token":         result.Token,
+		"expiresIn":     int(result.ExpiresIn.Seconds()),
+		"user":          userResponse(result.Impersonation.User),
+		"impersonation": impersonationResponse(*result.Impersonation),
 	})
 }
+
+func (h *AdminHandler) ListImpersonations(c *gin.Context) {
+	impersonatorID, err := queryID(c, "adminId")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid adminId"})
+		return
+	}
+	userID, err := queryID(c, "userId")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid userId"})
+		return
+	}
+
+	impersonations, err := h.auth.Impersonations(repositories.ImpersonationFilter{
+		ImpersonatorID: impersonatorID,
+		UserID:         userID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(impersonations))
+	for _, impersonation := range impersonations {
+		item := impersonationResponse(impersonation)
+		item["user"] = userResponse(impersonation.User)
+		response = append(response, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"impersonations": response})
+}
+
+// ListImpersonatedRequests returns the audit trail of one impersonation.
+func (h *AdminHandler) ListImpersonatedRequests(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	requests, err := h.auth.ImpersonatedRequests(uint(id))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == services.ErrImpersonationNotFound {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(requests))
+	for _, request := range requests {
+		response = append(response, gin.H{
+			"method":    request.Method,
+			"path":      request.Path,
+			"status":    request.Status,
+			"clientIp":  request.ClientIP,
+			"createdAt": request.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"requests": response})
+}
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 200
+	defaultUserPageSize  = 50
+	maxUserPageSize      = 200
+)
+
+// ListAuditEvents pages through the audit log, newest first unless sort
+// says otherwise. Events can be filtered by actor, action, target, request
+// id and a [from, to) time range.
+func (h *AdminHandler) ListAuditEvents(c *gin.Context) {
+	filter := repositories.AuditFilter{
+		Action:     c.Query("action"),
+		TargetType: c.Query("targetType"),
+		RequestID:  c.Query("requestId"),
+	}
+
+	var err error
+	if filter.ActorID, err = queryID(c, "actorId"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid actorId"})
+		return
+	}
+	if filter.TargetID, err = queryID(c, "targetId"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid targetId"})
+		return
+	}
+	if filter.From, err = queryTime(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 time"})
+		return
+	}
+	if filter.To, err = queryTime(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 time"})
+		return
+	}
+
+	page, ok := queryListPage(c, defaultAuditPageSize, maxAuditPageSize, "-created_at")
+	if !ok {
+		return
+	}
+
+	events, info, err := h.audit.List(filter, page)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case repositories.ErrInvalidSort, repositories.ErrInvalidCursor:
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(events))
+	for _, event := range events {
+		response = append(response, auditEventResponse(event))
+	}
+
+	c.JSON(http.StatusOK, pageResponse("events", response, page, info))
+}
+
+func auditEventResponse(event models.AuditEvent) gin.H {
+	var actor gin.H
+	if event.Actor != nil {
+		actor = gin.H{
+			"id":    event.Actor.ID,
+			"name":  event.Actor.Name,
+			"email": event.Actor.Email,
+		}
+	}
+
+	changes := json.RawMessage(event.Changes)
+	if len(changes) == 0 {
+		changes = json.RawMessage("{}")
+	}
+
+	return gin.H{
+		"id":             event.ID,
+		"actor":          actor,
+		"impersonatorId": event.ImpersonatorID,
+		"apiKeyId":       event.APIKeyID,
+		"action":         event.Action,
+		"targetType":     event.TargetType,
+		"targetId":       event.TargetID,
+		"changes":        changes,
+		"ip":             event.IP,
+		"requestId":      event.RequestID,
+		"createdAt":      event.CreatedAt,
+	}
+}
+
+// queryTime reads an optional RFC 3339 time from the query string.
+func queryTime(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	// Timestamps are stored in local time; compare in the same zone.
+	parsed = parsed.Local()
+	return &parsed, nil
+}
+
+// queryID reads an optional numeric id from the query string.
+func queryID(c *gin.Context, name string) (*uint, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, err
+	}
+	result := uint(id)
+	return &result, nil
+}
+
+// queryPage reads the page and pageSize query parameters, capping pageSize
+// at max. It answers 400 and reports false when they are not valid.
+func queryPage(c *gin.Context, defaultSize, max int) (int, int, bool) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid page"})
+		return 0, 0, false
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", strconv.Itoa(defaultSize)))
+	if err != nil || pageSize < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid pageSize"})
+		return 0, 0, false
+	}
+	if pageSize > max {
+		pageSize = max
+	}
+	return page, pageSize, true
+}
+
+func impersonationResponse(impersonation models.Impersonation) gin.H {
+	return gin.H{
+		"id":     impersonation.ID,
+		"userId": impersonation.UserID,
+		"impersonator": gin.H{
+			"id":    impersonation.Impersonator.ID,
+			"name":  impersonation.Impersonator.Name,
+			"email": impersonation.Impersonator.Email,
+		},
+		"reason":    impersonation.Reason,
+		"expiresAt": impersonation.ExpiresAt,
+		"createdAt": impersonation.CreatedAt,
+	}
+}
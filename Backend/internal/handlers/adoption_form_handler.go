@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"petmatch/internal/middleware"
+	"petmatch/internal/models"
+	"petmatch/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdoptionFormHandler struct {
+	forms *services.AdoptionFormService
+}
+
+type adoptionFormRequest struct {
+	Species string                     `json:"species"`
+	Title   string                     `json:"title" binding:"required"`
+	Fields  []adoptionFormFieldRequest `json:"fields" binding:"required"`
+}
+
+type adoptionFormFieldRequest struct {
+	Key       string               `json:"key"`
+	Label     string               `json:"label"`
+	Type      models.FormFieldType `json:"type"`
+	Required  bool                 `json:"required"`
+	Options   []string             `json:"options"`
+	MinLength *int                 `json:"minLength"`
+	MaxLength *int                 `json:"maxLength"`
+	Min       *float64             `json:"min"`
+	Max       *float64             `json:"max"`
+	Pattern   string               `json:"pattern"`
+}
+
+func NewAdoptionFormHandler(forms *services.AdoptionFormService) *AdoptionFormHandler {
+	return &AdoptionFormHandler{forms: forms}
+}
+
+func (h *AdoptionFormHandler) List(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	forms, err := h.forms.List(user)
+	if err != nil {
+		c.JSON(adoptionFormErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(forms))
+	for _, form := range forms {
+		response = append(response, adoptionFormResponse(form))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"forms": response})
+}
+
+func (h *AdoptionFormHandler) Create(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req adoptionFormRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	form, err := h.forms.Create(user, req.input(), middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(adoptionFormErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"form": adoptionFormResponse(*form)})
+}
+
+func (h *AdoptionFormHandler) Update(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req adoptionFormRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	form, err := h.forms.Update(user, uint(id), req.input(), middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(adoptionFormErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"form": adoptionFormResponse(*form)})
+}
+
+func (h *AdoptionFormHandler) Delete(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.forms.Delete(user, uint(id), middleware.CurrentRequestMeta(c)); err != nil {
+		c.JSON(adoptionFormErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ForPet is public so adopters can render the form before applying. It
+// answers null when the pet's shelter has no form.
+func (h *AdoptionFormHandler) ForPet(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	form, err := h.forms.ForPet(uint(id))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == services.ErrPetNotFound {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if form == nil {
+		c.JSON(http.StatusOK, gin.H{"form": nil})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"form": adoptionFormResponse(*form)})
+}
+
+func (r adoptionFormRequest) input() services.AdoptionFormInput {
+	fields := make([]services.AdoptionFormFieldInput, 0, len(r.Fields))
+	for _, field := range r.Fields {
+		fields = append(fields, services.AdoptionFormFieldInput{
+			Key:       field.Key,
+			Label:     field.Label,
+			Type:      field.Type,
+			Required:  field.Required,
+			Options:   field.Options,
+			MinLength: field.MinLength,
+			MaxLength: field.MaxLength,
+			Min:       field.Min,
+			Max:       field.Max,
+			Pattern:   field.Pattern,
+		})
+	}
+	return services.AdoptionFormInput{
+		Species: r.Species,
+		Title:   r.Title,
+		Fields:  fields,
+	}
+}
+
+func adoptionFormErrorStatus(err error) int {
+	var definitionErr *services.FormDefinitionError
+	switch {
+	case errors.As(err, &definitionErr),
+		err == services.ErrAdoptionFormTitle,
+		err == services.ErrAdoptionFormEmpty:
+		return http.StatusBadRequest
+	case err == services.ErrAdoptionFormNotFound:
+		return http.StatusNotFound
+	case err == services.ErrAdoptionFormExists:
+		return http.StatusConflict
+	default:
+		return shelterErrorStatus(err)
+	}
+}
+
+func adoptionFormResponse(form models.AdoptionForm) gin.H {
+	fields := make([]gin.H, 0, len(form.Fields))
+	for _, field := range form.Fields {
+		fields = append(fields, gin.H{
+			"key":       field.Key,
+			"label":     field.Label,
+			"type":      field.Type,
+			"required":  field.Required,
+			"options":   field.Options,
+			"minLength": field.MinLength,
+			"maxLength": field.MaxLength,
+			"min":       field.Min,
+			"max":       field.Max,
+			"pattern":   field.Pattern,
+		})
+	}
+	return gin.H{
+		"id":        form.ID,
+		"species":   form.Species,
+		"title":     form.Title,
+		"fields":    fields,
+		"createdAt": form.CreatedAt,
+		"updatedAt": form.UpdatedAt,
+	}
+}
@@ -1,26 +1,50 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
 	"petmatch/internal/middleware"
 	"petmatch/internal/models"
+	"petmatch/internal/repositories"
 	"petmatch/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	defaultAdoptionPageSize = 20
+	maxAdoptionPageSize     = 100
+)
+
 type AdoptionHandler struct {
     adoptions *services.AdoptionService
 }
 
 type createAdoptionRequest struct {
-	Message string `json:"message"`
+	Message string                 `json:"message"`
+	Answers map[string]interface{} `json:"answers"`
 }
 
 type updateAdoptionStatusRequest struct {
-	Status models.AdoptionStatus `json:"status" binding:"required"`
+	Status  models.AdoptionStatus `json:"status" binding:"required"`
+	Comment string                `json:"comment" binding:"max=1000"`
+}
+
+type withdrawAdoptionRequest struct {
+	Comment string `json:"comment" binding:"max=1000"`
+}
+
+type evaluationRequest struct {
+	Score            *int                     `json:"score"`
+	InterviewOutcome models.EvaluationOutcome `json:"interviewOutcome"`
+	ReferenceCheck   models.EvaluationOutcome `json:"referenceCheck"`
+}
+
+type noteRequest struct {
+	Body string `json:"body" binding:"required"`
 }
 
 func NewAdoptionHandler(service *services.AdoptionService) *AdoptionHandler {
@@ -49,88 +73,145 @@ func (h *AdoptionHandler) Create(c *gin.Context) {
 	request, err := h.adoptions.Create(user, services.CreateRequestInput{
 		PetID:   uint(petID),
 		Message: req.Message,
-	})
+		Answers: req.Answers,
+	}, middleware.CurrentRequestMeta(c))
+	var answersErr *services.FormAnswersError
+	if errors.As(err, &answersErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "fields": answersErr.Fields})
+		return
+	}
 	if err != nil {
 		status := http.StatusInternalServerError
 		switch err {
-		case services.ErrAdopterRoleRequired:
+		case services.ErrAdopterRoleRequired, services.ErrEmailNotVerified:
 			status = http.StatusForbidden
 		case services.ErrPetNotFound:
 			status = http.StatusNotFound
+		case services.ErrPetNotAvailable, services.ErrDuplicateRequest, services.ErrOpenRequestLimit:
+			status = http.StatusConflict
 		}
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"request": request})
+	c.JSON(http.StatusCreated, gin.H{"request": adoptionRequestResponse(*request)})
+}
+
+// List returns adoption requests based on the caller's permissions.
+// - Reviewers (shelter staff): lists requests for their shelter's pets
+// - Adopters: lists their submitted requests
+func (h *AdoptionHandler) List(c *gin.Context) {
+    user := middleware.CurrentUser(c)
+    if user == nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+        return
+    }
+
+    page, ok := queryListPage(c, defaultAdoptionPageSize, maxAdoptionPageSize, "-created_at")
+    if !ok {
+        return
+    }
+
+    requests, info, err := h.adoptions.ListVisible(user, page)
+    if err != nil {
+        status := http.StatusInternalServerError
+        switch err {
+        case services.ErrPermissionDenied, services.ErrNotShelterMember:
+            status = http.StatusForbidden
+        case repositories.ErrInvalidSort, repositories.ErrInvalidCursor:
+            status = http.StatusBadRequest
+        }
+        c.JSON(status, gin.H{"error": err.Error()})
+        return
+    }
+    c.JSON(http.StatusOK, pageResponse("requests", adoptionRequestResponses(requests), page, info))
 }
 
-func (h *AdoptionHandler) ListForShelter(c *gin.Context) {
+func (h *AdoptionHandler) Get(c *gin.Context) {
 	user := middleware.CurrentUser(c)
 	if user == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
 		return
 	}
 
-	requests, err := h.adoptions.ListForShelter(user.ID)
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"requests": requests})
+	details, err := h.adoptions.Get(user, uint(id))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case services.ErrRequestNotFound:
+			status = http.StatusNotFound
+		case services.ErrPermissionDenied, services.ErrNotShelterMember:
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	history := make([]gin.H, 0, len(details.History))
+	for _, change := range details.History {
+		history = append(history, statusChangeResponse(change))
+	}
+
+	response := gin.H{"request": adoptionRequestResponse(details.Request), "history": history}
+	if details.Review != nil {
+		response["internal"] = reviewResponse(*details.Review)
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
-func (h *AdoptionHandler) ListForAdopter(c *gin.Context) {
+func (h *AdoptionHandler) UpdateStatus(c *gin.Context) {
 	user := middleware.CurrentUser(c)
 	if user == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
 		return
 	}
 
-	requests, err := h.adoptions.ListForAdopter(user.ID)
+	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"requests": requests})
-}
+	var req updateAdoptionStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-// List returns adoption requests based on the caller role.
-// - Shelter: lists requests for their pets
-// - Adopter: lists their submitted requests
-func (h *AdoptionHandler) List(c *gin.Context) {
-    user := middleware.CurrentUser(c)
-    if user == nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
-        return
-    }
+	request, err := h.adoptions.UpdateStatus(user, uint(id), services.UpdateRequestInput{
+		Status:  req.Status,
+		Comment: req.Comment,
+	}, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case services.ErrUnknownAdoptionStatus:
+			status = http.StatusBadRequest
+		case services.ErrRequestNotFound:
+			status = http.StatusNotFound
+		case services.ErrPetNotFound:
+			status = http.StatusNotFound
+		case services.ErrInvalidAdoptionTransition, services.ErrPetNotAvailable:
+			status = http.StatusConflict
+		case services.ErrShelterOwnership, services.ErrPermissionDenied,
+			services.ErrNotShelterMember, services.ErrShelterRoleForbidden:
+			status = http.StatusForbidden
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
 
-    switch user.Role {
-    case models.RoleShelter:
-        requests, err := h.adoptions.ListForShelter(user.ID)
-        if err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-            return
-        }
-        c.JSON(http.StatusOK, gin.H{"requests": requests})
-        return
-    case models.RoleAdopter:
-        requests, err := h.adoptions.ListForAdopter(user.ID)
-        if err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-            return
-        }
-        c.JSON(http.StatusOK, gin.H{"requests": requests})
-        return
-    default:
-        c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
-        return
-    }
+	c.JSON(http.StatusOK, gin.H{"request": adoptionRequestResponse(*request)})
 }
 
-func (h *AdoptionHandler) UpdateStatus(c *gin.Context) {
+func (h *AdoptionHandler) Withdraw(c *gin.Context) {
 	user := middleware.CurrentUser(c)
 	if user == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
@@ -143,28 +224,242 @@ func (h *AdoptionHandler) UpdateStatus(c *gin.Context) {
 		return
 	}
 
-	var req updateAdoptionStatusRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	// The body is optional.
+	var req withdrawAdoptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	request, err := h.adoptions.UpdateStatus(user, uint(id), services.UpdateRequestInput{
-		Status: req.Status,
-	})
+	request, err := h.adoptions.Withdraw(user, uint(id), req.Comment, middleware.CurrentRequestMeta(c))
 	if err != nil {
 		status := http.StatusInternalServerError
 		switch err {
 		case services.ErrRequestNotFound:
 			status = http.StatusNotFound
-		case services.ErrPetNotFound:
-			status = http.StatusNotFound
-		case services.ErrShelterOwnership:
+		case services.ErrPermissionDenied:
 			status = http.StatusForbidden
+		case services.ErrInvalidAdoptionTransition:
+			status = http.StatusConflict
 		}
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"request": request})
+	c.JSON(http.StatusOK, gin.H{"request": adoptionRequestResponse(*request)})
+}
+
+// adoptionRequestResponse shows a request with the public data of its pet,
+// shelter and adopter only.
+func adoptionRequestResponse(request models.AdoptionRequest) gin.H {
+	return gin.H{
+		"id":                   request.ID,
+		"petId":                request.PetID,
+		"pet":                  adoptionPetResponse(request.Pet),
+		"adopterId":            request.AdopterID,
+		"adopter":              adopterResponse(request.Adopter),
+		"message":              request.Message,
+		"status":               request.Status,
+		"formId":               request.FormID,
+		"answers":              request.Answers,
+		"createdAt":            request.CreatedAt,
+		"updatedAt":            request.UpdatedAt,
+		"statusChangedAt":      request.StatusChangedAt,
+		"reviewStartedAt":      request.ReviewStartedAt,
+		"interviewScheduledAt": request.InterviewScheduledAt,
+		"approvedAt":           request.ApprovedAt,
+		"rejectedAt":           request.RejectedAt,
+		"withdrawnAt":          request.WithdrawnAt,
+		"completedAt":          request.CompletedAt,
+	}
+}
+
+// adopterResponse is what the shelter needs to get in touch with the
+// adopter, without the state of their account.
+func adopterResponse(adopter models.User) gin.H {
+	return gin.H{
+		"id":    adopter.ID,
+		"name":  adopter.Name,
+		"email": adopter.Email,
+		"phone": adopter.Phone,
+		"city":  adopter.City,
+	}
+}
+
+func adoptionRequestResponses(requests []models.AdoptionRequest) []gin.H {
+	response := make([]gin.H, 0, len(requests))
+	for _, request := range requests {
+		response = append(response, adoptionRequestResponse(request))
+	}
+	return response
+}
+
+func adoptionPetResponse(pet models.Pet) gin.H {
+	return gin.H{
+		"id":          pet.ID,
+		"name":        pet.Name,
+		"species":     pet.Species,
+		"breed":       pet.Breed,
+		"age":         pet.Age,
+		"description": pet.Description,
+		"location":    pet.Location,
+		"photoUrl":    pet.PhotoURL,
+		"status":      pet.Status,
+		"shelterId":   pet.ShelterID,
+		"shelter":     shelterResponse(pet.Shelter),
+	}
+}
+
+func statusChangeResponse(change models.AdoptionStatusChange) gin.H {
+	return gin.H{
+		"id":        change.ID,
+		"from":      change.From,
+		"to":        change.To,
+		"actor":     userSummary(change.Actor),
+		"comment":   change.Comment,
+		"createdAt": change.CreatedAt,
+	}
+}
+
+// UpdateEvaluation and the note endpoints are for the pet's shelter only;
+// their data never appears in what adopters can read.
+func (h *AdoptionHandler) UpdateEvaluation(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req evaluationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	evaluation, err := h.adoptions.UpdateEvaluation(user, uint(id), services.EvaluationInput{
+		Score:            req.Score,
+		InterviewOutcome: req.InterviewOutcome,
+		ReferenceCheck:   req.ReferenceCheck,
+	}, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(adoptionReviewErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"evaluation": evaluationResponse(evaluation)})
+}
+
+func (h *AdoptionHandler) AddNote(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req noteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	note, err := h.adoptions.AddNote(user, uint(id), req.Body, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(adoptionReviewErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"note": noteResponse(*note)})
+}
+
+func (h *AdoptionHandler) DeleteNote(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	noteID, err := strconv.Atoi(c.Param("noteId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note id"})
+		return
+	}
+
+	if err := h.adoptions.DeleteNote(user, uint(id), uint(noteID), middleware.CurrentRequestMeta(c)); err != nil {
+		c.JSON(adoptionReviewErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func adoptionReviewErrorStatus(err error) int {
+	switch err {
+	case services.ErrInvalidScore, services.ErrInvalidOutcome, services.ErrNoteRequired:
+		return http.StatusBadRequest
+	case services.ErrRequestNotFound, services.ErrAdoptionNoteNotFound:
+		return http.StatusNotFound
+	case services.ErrPermissionDenied, services.ErrNotShelterMember, services.ErrShelterRoleForbidden:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func reviewResponse(review services.AdoptionReview) gin.H {
+	notes := make([]gin.H, 0, len(review.Notes))
+	for _, note := range review.Notes {
+		notes = append(notes, noteResponse(note))
+	}
+	return gin.H{
+		"evaluation": evaluationResponse(review.Evaluation),
+		"notes":      notes,
+	}
+}
+
+func evaluationResponse(evaluation *models.AdoptionEvaluation) gin.H {
+	if evaluation == nil {
+		return nil
+	}
+	return gin.H{
+		"score":            evaluation.Score,
+		"interviewOutcome": evaluation.InterviewOutcome,
+		"referenceCheck":   evaluation.ReferenceCheck,
+		"updatedBy":        userSummary(evaluation.UpdatedBy),
+		"updatedAt":        evaluation.UpdatedAt,
+	}
+}
+
+func noteResponse(note models.AdoptionNote) gin.H {
+	return gin.H{
+		"id":        note.ID,
+		"author":    userSummary(note.Author),
+		"body":      note.Body,
+		"createdAt": note.CreatedAt,
+	}
+}
+
+// userSummary names the user behind an entry, or is null when the account
+// is gone.
+func userSummary(user *models.User) gin.H {
+	if user == nil {
+		return nil
+	}
+	return gin.H{"id": user.ID, "name": user.Name}
 }
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"petmatch/internal/middleware"
+	"petmatch/internal/models"
+	"petmatch/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHandler struct {
+	keys *services.APIKeyService
+}
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,min=2"`
+	Scopes    []string   `json:"scopes" binding:"required"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+func NewAPIKeyHandler(keys *services.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+// Create returns the raw key once; only its hash is kept.
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, raw, err := h.keys.Create(user, services.CreateAPIKeyInput{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"apiKey": apiKeyResponse(*key),
+		"key":    raw,
+	})
+}
+
+func (h *APIKeyHandler) List(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	keys, err := h.keys.List(user)
+	if err != nil {
+		c.JSON(apiKeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, apiKeyResponse(key))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"apiKeys": response})
+}
+
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.keys.Revoke(user, uint(id), middleware.CurrentRequestMeta(c)); err != nil {
+		c.JSON(apiKeyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func apiKeyErrorStatus(err error) int {
+	var scopeErr *services.APIKeyScopeError
+	switch {
+	case errors.As(err, &scopeErr),
+		err == services.ErrAPIKeyScopesEmpty,
+		err == services.ErrAPIKeyExpiryPassed:
+		return http.StatusBadRequest
+	case err == services.ErrAPIKeyNotFound:
+		return http.StatusNotFound
+	default:
+		return shelterErrorStatus(err)
+	}
+}
+
+func apiKeyResponse(key models.APIKey) gin.H {
+	return gin.H{
+		"id":         key.ID,
+		"name":       key.Name,
+		"prefix":     key.Prefix,
+		"scopes":     key.ScopeList(),
+		"createdBy":  gin.H{"id": key.CreatedBy.ID, "name": key.CreatedBy.Name},
+		"createdAt":  key.CreatedAt,
+		"expiresAt":  key.ExpiresAt,
+		"lastUsedAt": key.LastUsedAt,
+		"revokedAt":  key.RevokedAt,
+	}
+}
@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"errors"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"petmatch/internal/middleware"
 	"petmatch/internal/models"
@@ -11,7 +16,8 @@ import (
 )
 
 type AuthHandler struct {
-	auth *services.AuthService
+	auth     *services.AuthService
+	accounts *services.AccountService
 }
 
 type registerRequest struct {
@@ -29,8 +35,25 @@ type loginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
-func NewAuthHandler(auth *services.AuthService) *AuthHandler {
-	return &AuthHandler{auth: auth}
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type resendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+func NewAuthHandler(auth *services.AuthService, accounts *services.AccountService) *AuthHandler {
+	return &AuthHandler{auth: auth, accounts: accounts}
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -59,17 +82,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	// The account exists at this point; a failed mail can be retried through
+	// /auth/verify/resend, so it must not fail the registration.
+	if err := h.accounts.SendVerification(user); err != nil {
+		log.Printf("failed to send verification email to user %d: %v", user.ID, err)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
-		"user": gin.H{
-			"id":          user.ID,
-			"name":        user.Name,
-			"email":       user.Email,
-			"role":        user.Role,
-			"city":        user.City,
-			"phone":       user.Phone,
-			"isApproved":  user.IsApproved,
-			"shelterName": user.ShelterName,
-		},
+		"user":    userResponse(*user),
 		"message": messageForRole(user.Role),
 	})
 }
@@ -81,11 +101,14 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	result, err := h.auth.Login(req.Email, req.Password)
+	result, err := h.auth.Login(req.Email, req.Password, c.ClientIP())
 	if err != nil {
+		if respondThrottled(c, err) || respondAccountStatus(c, err) {
+			return
+		}
 		status := http.StatusUnauthorized
 		switch err {
-		case services.ErrShelterNotApproved:
+		case services.ErrShelterNotApproved, services.ErrEmailNotVerified:
 			status = http.StatusForbidden
 		case services.ErrInvalidCredentials:
 			status = http.StatusUnauthorized
@@ -96,19 +119,208 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
+	if result.Challenge != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"twoFactorRequired":  true,
+			"enrollmentRequired": result.Challenge.Enrollment,
+			"challengeToken":     result.Challenge.Token,
+			"expiresIn":          int(result.Challenge.ExpiresIn.Seconds()),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessionResponse(result))
+}
+
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req refreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.auth.Refresh(req.RefreshToken)
+	if err != nil {
+		if respondAccountStatus(c, err) {
+			return
+		}
+		status := http.StatusInternalServerError
+		switch err {
+		case services.ErrInvalidRefreshToken, services.ErrRefreshTokenReused:
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessionResponse(result))
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req refreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.auth.Logout(req.RefreshToken); err != nil {
+		status := http.StatusInternalServerError
+		if err == services.ErrInvalidRefreshToken {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req forgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accounts.ForgotPassword(req.Email, c.ClientIP()); err != nil {
+		if respondThrottled(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Si el correo está registrado, recibirás un enlace para restablecer tu contraseña.",
+	})
+}
+
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accounts.ResetPassword(req.Token, req.Password); err != nil {
+		status := http.StatusInternalServerError
+		if err == services.ErrInvalidResetToken {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contraseña actualizada."})
+}
+
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	user, err := h.accounts.VerifyEmail(token)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == services.ErrInvalidVerificationToken {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"token": result.Token,
-		"user": gin.H{
-			"id":          result.User.ID,
-			"name":        result.User.Name,
-			"email":       result.User.Email,
-			"role":        result.User.Role,
-			"city":        result.User.City,
-			"phone":       result.User.Phone,
-			"isApproved":  result.User.IsApproved,
-			"shelterName": result.User.ShelterName,
-		},
+		"message": "Correo verificado.",
+		"email":   user.Email,
+	})
+}
+
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var req resendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accounts.ResendVerification(req.Email, c.ClientIP()); err != nil {
+		if respondThrottled(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Si la cuenta existe y no está verificada, enviaremos un nuevo enlace.",
+	})
+}
+
+// respondThrottled answers with 429 and a Retry-After header when err is a
+// login or email throttling error.
+func respondThrottled(c *gin.Context, err error) bool {
+	var retryAfter time.Duration
+	var login *services.LoginThrottledError
+	var mail *services.MailThrottledError
+	switch {
+	case errors.As(err, &login):
+		retryAfter = login.RetryAfter
+	case errors.As(err, &mail):
+		retryAfter = mail.RetryAfter
+	default:
+		return false
+	}
+
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      err.Error(),
+		"retryAfter": seconds,
 	})
+	return true
+}
+
+// respondAccountStatus answers with 403 and the admin's reason when err
+// reports a rejected or suspended account.
+func respondAccountStatus(c *gin.Context, err error) bool {
+	var inactive *services.AccountStatusError
+	if !errors.As(err, &inactive) {
+		return false
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":  inactive.Error(),
+		"status": inactive.Status,
+		"reason": inactive.Reason,
+	})
+	return true
+}
+
+func sessionResponse(result *services.LoginOutput) gin.H {
+	return gin.H{
+		"token":        result.Token,
+		"refreshToken": result.RefreshToken,
+		"expiresIn":    int(result.ExpiresIn.Seconds()),
+		"user":         userResponse(result.User),
+	}
+}
+
+func userResponse(user models.User) gin.H {
+	return gin.H{
+		"id":            user.ID,
+		"name":          user.Name,
+		"email":         user.Email,
+		"role":          user.Role,
+		"city":          user.City,
+		"phone":         user.Phone,
+		"isApproved":    user.IsApproved,
+		"status":        user.Status,
+		"statusReason":  user.StatusReason,
+		"emailVerified": user.EmailVerified,
+		"twoFactor":     user.TwoFactorEnabled,
+		"shelterName":   user.ShelterName,
+	}
 }
 
 func messageForRole(role models.UserRole) string {
@@ -125,16 +337,26 @@ func CurrentUserHandler(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"user": gin.H{
-			"id":          user.ID,
-			"name":        user.Name,
-			"email":       user.Email,
-			"role":        user.Role,
-			"city":        user.City,
-			"phone":       user.Phone,
-			"isApproved":  user.IsApproved,
-			"shelterName": user.ShelterName,
-		},
-	})
+	response := gin.H{
+		"user": userResponse(*user),
+	}
+	if impersonation := middleware.CurrentImpersonation(c); impersonation != nil {
+		response["impersonation"] = impersonationResponse(*impersonation)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// StopImpersonation ends the impersonation the request's token belongs to.
+func (h *AuthHandler) StopImpersonation(c *gin.Context) {
+	if middleware.CurrentImpersonation(c) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "not impersonating a user"})
+		return
+	}
+
+	if err := h.auth.StopImpersonation(middleware.CurrentSessionID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
 }
@@ -0,0 +1,18 @@
+package handlers
+
+import (
+	"net/http"
+
+	"petmatch/internal/signing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKSHandler publishes the public keys other services use to verify
+// PetMatch tokens.
+func JWKSHandler(keys *signing.KeyRing) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, keys.JWKS())
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"petmatch/internal/middleware"
+	"petmatch/internal/models"
+	"petmatch/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMessagePageSize = 50
+	maxMessagePageSize     = 100
+)
+
+type MessageHandler struct {
+	messages *services.MessageService
+}
+
+type sendMessageRequest struct {
+	Body        string              `json:"body"`
+	Attachments []attachmentRequest `json:"attachments"`
+}
+
+type attachmentRequest struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+type markReadRequest struct {
+	MessageID uint `json:"messageId"`
+}
+
+func NewMessageHandler(messages *services.MessageService) *MessageHandler {
+	return &MessageHandler{messages: messages}
+}
+
+// List returns the conversation newest first; page 1 holds the latest
+// messages.
+func (h *MessageHandler) List(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	page, pageSize, ok := queryPage(c, defaultMessagePageSize, maxMessagePageSize)
+	if !ok {
+		return
+	}
+
+	conversation, err := h.messages.List(user, uint(id), (page-1)*pageSize, pageSize)
+	if err != nil {
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	messages := make([]gin.H, 0, len(conversation.Messages))
+	for _, message := range conversation.Messages {
+		messages = append(messages, messageResponse(message))
+	}
+	reads := make([]gin.H, 0, len(conversation.Reads))
+	for _, read := range conversation.Reads {
+		reads = append(reads, readResponse(read))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messages": messages,
+		"reads":    reads,
+		"page":     page,
+		"pageSize": pageSize,
+		"total":    conversation.Total,
+	})
+}
+
+func (h *MessageHandler) Send(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req sendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	attachments := make([]services.AttachmentInput, 0, len(req.Attachments))
+	for _, attachment := range req.Attachments {
+		attachments = append(attachments, services.AttachmentInput{
+			Name:        attachment.Name,
+			URL:         attachment.URL,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+		})
+	}
+
+	message, err := h.messages.Send(user, uint(id), services.SendMessageInput{
+		Body:        req.Body,
+		Attachments: attachments,
+	})
+	if err != nil {
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": messageResponse(*message)})
+}
+
+// MarkRead takes an optional messageId; without it the whole conversation is
+// marked read.
+func (h *MessageHandler) MarkRead(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req markReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	read, err := h.messages.MarkRead(user, uint(id), req.MessageID)
+	if err != nil {
+		c.JSON(messageErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"read": readResponse(*read)})
+}
+
+func (h *MessageHandler) Unread(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	unread, err := h.messages.Unread(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	requests := make([]gin.H, 0, len(unread.Requests))
+	for _, count := range unread.Requests {
+		requests = append(requests, gin.H{"requestId": count.RequestID, "unread": count.Unread})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": unread.Total, "requests": requests})
+}
+
+func messageErrorStatus(err error) int {
+	switch err {
+	case services.ErrMessageEmpty, services.ErrMessageTooLong,
+		services.ErrInvalidAttachment, services.ErrTooManyAttachments:
+		return http.StatusBadRequest
+	case services.ErrRequestNotFound, services.ErrMessageNotFound:
+		return http.StatusNotFound
+	case services.ErrConversationClosed:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func messageResponse(message models.AdoptionMessage) gin.H {
+	attachments := make([]gin.H, 0, len(message.Attachments))
+	for _, attachment := range message.Attachments {
+		attachments = append(attachments, gin.H{
+			"name":        attachment.Name,
+			"url":         attachment.URL,
+			"contentType": attachment.ContentType,
+			"size":        attachment.Size,
+		})
+	}
+	return gin.H{
+		"id":          message.ID,
+		"requestId":   message.RequestID,
+		"sender":      userSummary(message.Sender),
+		"fromShelter": message.FromShelter,
+		"body":        message.Body,
+		"attachments": attachments,
+		"createdAt":   message.CreatedAt,
+	}
+}
+
+func readResponse(read models.ConversationRead) gin.H {
+	return gin.H{
+		"user":              gin.H{"id": read.User.ID, "name": read.User.Name},
+		"lastReadMessageId": read.LastReadMessageID,
+		"readAt":            read.ReadAt,
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"petmatch/internal/repositories"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryListPage reads the paging parameters of a list: pageSize, then
+// either cursor, the next of a previous page, or page, and sort, a field
+// prefixed with "-" for descending order. It answers 400 and reports false
+// when they are not valid.
+func queryListPage(c *gin.Context, defaultSize, max int, defaultSort string) (repositories.PageRequest, bool) {
+	page, pageSize, ok := queryPage(c, defaultSize, max)
+	if !ok {
+		return repositories.PageRequest{}, false
+	}
+	cursor := c.Query("cursor")
+	if cursor != "" && c.Query("page") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "use either page or cursor"})
+		return repositories.PageRequest{}, false
+	}
+
+	sort := c.DefaultQuery("sort", defaultSort)
+	return repositories.PageRequest{
+		Sort:   strings.TrimPrefix(sort, "-"),
+		Desc:   strings.HasPrefix(sort, "-"),
+		Size:   pageSize,
+		Offset: (page - 1) * pageSize,
+		Cursor: cursor,
+	}, true
+}
+
+// pageResponse wraps a page of a list, its items under key, with the total
+// of the list and the cursor of the next page, null on the last one.
+func pageResponse(key string, items interface{}, page repositories.PageRequest, info repositories.PageInfo) gin.H {
+	var next interface{}
+	if info.Next != "" {
+		next = info.Next
+	}
+	response := gin.H{
+		key:        items,
+		"pageSize": page.Size,
+		"total":    info.Total,
+		"next":     next,
+	}
+	if page.Cursor == "" {
+		response["page"] = page.Offset/page.Size + 1
+	}
+	return response
+}
@@ -1,28 +1,40 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"petmatch/internal/images"
 	"petmatch/internal/middleware"
 	"petmatch/internal/models"
+	"petmatch/internal/repositories"
 	"petmatch/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	defaultPetPageSize = 20
+	maxPetPageSize     = 100
+)
+
 type PetHandler struct {
 	pets *services.PetService
 }
 
 type createPetRequest struct {
-	Name        string  `json:"name" binding:"required"`
-	Species     string  `json:"species" binding:"required"`
-	Breed       string  `json:"breed"`
-	Age         uint    `json:"age" binding:"required"`
-	Description string  `json:"description"`
-	Location    string  `json:"location"`
-	PhotoURL    *string `json:"photoUrl"`
+	Name        string   `json:"name" binding:"required"`
+	Species     string   `json:"species" binding:"required"`
+	Breed       string   `json:"breed"`
+	Age         uint     `json:"age" binding:"required"`
+	Description string   `json:"description"`
+	Location    string   `json:"location"`
+	PhotoURL    *string  `json:"photoUrl"`
+	Latitude    *float64 `json:"latitude"`
+	Longitude   *float64 `json:"longitude"`
 }
 
 type updatePetRequest struct {
@@ -34,6 +46,8 @@ type updatePetRequest struct {
 	Location    string           `json:"location"`
 	PhotoURL    *string          `json:"photoUrl"`
 	Status      models.PetStatus `json:"status" binding:"required"`
+	Latitude    *float64         `json:"latitude"`
+	Longitude   *float64         `json:"longitude"`
 }
 
 func NewPetHandler(pets *services.PetService) *PetHandler {
@@ -63,20 +77,51 @@ func (h *PetHandler) List(c *gin.Context) {
 		}
 	}
 
-	pets, err := h.pets.List(services.PetFilterInput{
+	var near *repositories.Point
+	if c.Query("lat") != "" || c.Query("lng") != "" {
+		lat, latErr := strconv.ParseFloat(c.Query("lat"), 64)
+		lng, lngErr := strconv.ParseFloat(c.Query("lng"), 64)
+		if latErr != nil || lngErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "lat and lng must be numbers"})
+			return
+		}
+		near = &repositories.Point{Latitude: lat, Longitude: lng}
+	}
+
+	// Searches list the best matches first unless asked otherwise.
+	query := c.Query("q")
+	defaultSort := "-created_at"
+	if strings.TrimSpace(query) != "" {
+		defaultSort = "relevance"
+	}
+	page, ok := queryListPage(c, defaultPetPageSize, maxPetPageSize, defaultSort)
+	if !ok {
+		return
+	}
+
+	pets, info, err := h.pets.List(services.PetFilterInput{
 		Species:  c.Query("species"),
 		Breed:    c.Query("breed"),
 		Location: c.Query("location"),
 		Status:   status,
 		MinAge:   minAge,
 		MaxAge:   maxAge,
-	})
+		Near:     near,
+		Query:    query,
+	}, page)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		switch err {
+		case repositories.ErrInvalidSort, repositories.ErrInvalidCursor, services.ErrDistanceOrigin, services.ErrInvalidCoordinates:
+			status = http.StatusBadRequest
+		case repositories.ErrSearchUnavailable:
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"pets": pets})
+	c.JSON(http.StatusOK, pageResponse("pets", pets, page, info))
 }
 
 func (h *PetHandler) Get(c *gin.Context) {
@@ -120,11 +165,16 @@ func (h *PetHandler) Create(c *gin.Context) {
 		Description: req.Description,
 		Location:    req.Location,
 		PhotoURL:    req.PhotoURL,
-	})
+		Latitude:    req.Latitude,
+		Longitude:   req.Longitude,
+	}, middleware.CurrentRequestMeta(c))
 	if err != nil {
 		status := http.StatusInternalServerError
-		if err == services.ErrShelterRoleRequired {
+		switch err {
+		case services.ErrShelterRoleRequired, services.ErrNotShelterMember:
 			status = http.StatusForbidden
+		case services.ErrInvalidCoordinates:
+			status = http.StatusBadRequest
 		}
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
@@ -161,16 +211,20 @@ func (h *PetHandler) Update(c *gin.Context) {
 		Location:    req.Location,
 		PhotoURL:    req.PhotoURL,
 		Status:      req.Status,
-	})
+		Latitude:    req.Latitude,
+		Longitude:   req.Longitude,
+	}, middleware.CurrentRequestMeta(c))
 	if err != nil {
 		status := http.StatusInternalServerError
 		switch err {
-		case services.ErrShelterRoleRequired:
+		case services.ErrShelterRoleRequired, services.ErrNotShelterMember:
 			status = http.StatusForbidden
 		case services.ErrPetNotFound:
 			status = http.StatusNotFound
 		case services.ErrUnauthorizedPetAccess:
 			status = http.StatusForbidden
+		case services.ErrInvalidCoordinates:
+			status = http.StatusBadRequest
 		}
 		c.JSON(status, gin.H{"error": err.Error()})
 		return
@@ -192,11 +246,11 @@ func (h *PetHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	err = h.pets.Delete(user, uint(id))
+	err = h.pets.Delete(user, uint(id), middleware.CurrentRequestMeta(c))
 	if err != nil {
 		status := http.StatusInternalServerError
 		switch err {
-		case services.ErrShelterRoleRequired:
+		case services.ErrShelterRoleRequired, services.ErrNotShelterMember:
 			status = http.StatusForbidden
 		case services.ErrPetNotFound:
 			status = http.StatusNotFound
@@ -209,3 +263,120 @@ func (h *PetHandler) Delete(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// UploadPhoto replaces the pet's photo with the image sent in the "photo"
+// field of a multipart form.
+func (h *PetHandler) UploadPhoto(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	// Leave room for the multipart framing around the file.
+	limit := h.pets.PhotoLimit()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(limit)+64<<10)
+	header, err := c.FormFile("photo")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = &services.PhotoTooLargeError{Limit: limit}
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a multipart field named photo is required"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, int64(limit)+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pet, err := h.pets.SetPhoto(user, uint(id), data, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(petPhotoErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pet": pet})
+}
+
+func (h *PetHandler) DeletePhoto(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	pet, err := h.pets.RemovePhoto(user, uint(id), middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(petPhotoErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"pet": pet})
+}
+
+// Photo serves an uploaded photo or video, or redirects to a temporary link when the
+// storage hands them out itself.
+func (h *PetHandler) Photo(c *gin.Context) {
+	object, location, err := h.pets.OpenPhoto(c.Param("key"))
+	if err != nil {
+		c.JSON(petPhotoErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	if location != "" {
+		c.Redirect(http.StatusFound, location)
+		return
+	}
+	defer object.Body.Close()
+
+	// Keys are never reused, so the file behind one never changes.
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	// Files that can seek answer range requests, which video players use.
+	if content, ok := object.Body.(io.ReadSeeker); ok {
+		c.Header("Content-Type", object.ContentType)
+		http.ServeContent(c.Writer, c.Request, "", object.ModTime, content)
+		return
+	}
+	c.DataFromReader(http.StatusOK, object.Size, object.ContentType, object.Body, nil)
+}
+
+func petPhotoErrorStatus(err error) int {
+	var tooLarge *services.PhotoTooLargeError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	switch err {
+	case images.ErrUnsupported:
+		return http.StatusUnsupportedMediaType
+	case images.ErrInvalid, images.ErrTooLarge:
+		return http.StatusBadRequest
+	case services.ErrShelterRoleRequired, services.ErrNotShelterMember, services.ErrUnauthorizedPetAccess:
+		return http.StatusForbidden
+	case services.ErrPetNotFound, services.ErrPhotoNotFound:
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"petmatch/internal/images"
+	"petmatch/internal/middleware"
+	"petmatch/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type updatePetMediaRequest struct {
+	Caption *string `json:"caption" binding:"omitempty,max=300"`
+	Cover   bool    `json:"cover"`
+}
+
+type reorderPetMediaRequest struct {
+	IDs []uint `json:"ids" binding:"required"`
+}
+
+func (h *PetHandler) Gallery(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	media, err := h.pets.Gallery(user, uint(id))
+	if err != nil {
+		c.JSON(petMediaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"media": media})
+}
+
+// AddMedia adds the photo or video sent in the "file" field of a multipart
+// form to the pet's gallery, with the optional "caption" field.
+func (h *PetHandler) AddMedia(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	// POST routes under /pets/ name the pet petId, as adoption requests do.
+	id, err := strconv.Atoi(c.Param("petId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	limit := h.pets.MediaLimit()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(limit)+64<<10)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			err = &services.MediaTooLargeError{Limit: limit}
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a multipart field named file is required"})
+		return
+	}
+	caption := c.PostForm("caption")
+	if len(caption) > 300 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "caption must be at most 300 characters"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, int64(limit)+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	media, err := h.pets.AddMedia(user, uint(id), data, caption, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(petMediaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"media": media})
+}
+
+func (h *PetHandler) UpdateMedia(c *gin.Context) {
+	var req updatePetMediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	mediaID, err := strconv.Atoi(c.Param("mediaId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid media id"})
+		return
+	}
+
+	media, err := h.pets.UpdateMedia(user, uint(id), uint(mediaID), services.UpdatePetMediaInput{
+		Caption: req.Caption,
+		Cover:   req.Cover,
+	}, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(petMediaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"media": media})
+}
+
+func (h *PetHandler) ReorderMedia(c *gin.Context) {
+	var req reorderPetMediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	media, err := h.pets.ReorderMedia(user, uint(id), req.IDs, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(petMediaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"media": media})
+}
+
+func (h *PetHandler) DeleteMedia(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	mediaID, err := strconv.Atoi(c.Param("mediaId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid media id"})
+		return
+	}
+
+	if err := h.pets.DeleteMedia(user, uint(id), uint(mediaID), middleware.CurrentRequestMeta(c)); err != nil {
+		c.JSON(petMediaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func petMediaErrorStatus(err error) int {
+	var tooLarge *services.MediaTooLargeError
+	if errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	switch err {
+	case services.ErrPetMediaUnsupported:
+		return http.StatusUnsupportedMediaType
+	case images.ErrInvalid, images.ErrTooLarge, services.ErrPetMediaCoverVideo, services.ErrPetMediaInvalidOrder:
+		return http.StatusBadRequest
+	case services.ErrPetMediaNotFound:
+		return http.StatusNotFound
+	default:
+		return petPhotoErrorStatus(err)
+	}
+}
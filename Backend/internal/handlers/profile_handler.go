@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"net/http"
+
+	"petmatch/internal/middleware"
+	"petmatch/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type updateProfileRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=2"`
+	Phone       *string `json:"phone"`
+	City        *string `json:"city"`
+	ShelterName *string `json:"shelterName"`
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required,min=6"`
+}
+
+type changeEmailRequest struct {
+	Email           string `json:"email" binding:"required,email"`
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+}
+
+func (h *AuthHandler) UpdateProfile(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req updateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updated, err := h.accounts.UpdateProfile(user, services.UpdateProfileInput{
+		Name:        req.Name,
+		Phone:       req.Phone,
+		City:        req.City,
+		ShelterName: req.ShelterName,
+	}, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == services.ErrShelterNameNotAllowed {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": userResponse(*updated)})
+}
+
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req changePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.accounts.ChangePassword(user, middleware.CurrentSessionID(c), req.CurrentPassword, req.NewPassword,
+		middleware.CurrentRequestMeta(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err == services.ErrInvalidCurrentPassword {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Contraseña actualizada. Se cerraron las demás sesiones."})
+}
+
+func (h *AuthHandler) RequestEmailChange(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req changeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accounts.RequestEmailChange(user, req.Email, req.CurrentPassword); err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case services.ErrInvalidCurrentPassword, services.ErrSameEmail, services.ErrEmailInUse:
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Te enviamos un enlace al nuevo correo para confirmar el cambio.",
+	})
+}
+
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token is required"})
+		return
+	}
+
+	user, err := h.accounts.ConfirmEmailChange(token, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch err {
+		case services.ErrInvalidEmailChangeToken, services.ErrEmailInUse:
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Correo actualizado.",
+		"user":    userResponse(*user),
+	})
+}
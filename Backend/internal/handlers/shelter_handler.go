@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"petmatch/internal/middleware"
+	"petmatch/internal/models"
+	"petmatch/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ShelterHandler struct {
+	shelters *services.ShelterService
+}
+
+type updateShelterRequest struct {
+	Name  *string `json:"name" binding:"omitempty,min=2"`
+	Phone *string `json:"phone"`
+	City  *string `json:"city"`
+}
+
+type inviteMemberRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required"`
+}
+
+type changeMemberRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type acceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type registerMemberRequest struct {
+	Token    string  `json:"token" binding:"required"`
+	Name     string  `json:"name" binding:"required,min=2"`
+	Password string  `json:"password" binding:"required,min=6"`
+	Phone    *string `json:"phone"`
+	City     *string `json:"city"`
+}
+
+func NewShelterHandler(shelters *services.ShelterService) *ShelterHandler {
+	return &ShelterHandler{shelters: shelters}
+}
+
+// Get returns the caller's shelter with its members and, for managers and
+// owners, the pending invitations.
+func (h *ShelterHandler) Get(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	details, err := h.shelters.Mine(user)
+	if err != nil {
+		c.JSON(shelterErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	members := make([]gin.H, 0, len(details.Members))
+	for _, member := range details.Members {
+		members = append(members, memberResponse(member))
+	}
+
+	invitations := make([]gin.H, 0, len(details.Invitations))
+	for _, invitation := range details.Invitations {
+		invitations = append(invitations, invitationResponse(invitation))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"shelter":     shelterResponse(details.Shelter),
+		"role":        details.Role,
+		"members":     members,
+		"invitations": invitations,
+	})
+}
+
+func (h *ShelterHandler) Update(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req updateShelterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	shelter, err := h.shelters.Update(user, services.UpdateShelterInput{
+		Name:  req.Name,
+		Phone: req.Phone,
+		City:  req.City,
+	}, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(shelterErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"shelter": shelterResponse(*shelter)})
+}
+
+func (h *ShelterHandler) Invite(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req inviteMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := services.ParseShelterRole(req.Role)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := h.shelters.Invite(user, services.InviteMemberInput{
+		Email: req.Email,
+		Role:  role,
+	}, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(shelterErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"invitation": invitationResponse(*invitation)})
+}
+
+func (h *ShelterHandler) RevokeInvitation(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.shelters.RevokeInvitation(user, uint(id), middleware.CurrentRequestMeta(c)); err != nil {
+		c.JSON(shelterErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *ShelterHandler) ChangeMemberRole(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	var req changeMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, err := services.ParseShelterRole(req.Role)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := h.shelters.ChangeMemberRole(user, uint(userID), role, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(shelterErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"member": memberResponse(*member)})
+}
+
+func (h *ShelterHandler) RemoveMember(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid user id"})
+		return
+	}
+
+	if err := h.shelters.RemoveMember(user, uint(userID), middleware.CurrentRequestMeta(c)); err != nil {
+		c.JSON(shelterErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AcceptInvitation adds the signed-in user to the inviting shelter.
+func (h *ShelterHandler) AcceptInvitation(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req acceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := h.shelters.AcceptInvitation(user, req.Token, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(shelterErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"shelter": shelterResponse(member.Shelter),
+		"role":    member.Role,
+		"user":    userResponse(*user),
+	})
+}
+
+// RegisterMember creates an account for an invitee who does not have one.
+func (h *ShelterHandler) RegisterMember(c *gin.Context) {
+	var req registerMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.shelters.RegisterMember(services.RegisterMemberInput{
+		Token:    req.Token,
+		Name:     req.Name,
+		Password: req.Password,
+		Phone:    req.Phone,
+		City:     req.City,
+	}, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(shelterErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Te uniste al refugio. Ya puedes iniciar sesión.",
+		"user":    userResponse(*user),
+	})
+}
+
+func shelterErrorStatus(err error) int {
+	switch err {
+	case services.ErrNotShelterMember, services.ErrShelterRoleForbidden,
+		services.ErrShelterNotApproved, services.ErrInvitationEmailMismatch:
+		return http.StatusForbidden
+	case services.ErrShelterMemberNotFound, services.ErrInvitationNotFound:
+		return http.StatusNotFound
+	case services.ErrInvalidInvitation, services.ErrInvalidShelterRole:
+		return http.StatusBadRequest
+	case services.ErrLastShelterOwner, services.ErrAlreadyShelterMember, services.ErrInvitationNeedsLogin:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func shelterResponse(shelter models.Shelter) gin.H {
+	return gin.H{
+		"id":         shelter.ID,
+		"name":       shelter.Name,
+		"phone":      shelter.Phone,
+		"city":       shelter.City,
+		"isApproved": shelter.IsApproved,
+		"createdAt":  shelter.CreatedAt,
+	}
+}
+
+func memberResponse(member models.ShelterMember) gin.H {
+	return gin.H{
+		"userId":   member.UserID,
+		"name":     member.User.Name,
+		"email":    member.User.Email,
+		"role":     member.Role,
+		"joinedAt": member.CreatedAt,
+	}
+}
+
+func invitationResponse(invitation models.ShelterInvitation) gin.H {
+	return gin.H{
+		"id":        invitation.ID,
+		"email":     invitation.Email,
+		"role":      invitation.Role,
+		"expiresAt": invitation.ExpiresAt,
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"net/http"
+
+	"petmatch/internal/middleware"
+	"petmatch/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type twoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type twoFactorEnrollmentRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req twoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.auth.CompleteTwoFactorLogin(req.ChallengeToken, req.Code, c.ClientIP())
+	if err != nil {
+		if respondThrottled(c, err) || respondAccountStatus(c, err) {
+			return
+		}
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessionResponse(result))
+}
+
+func (h *AuthHandler) BeginTwoFactorEnrollment(c *gin.Context) {
+	var req twoFactorEnrollmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setup, err := h.auth.BeginTwoFactorEnrollment(req.ChallengeToken)
+	if err != nil {
+		if respondAccountStatus(c, err) {
+			return
+		}
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":     setup.Secret,
+		"otpauthUri": setup.URI,
+	})
+}
+
+func (h *AuthHandler) ConfirmTwoFactorEnrollment(c *gin.Context) {
+	var req twoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.auth.ConfirmTwoFactorEnrollment(req.ChallengeToken, req.Code)
+	if err != nil {
+		if respondAccountStatus(c, err) {
+			return
+		}
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	response := sessionResponse(result.Session)
+	response["recoveryCodes"] = result.RecoveryCodes
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *AuthHandler) BeginTwoFactorSetup(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	setup, err := h.auth.BeginTwoFactorSetup(user)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":     setup.Secret,
+		"otpauthUri": setup.URI,
+	})
+}
+
+func (h *AuthHandler) ConfirmTwoFactorSetup(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.auth.ConfirmTwoFactorSetup(user, req.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.auth.DisableTwoFactor(user, req.Code, middleware.CurrentRequestMeta(c)); err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req twoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.auth.RegenerateRecoveryCodes(user, req.Code, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+func twoFactorErrorStatus(err error) int {
+	switch err {
+	case services.ErrInvalidChallenge, services.ErrInvalidTwoFactorCode:
+		return http.StatusUnauthorized
+	case services.ErrTwoFactorAlreadyEnabled, services.ErrTwoFactorNotEnabled, services.ErrTwoFactorSetupMissing:
+		return http.StatusConflict
+	case services.ErrTwoFactorRequired:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"petmatch/internal/ical"
+	"petmatch/internal/middleware"
+	"petmatch/internal/models"
+	"petmatch/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type VisitHandler struct {
+	visits *services.VisitService
+}
+
+type visitSlotRequest struct {
+	StartsAt time.Time `json:"startsAt" binding:"required"`
+	EndsAt   time.Time `json:"endsAt" binding:"required"`
+	Location string    `json:"location"`
+}
+
+type bookVisitRequest struct {
+	SlotID uint `json:"slotId" binding:"required"`
+}
+
+func NewVisitHandler(visits *services.VisitService) *VisitHandler {
+	return &VisitHandler{visits: visits}
+}
+
+// ListSlots returns the upcoming slots of the user's shelter and who booked
+// them.
+func (h *VisitHandler) ListSlots(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	slots, err := h.visits.ListSlots(user)
+	if err != nil {
+		c.JSON(visitErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(slots))
+	for _, slot := range slots {
+		item := visitSlotResponse(slot.Slot)
+		item["booking"] = nil
+		if booking := slot.Booking; booking != nil {
+			item["booking"] = gin.H{
+				"id":        booking.ID,
+				"requestId": booking.RequestID,
+				"pet":       gin.H{"id": booking.Request.Pet.ID, "name": booking.Request.Pet.Name},
+				"adopter":   gin.H{"id": booking.Request.Adopter.ID, "name": booking.Request.Adopter.Name},
+				"bookedAt":  booking.CreatedAt,
+			}
+		}
+		response = append(response, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"slots": response})
+}
+
+func (h *VisitHandler) CreateSlot(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	var req visitSlotRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	slot, err := h.visits.CreateSlot(user, services.VisitSlotInput{
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+		Location: req.Location,
+	}, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(visitErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"slot": visitSlotResponse(*slot)})
+}
+
+func (h *VisitHandler) DeleteSlot(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.visits.DeleteSlot(user, uint(id), middleware.CurrentRequestMeta(c)); err != nil {
+		c.JSON(visitErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AvailableSlots lists the slots the adopter of the request can book.
+func (h *VisitHandler) AvailableSlots(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	slots, err := h.visits.AvailableSlots(user, uint(id))
+	if err != nil {
+		c.JSON(visitErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	response := make([]gin.H, 0, len(slots))
+	for _, slot := range slots {
+		response = append(response, visitSlotResponse(slot))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"slots": response})
+}
+
+func (h *VisitHandler) Get(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	booking, err := h.visits.Get(user, uint(id))
+	if err != nil {
+		c.JSON(visitErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"visit": visitResponse(*booking)})
+}
+
+func (h *VisitHandler) Book(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req bookVisitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	booking, err := h.visits.Book(user, uint(id), req.SlotID, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(visitErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"visit": visitResponse(*booking)})
+}
+
+func (h *VisitHandler) Reschedule(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	var req bookVisitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	booking, err := h.visits.Reschedule(user, uint(id), req.SlotID, middleware.CurrentRequestMeta(c))
+	if err != nil {
+		c.JSON(visitErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"visit": visitResponse(*booking)})
+}
+
+func (h *VisitHandler) Cancel(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	if err := h.visits.Cancel(user, uint(id), middleware.CurrentRequestMeta(c)); err != nil {
+		c.JSON(visitErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Calendar downloads the request's booked visit as an .ics file.
+func (h *VisitHandler) Calendar(c *gin.Context) {
+	user := middleware.CurrentUser(c)
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+
+	calendar, err := h.visits.Calendar(user, uint(id))
+	if err != nil {
+		c.JSON(visitErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="visita-%d.ics"`, id))
+	c.Data(http.StatusOK, ical.ContentType, calendar)
+}
+
+func visitErrorStatus(err error) int {
+	switch err {
+	case services.ErrVisitSlotTime, services.ErrVisitSlotLocation:
+		return http.StatusBadRequest
+	case services.ErrPermissionDenied:
+		return http.StatusForbidden
+	case services.ErrRequestNotFound, services.ErrVisitSlotNotFound, services.ErrVisitNotFound:
+		return http.StatusNotFound
+	case services.ErrVisitSlotBooked, services.ErrVisitAlreadyBooked,
+		services.ErrVisitRequestClosed, services.ErrVisitStarted:
+		return http.StatusConflict
+	default:
+		return shelterErrorStatus(err)
+	}
+}
+
+func visitSlotResponse(slot models.VisitSlot) gin.H {
+	return gin.H{
+		"id":       slot.ID,
+		"startsAt": slot.StartsAt,
+		"endsAt":   slot.EndsAt,
+		"location": slot.Location,
+		"booked":   slot.BookingID != nil,
+	}
+}
+
+func visitResponse(booking models.VisitBooking) gin.H {
+	return gin.H{
+		"id":        booking.ID,
+		"requestId": booking.RequestID,
+		"status":    booking.Status,
+		"slot":      visitSlotResponse(booking.Slot),
+		"sequence":  booking.Sequence,
+		"createdAt": booking.CreatedAt,
+		"updatedAt": booking.UpdatedAt,
+	}
+}
@@ -0,0 +1,100 @@
+// Package ical writes RFC 5545 iCalendar files with a single event, enough
+// for calendar apps to add, update or remove a meeting.
+package ical
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const ContentType = "text/calendar; charset=utf-8"
+
+// Method tells the calendar app what to do with the event, as defined by
+// iTIP (RFC 5546).
+type Method string
+
+const (
+	MethodPublish Method = "PUBLISH"
+	MethodCancel  Method = "CANCEL"
+)
+
+// Event is a meeting. Calendar apps recognise updates of an event by its UID
+// and apply the one with the highest Sequence.
+type Event struct {
+	UID         string
+	Sequence    int
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	Stamp       time.Time
+}
+
+// Calendar renders a VCALENDAR holding event. With MethodCancel the event
+// is marked cancelled.
+func Calendar(method Method, event Event) []byte {
+	var buf bytes.Buffer
+	line := func(name, value string) {
+		fold(&buf, name+":"+value)
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//PetMatch//Visits//ES")
+	line("CALSCALE", "GREGORIAN")
+	line("METHOD", string(method))
+	line("BEGIN", "VEVENT")
+	line("UID", event.UID)
+	line("SEQUENCE", strconv.Itoa(event.Sequence))
+	line("DTSTAMP", utc(event.Stamp))
+	line("DTSTART", utc(event.Start))
+	line("DTEND", utc(event.End))
+	line("SUMMARY", escape(event.Summary))
+	if event.Description != "" {
+		line("DESCRIPTION", escape(event.Description))
+	}
+	if event.Location != "" {
+		line("LOCATION", escape(event.Location))
+	}
+	if method == MethodCancel {
+		line("STATUS", "CANCELLED")
+	} else {
+		line("STATUS", "CONFIRMED")
+	}
+	line("END", "VEVENT")
+	line("END", "VCALENDAR")
+	return buf.Bytes()
+}
+
+func utc(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// escape quotes the characters with a meaning in TEXT values.
+func escape(text string) string {
+	return escaper.Replace(text)
+}
+
+// fold writes a content line, breaking it every 75 octets without splitting
+// a UTF-8 sequence. Continuation lines start with a space.
+func fold(buf *bytes.Buffer, content string) {
+	limit := 75
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		buf.WriteString(content[:cut])
+		buf.WriteString("\r\n ")
+		content = content[cut:]
+		limit = 74
+	}
+	buf.WriteString(content)
+	buf.WriteString("\r\n")
+}
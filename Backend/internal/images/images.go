@@ -0,0 +1,153 @@
+// Package images checks uploaded pictures and removes the metadata cameras
+// and phones embed in them, such as the GPS position of an EXIF block.
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+
+	// MaxPixels bounds the size of the decoded image, so a small file cannot
+	// expand into gigabytes of memory.
+	MaxPixels = 40_000_000
+
+	jpegQuality = 90
+)
+
+var (
+	ErrUnsupported = errors.New("only JPEG and PNG images are accepted")
+	ErrInvalid     = errors.New("the file is not a valid image")
+	ErrTooLarge    = errors.New("the image has too many pixels")
+)
+
+// Image is an uploaded picture ready to be stored.
+type Image struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+	Width       int
+	Height      int
+}
+
+// Prepare identifies the picture by its content, not by the name or type the
+// client sent, and strips its metadata. JPEGs are re-encoded, with the EXIF
+// orientation applied to the pixels so the picture still shows upright.
+// PNGs keep their pixels and lose their text and EXIF chunks.
+func Prepare(data []byte) (*Image, error) {
+	switch http.DetectContentType(data) {
+	case JPEG:
+		return prepareJPEG(data)
+	case PNG:
+		return preparePNG(data)
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+func prepareJPEG(data []byte) (*Image, error) {
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	img = orient(img, jpegOrientation(data))
+
+	encoded, err := EncodeJPEG(img)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	return &Image{
+		Data:        encoded,
+		ContentType: JPEG,
+		Extension:   ".jpg",
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+	}, nil
+}
+
+func preparePNG(data []byte) (*Image, error) {
+	config, err := png.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	stripped, err := stripPNG(data)
+	if err != nil {
+		return nil, err
+	}
+	// Decoding catches files whose header is fine but whose pixels are not.
+	if _, err := png.Decode(bytes.NewReader(stripped)); err != nil {
+		return nil, ErrInvalid
+	}
+	return &Image{
+		Data:        stripped,
+		ContentType: PNG,
+		Extension:   ".png",
+		Width:       config.Width,
+		Height:      config.Height,
+	}, nil
+}
+
+// pngMetadataChunks are the ancillary chunks that can carry text, EXIF data
+// or a timestamp.
+var pngMetadataChunks = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+// stripPNG copies the PNG without its metadata chunks, checking the CRC of
+// every chunk on the way.
+func stripPNG(data []byte) ([]byte, error) {
+	const signature = 8
+	if len(data) < signature {
+		return nil, ErrInvalid
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:signature])
+	for rest := data[signature:]; len(rest) > 0; {
+		if len(rest) < 12 {
+			return nil, ErrInvalid
+		}
+		length := binary.BigEndian.Uint32(rest[:4])
+		if uint64(length)+12 > uint64(len(rest)) {
+			return nil, ErrInvalid
+		}
+		chunk := rest[:12+length]
+		kind := string(chunk[4:8])
+		if crc32.ChecksumIEEE(chunk[4:8+length]) != binary.BigEndian.Uint32(chunk[8+length:]) {
+			return nil, ErrInvalid
+		}
+		if !pngMetadataChunks[kind] {
+			out.Write(chunk)
+		}
+		rest = rest[12+length:]
+		if kind == "IEND" {
+			break
+		}
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,120 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// testPNG encodes a small picture whose IHDR chunk is followed by extra.
+func testPNG(t *testing.T, extra ...[]byte) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(1, 1, color.RGBA{R: 200, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	// The signature is 8 bytes and IHDR 25 with its length, type and CRC.
+	data := buf.Bytes()
+	out := append([]byte{}, data[:33]...)
+	for _, c := range extra {
+		out = append(out, c...)
+	}
+	return append(out, data[33:]...)
+}
+
+func pngChunk(kind string, data []byte) []byte {
+	chunk := make([]byte, 0, 12+len(data))
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestStripPNG(t *testing.T) {
+	text := pngChunk("tEXt", []byte("Comment\x00taken at home"))
+	itxt := pngChunk("iTXt", []byte("Author\x00\x00\x00\x00\x00Ana"))
+	ztxt := pngChunk("zTXt", []byte("Place\x00\x00x\x9c\x03\x00\x00\x00\x00\x01"))
+	exif := pngChunk("eXIf", []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x00"))
+	stamp := pngChunk("tIME", []byte{0x07, 0xe8, 3, 9, 17, 4, 5})
+	gamma := pngChunk("gAMA", []byte{0, 0, 0xb1, 0x8f})
+
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte
+	}{
+		{"no metadata", testPNG(t), testPNG(t)},
+		{"text chunks", testPNG(t, text, itxt, ztxt), testPNG(t)},
+		{"exif and time", testPNG(t, exif, stamp), testPNG(t)},
+		{"keeps other ancillary chunks", testPNG(t, text, gamma, exif), testPNG(t, gamma)},
+		{"drops bytes after IEND", append(testPNG(t, text), "trailing"...), testPNG(t)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := stripPNG(tt.in)
+			if err != nil {
+				t.Fatalf("stripPNG: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("stripPNG kept %d bytes, want %d", len(got), len(tt.want))
+			}
+			if _, err := png.Decode(bytes.NewReader(got)); err != nil {
+				t.Fatalf("stripped PNG does not decode: %v", err)
+			}
+		})
+	}
+}
+
+func TestStripPNGRejectsDamagedFiles(t *testing.T) {
+	valid := testPNG(t, pngChunk("tEXt", []byte("Comment\x00hi")))
+	badCRC := append([]byte{}, valid...)
+	badCRC[len(badCRC)-1] ^= 0xff
+	hugeLength := append([]byte{}, valid...)
+	binary.BigEndian.PutUint32(hugeLength[33:], 1<<30)
+
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"shorter than the signature", valid[:5]},
+		{"truncated chunk header", valid[:40]},
+		{"truncated chunk data", valid[:len(valid)-6]},
+		{"bad CRC", badCRC},
+		{"length past the end", hugeLength},
+	}
+
+	for _, tt := range tests {
+		if _, err := stripPNG(tt.in); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: error = %v, want ErrInvalid", tt.name, err)
+		}
+	}
+}
+
+func TestPreparePNG(t *testing.T) {
+	img, err := Prepare(testPNG(t, pngChunk("eXIf", []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x00"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.ContentType != PNG || img.Extension != ".png" || img.Width != 3 || img.Height != 2 {
+		t.Errorf("Prepare = %s %s %dx%d, want image/png .png 3x2", img.ContentType, img.Extension, img.Width, img.Height)
+	}
+	if bytes.Contains(img.Data, []byte("eXIf")) {
+		t.Error("the EXIF chunk was kept")
+	}
+}
+
+func TestPrepareRejectsOtherTypes(t *testing.T) {
+	if _, err := Prepare([]byte("GIF89a not really")); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("error = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,165 @@
+// Package lockout throttles repeated failed logins per account and per
+// client IP.
+package lockout
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	KindAccount = "account"
+	KindIP      = "ip"
+
+	maxLockout = 24 * time.Hour
+)
+
+// Policy describes how one kind of key is throttled. After DelayAfter
+// failures each new attempt must wait BaseDelay, doubled per further failure
+// up to MaxDelay. Once MaxAttempts have failed inside Window, the next
+// attempt locks the key for LockoutDuration, doubled for every consecutive
+// lockout.
+type Policy struct {
+	MaxAttempts     int
+	Window          time.Duration
+	LockoutDuration time.Duration
+	DelayAfter      int
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+}
+
+type Guard struct {
+	store   Store
+	account Policy
+	ip      Policy
+}
+
+func NewGuard(store Store, account, ip Policy) *Guard {
+	return &Guard{store: store, account: account, ip: ip}
+}
+
+func Key(kind, value string) string {
+	return kind + ":" + strings.ToLower(strings.TrimSpace(value))
+}
+
+// Attempt reserves an attempt against both the account and the IP before
+// the credentials are checked, so that a burst of concurrent guesses is
+// counted as the guesses start rather than as they fail. It returns how long
+// the caller must wait instead, or zero when the attempt may proceed. Every
+// reserved attempt counts as failed unless Release gives it back.
+func (g *Guard) Attempt(email, ip string, now time.Time) (time.Duration, error) {
+	accountKey := Key(KindAccount, email)
+	wait, err := g.reserve(accountKey, g.account, now)
+	if err != nil || wait > 0 || ip == "" {
+		return wait, err
+	}
+
+	wait, err = g.reserve(Key(KindIP, ip), g.ip, now)
+	if err != nil || wait > 0 {
+		if releaseErr := g.release(accountKey); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}
+	return wait, err
+}
+
+// Release gives back an attempt reserved by Attempt whose credentials turned
+// out to be valid.
+func (g *Guard) Release(email, ip string) error {
+	if err := g.release(Key(KindAccount, email)); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+	return g.release(Key(KindIP, ip))
+}
+
+// Succeed clears the account state. The IP state is kept on purpose: a
+// single valid login must not reset the counter of an address that is
+// spraying passwords across many accounts.
+func (g *Guard) Succeed(email string) error {
+	return g.store.Delete(Key(KindAccount, email))
+}
+
+func (g *Guard) Clear(kind, value string) error {
+	return g.store.Delete(Key(kind, value))
+}
+
+// Entry returns the failed-attempt state of an account (by email) or of a
+// client IP, if there is any.
+func (g *Guard) Entry(kind, value string) (Entry, bool, error) {
+	return g.store.Get(Key(kind, value))
+}
+
+func (g *Guard) Entries() ([]Entry, error) {
+	return g.store.List()
+}
+
+// reserve counts an attempt against key in a single update, unless the key
+// is locked or must wait. The attempt after MaxAttempts failures inside
+// Window locks the key and is turned away.
+func (g *Guard) reserve(key string, policy Policy, now time.Time) (time.Duration, error) {
+	var wait time.Duration
+	_, err := g.store.Update(key, func(entry *Entry) {
+		if now.Before(entry.LockedUntil) {
+			wait = entry.LockedUntil.Sub(now)
+			return
+		}
+		if entry.Failures == 0 || now.Sub(entry.FirstFailure) > policy.Window {
+			entry.Failures = 0
+			entry.FirstFailure = now
+		}
+		if entry.Failures >= policy.MaxAttempts {
+			entry.Lockouts++
+			entry.LockedUntil = now.Add(policy.lockout(entry.Lockouts))
+			entry.Failures = 0
+			wait = entry.LockedUntil.Sub(now)
+			return
+		}
+		if delay := policy.delay(entry.Failures); delay > 0 {
+			if next := entry.LastFailure.Add(delay); now.Before(next) {
+				wait = next.Sub(now)
+				return
+			}
+		}
+
+		entry.Failures++
+		entry.LastFailure = now
+	})
+	return wait, err
+}
+
+func (g *Guard) release(key string) error {
+	_, err := g.store.Update(key, func(entry *Entry) {
+		if entry.Failures > 0 {
+			entry.Failures--
+		}
+	})
+	return err
+}
+
+func (p Policy) delay(failures int) time.Duration {
+	if p.BaseDelay <= 0 || failures < p.DelayAfter {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.DelayAfter; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+func (p Policy) lockout(count int) time.Duration {
+	duration := p.LockoutDuration
+	for i := 1; i < count && duration < maxLockout; i++ {
+		duration *= 2
+	}
+	if duration > maxLockout {
+		duration = maxLockout
+	}
+	return duration
+}
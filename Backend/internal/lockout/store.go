@@ -0,0 +1,110 @@
+package lockout
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry is the failed-attempt state tracked for one key, for example an
+// account email or a client IP. Failures includes the attempts still being
+// checked.
+type Entry struct {
+	Key          string    `json:"key"`
+	Failures     int       `json:"failures"`
+	Lockouts     int       `json:"lockouts"`
+	FirstFailure time.Time `json:"firstFailure"`
+	LastFailure  time.Time `json:"lastFailure"`
+	LockedUntil  time.Time `json:"lockedUntil"`
+}
+
+// Store keeps failed-attempt entries. Update must apply fn atomically so a
+// shared implementation (Redis, a database table) can replace MemoryStore
+// without changing the Guard.
+type Store interface {
+	Get(key string) (Entry, bool, error)
+	Update(key string, fn func(entry *Entry)) (Entry, error)
+	Delete(key string) error
+	List() ([]Entry, error)
+}
+
+// MemoryStore is an in-process Store. Entries are dropped once they are
+// older than the retention period.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*Entry
+	retention time.Duration
+	writes    int
+}
+
+func NewMemoryStore(retention time.Duration) *MemoryStore {
+	return &MemoryStore{
+		entries:   make(map[string]*Entry),
+		retention: retention,
+	}
+}
+
+func (m *MemoryStore) Get(key string) (Entry, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.entries[key]
+	if !ok || m.expired(entry, time.Now()) {
+		return Entry{}, false, nil
+	}
+	return *entry, true, nil
+}
+
+func (m *MemoryStore) Update(key string, fn func(entry *Entry)) (Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := m.entries[key]
+	if !ok || m.expired(entry, now) {
+		entry = &Entry{Key: key}
+		m.entries[key] = entry
+	}
+	fn(entry)
+
+	m.writes++
+	if m.writes%1000 == 0 {
+		m.prune(now)
+	}
+	return *entry, nil
+}
+
+func (m *MemoryStore) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+func (m *MemoryStore) List() ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune(time.Now())
+	entries := make([]Entry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastFailure.After(entries[j].LastFailure)
+	})
+	return entries, nil
+}
+
+func (m *MemoryStore) expired(entry *Entry, now time.Time) bool {
+	return now.After(entry.LockedUntil) && now.Sub(entry.LastFailure) > m.retention
+}
+
+func (m *MemoryStore) prune(now time.Time) {
+	for key, entry := range m.entries {
+		if m.expired(entry, now) {
+			delete(m.entries, key)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// LogMailer writes every message to a writer instead of delivering it. It is
+// meant for local development and tests, where links in the mail can be
+// copied straight from the output.
+type LogMailer struct {
+	mu   sync.Mutex
+	out  io.Writer
+	from string
+}
+
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{out: log.Writer(), from: from}
+}
+
+// NewFileMailer appends rendered messages to the file at path.
+func NewFileMailer(path, from string) (*LogMailer, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &LogMailer{out: file, from: from}, nil
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.out.Write(render(m.from, msg)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(m.out, "\r\n")
+	return err
+}
@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"fmt"
+	"strings"
+
+	"petmatch/internal/config"
+)
+
+// Message is a plain-text email addressed to a single recipient, optionally
+// with attached files.
+type Message struct {
+	To          string
+	Subject     string
+	Body        string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent along with a message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New builds the mailer selected by PETMATCH_MAIL_DRIVER.
+func New(cfg config.Config) (Mailer, error) {
+	switch strings.ToLower(cfg.MailDriver) {
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "file":
+		return NewFileMailer(cfg.MailFilePath, cfg.MailFrom)
+	case "log", "":
+		return NewLogMailer(cfg.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver %q", cfg.MailDriver)
+	}
+}
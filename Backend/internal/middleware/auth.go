@@ -1,9 +1,11 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
+	"petmatch/internal/authz"
 	"petmatch/internal/models"
 	"petmatch/internal/services"
 
@@ -11,11 +13,24 @@ import (
 )
 
 const (
-	userContextKey = "currentUser"
+	userContextKey          = "currentUser"
+	sessionContextKey       = "currentSession"
+	apiKeyContextKey        = "currentAPIKey"
+	impersonationContextKey = "currentImpersonation"
+	apiKeyHeader            = "X-API-Key"
 )
 
-func Authentication(auth *services.AuthService) gin.HandlerFunc {
+// Authentication accepts a bearer access token from an interactive login or
+// a shelter API key, sent either as a bearer token or in the X-API-Key
+// header. Requests made with an impersonation token are recorded once they
+// complete, whatever their outcome.
+func Authentication(auth *services.AuthService, apiKeys *services.APIKeyService) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if raw := c.GetHeader(apiKeyHeader); raw != "" {
+			authenticateAPIKey(c, apiKeys, raw)
+			return
+		}
+
 		header := c.GetHeader("Authorization")
 		if header == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization header required"})
@@ -28,33 +43,82 @@ func Authentication(auth *services.AuthService) gin.HandlerFunc {
 			return
 		}
 
-		user, err := auth.ParseToken(parts[1])
+		if strings.HasPrefix(parts[1], services.APIKeyPrefix) {
+			authenticateAPIKey(c, apiKeys, parts[1])
+			return
+		}
+
+		access, err := auth.ParseAccessToken(parts[1])
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			return
 		}
 
-		c.Set(userContextKey, user)
+		c.Set(userContextKey, access.User)
+		c.Set(sessionContextKey, access.SessionID)
+		if access.Impersonation == nil {
+			c.Next()
+			return
+		}
+
+		c.Set(impersonationContextKey, access.Impersonation)
+		c.Next()
+		if err := auth.RecordImpersonatedRequest(access.Impersonation, c.Request.Method, c.Request.URL.Path, c.Writer.Status(), c.ClientIP()); err != nil {
+			log.Printf("failed to record request of impersonation %d: %v", access.Impersonation.ID, err)
+		}
+	}
+}
+
+func authenticateAPIKey(c *gin.Context, apiKeys *services.APIKeyService, raw string) {
+	principal, err := apiKeys.Authenticate(raw)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid api key"})
+		return
+	}
+
+	c.Set(userContextKey, principal.User)
+	c.Set(apiKeyContextKey, principal.Key)
+	c.Next()
+}
+
+// RequireSession rejects API keys on routes meant for people, such as
+// account settings or shelter membership management.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentAPIKey(c) != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "api keys cannot use this endpoint"})
+			return
+		}
 		c.Next()
 	}
 }
 
-func RequireRoles(roles ...models.UserRole) gin.HandlerFunc {
+// RejectImpersonation keeps admins impersonating a user away from actions
+// that only the user may take, such as changing credentials.
+func RejectImpersonation() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		value, exists := c.Get(userContextKey)
-		if !exists {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		if CurrentImpersonation(c) != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed while impersonating a user"})
 			return
 		}
+		c.Next()
+	}
+}
 
-		user, ok := value.(*models.User)
-		if !ok || user == nil {
+// RequirePermission lets the request through when the current user holds any
+// of the given permissions. Requests made with an API key also need the
+// permission among the key's scopes.
+func RequirePermission(authorizer *authz.Authorizer, permissions ...authz.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
 			return
 		}
 
-		for _, role := range roles {
-			if user.Role == role {
+		key := CurrentAPIKey(c)
+		for _, permission := range permissions {
+			if authorizer.Can(user, permission) && (key == nil || key.HasScope(string(permission))) {
 				c.Next()
 				return
 			}
@@ -75,3 +139,37 @@ func CurrentUser(c *gin.Context) *models.User {
 	}
 	return user
 }
+
+// CurrentSessionID returns the session the request's access token belongs
+// to, or an empty string.
+func CurrentSessionID(c *gin.Context) string {
+	return c.GetString(sessionContextKey)
+}
+
+// CurrentAPIKey returns the API key that authenticated the request, or nil
+// for interactive sessions.
+func CurrentAPIKey(c *gin.Context) *models.APIKey {
+	value, exists := c.Get(apiKeyContextKey)
+	if !exists {
+		return nil
+	}
+	key, ok := value.(*models.APIKey)
+	if !ok {
+		return nil
+	}
+	return key
+}
+
+// CurrentImpersonation returns the impersonation the request is made under,
+// or nil when the user is acting as themselves.
+func CurrentImpersonation(c *gin.Context) *models.Impersonation {
+	value, exists := c.Get(impersonationContextKey)
+	if !exists {
+		return nil
+	}
+	impersonation, ok := value.(*models.Impersonation)
+	if !ok {
+		return nil
+	}
+	return impersonation
+}
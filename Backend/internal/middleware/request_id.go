@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"petmatch/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestIDContextKey = "requestID"
+	requestIDHeader     = "X-Request-ID"
+)
+
+// validRequestID limits the ids accepted from clients or proxies to
+// something safe to log and store.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// RequestID tags every request with an id, taken from the X-Request-ID
+// header when the caller sent a usable one, and echoes it in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Set(requestIDContextKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+func CurrentRequestID(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
+
+// CurrentRequestMeta describes the request for the audit log.
+func CurrentRequestMeta(c *gin.Context) services.RequestMeta {
+	meta := services.RequestMeta{
+		IP:        c.ClientIP(),
+		RequestID: CurrentRequestID(c),
+	}
+	if impersonation := CurrentImpersonation(c); impersonation != nil {
+		meta.ImpersonatorID = &impersonation.ImpersonatorID
+	}
+	if key := CurrentAPIKey(c); key != nil {
+		meta.APIKey = key
+	}
+	return meta
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(buf)
+}
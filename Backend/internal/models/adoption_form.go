@@ -0,0 +1,97 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type FormFieldType string
+
+const (
+	FormFieldText        FormFieldType = "text"
+	FormFieldLongText    FormFieldType = "long_text"
+	FormFieldNumber      FormFieldType = "number"
+	FormFieldBoolean     FormFieldType = "boolean"
+	FormFieldDate        FormFieldType = "date"
+	FormFieldSelect      FormFieldType = "select"
+	FormFieldMultiSelect FormFieldType = "multi_select"
+)
+
+// AdoptionForm is the questionnaire a shelter asks adopters to fill in. A
+// form with a Species applies to the shelter's pets of that species; the
+// form without one applies to the rest.
+type AdoptionForm struct {
+	ID        uint                `gorm:"primaryKey"`
+	ShelterID uint                `gorm:"not null;uniqueIndex:idx_adoption_forms_shelter_species"`
+	Shelter   Shelter             `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Species   string              `gorm:"size:80;not null;default:'';uniqueIndex:idx_adoption_forms_shelter_species"`
+	Title     string              `gorm:"size:120;not null"`
+	Fields    []AdoptionFormField `gorm:"foreignKey:FormID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// AdoptionFormField is one question of a form. MinLength and MaxLength bound
+// text answers, Min and Max numeric ones, and Pattern is a regular
+// expression text answers must match. Select fields only accept Options.
+type AdoptionFormField struct {
+	ID        uint          `gorm:"primaryKey"`
+	FormID    uint          `gorm:"not null;index"`
+	Position  int           `gorm:"not null"`
+	Key       string        `gorm:"size:60;not null"`
+	Label     string        `gorm:"size:200;not null"`
+	Type      FormFieldType `gorm:"size:20;not null"`
+	Required  bool          `gorm:"not null;default:false"`
+	Options   StringList    `gorm:"type:text"`
+	MinLength *int
+	MaxLength *int
+	Min       *float64
+	Max       *float64
+	Pattern   string `gorm:"size:255"`
+}
+
+// StringList is stored as a JSON array.
+type StringList []string
+
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal([]string(l))
+	return string(raw), err
+}
+
+func (l *StringList) Scan(value interface{}) error {
+	return scanJSON(value, l)
+}
+
+// FormAnswers holds the answers to an adoption form by field key, stored as
+// a JSON object.
+type FormAnswers map[string]interface{}
+
+func (a FormAnswers) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	raw, err := json.Marshal(map[string]interface{}(a))
+	return string(raw), err
+}
+
+func (a *FormAnswers) Scan(value interface{}) error {
+	return scanJSON(value, a)
+}
+
+func scanJSON(value interface{}, dest interface{}) error {
+	switch raw := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(raw), dest)
+	case []byte:
+		return json.Unmarshal(raw, dest)
+	default:
+		return errors.New("unsupported JSON column value")
+	}
+}
@@ -5,11 +5,20 @@ import "time"
 type AdoptionStatus string
 
 const (
-	AdoptionStatusPending  AdoptionStatus = "pending"
-	AdoptionStatusApproved AdoptionStatus = "approved"
-	AdoptionStatusRejected AdoptionStatus = "rejected"
+	AdoptionStatusSubmitted          AdoptionStatus = "submitted"
+	AdoptionStatusUnderReview        AdoptionStatus = "under_review"
+	AdoptionStatusInterviewScheduled AdoptionStatus = "interview_scheduled"
+	AdoptionStatusApproved           AdoptionStatus = "approved"
+	AdoptionStatusRejected           AdoptionStatus = "rejected"
+	AdoptionStatusWithdrawn          AdoptionStatus = "withdrawn"
+	AdoptionStatusCompleted          AdoptionStatus = "completed"
 )
 
+// Final reports whether no further transition is possible from the status.
+func (s AdoptionStatus) Final() bool {
+	return s == AdoptionStatusRejected || s == AdoptionStatusWithdrawn || s == AdoptionStatusCompleted
+}
+
 type AdoptionRequest struct {
 	ID        uint           `gorm:"primaryKey"`
 	PetID     uint           `gorm:"not null"`
@@ -17,7 +26,67 @@ type AdoptionRequest struct {
 	AdopterID uint           `gorm:"not null"`
 	Adopter   User           `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	Message   string         `gorm:"type:text"`
-	Status    AdoptionStatus `gorm:"size:20;default:'pending'"`
+	Status    AdoptionStatus `gorm:"size:20;default:'submitted'"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// When the request last entered each status; it was submitted at
+	// CreatedAt.
+	StatusChangedAt      *time.Time
+	ReviewStartedAt      *time.Time
+	InterviewScheduledAt *time.Time
+	ApprovedAt           *time.Time
+	RejectedAt           *time.Time
+	WithdrawnAt          *time.Time
+	CompletedAt          *time.Time
+
+	// The answers to the shelter's adoption form, if it had one when the
+	// request was submitted.
+	FormID  *uint
+	Answers FormAnswers `gorm:"type:text"`
+}
+
+// AdoptionStatusChange records one step of a request through the workflow.
+// From is empty for the submission. ActorID is nil for changes made before
+// history was kept.
+type AdoptionStatusChange struct {
+	ID        uint           `gorm:"primaryKey"`
+	RequestID uint           `gorm:"not null;index"`
+	From      AdoptionStatus `gorm:"size:20"`
+	To        AdoptionStatus `gorm:"size:20;not null"`
+	ActorID   *uint
+	Actor     *User  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Comment   string `gorm:"size:1000"`
+	CreatedAt time.Time
+}
+
+type EvaluationOutcome string
+
+const (
+	EvaluationPending EvaluationOutcome = "pending"
+	EvaluationPassed  EvaluationOutcome = "passed"
+	EvaluationFailed  EvaluationOutcome = "failed"
+)
+
+// AdoptionEvaluation is the shelter's private assessment of a request. It
+// lives apart from AdoptionRequest so it is never serialized along with
+// what the adopter sees.
+type AdoptionEvaluation struct {
+	RequestID        uint              `gorm:"primaryKey;autoIncrement:false"`
+	Score            *int              // 1 to 5
+	InterviewOutcome EvaluationOutcome `gorm:"size:20;not null;default:'pending'"`
+	ReferenceCheck   EvaluationOutcome `gorm:"size:20;not null;default:'pending'"`
+	UpdatedByID      *uint
+	UpdatedBy        *User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	UpdatedAt        time.Time
+}
+
+// AdoptionNote is a private note of the shelter's staff on a request.
+type AdoptionNote struct {
+	ID        uint `gorm:"primaryKey"`
+	RequestID uint `gorm:"not null;index"`
+	AuthorID  *uint
+	Author    *User  `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	Body      string `gorm:"type:text;not null"`
+	CreatedAt time.Time
 }
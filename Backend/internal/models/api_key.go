@@ -0,0 +1,46 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey lets a shelter's own software call the API without an interactive
+// login. It acts on behalf of the member who created it, limited to Scopes
+// (a comma separated list of permissions). Only the SHA-256 hash of the key
+// is stored; Prefix keeps its first characters so it can be recognised.
+type APIKey struct {
+	ID          uint    `gorm:"primaryKey"`
+	ShelterID   uint    `gorm:"not null;index"`
+	Shelter     Shelter `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedByID uint    `gorm:"not null"`
+	CreatedBy   User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Name        string  `gorm:"size:120;not null"`
+	Prefix      string  `gorm:"size:16;not null"`
+	KeyHash     string  `gorm:"size:64;not null;uniqueIndex"`
+	Scopes      string  `gorm:"size:255;not null"`
+	ExpiresAt   *time.Time
+	LastUsedAt  *time.Time
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+}
+
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+func (k APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+	return strings.Split(k.Scopes, ",")
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	for _, granted := range k.ScopeList() {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// AuditEvent records a state-changing action: who did it (and, when an admin
+// impersonated them or an API key was used, through what), what it touched
+// and how. Changes holds a JSON object mapping each changed field to its
+// "from" and "to" values.
+type AuditEvent struct {
+	ID             uint      `gorm:"primaryKey"`
+	ActorID        *uint     `gorm:"index"`
+	Actor          *User     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	ImpersonatorID *uint     `gorm:"index"`
+	APIKeyID       *uint     `gorm:"index"`
+	Action         string    `gorm:"size:64;not null;index"`
+	TargetType     string    `gorm:"size:32;not null;index:idx_audit_events_target"`
+	TargetID       uint      `gorm:"not null;index:idx_audit_events_target"`
+	Changes        string    `gorm:"type:text"`
+	IP             string    `gorm:"size:64"`
+	RequestID      string    `gorm:"size:64;index"`
+	CreatedAt      time.Time `gorm:"index"`
+}
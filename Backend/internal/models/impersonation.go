@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// Impersonation records an admin acting as another user for support. The
+// impersonation token is bound to Session, which has no refresh token, so the
+// impersonation ends when the session expires or is revoked.
+type Impersonation struct {
+	ID             uint    `gorm:"primaryKey"`
+	SessionID      string  `gorm:"size:64;not null;uniqueIndex"`
+	Session        Session `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	ImpersonatorID uint    `gorm:"not null;index"`
+	Impersonator   User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID         uint    `gorm:"not null;index"`
+	User           User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Reason         string  `gorm:"size:500;not null"`
+	ExpiresAt      time.Time
+	CreatedAt      time.Time
+}
+
+// ImpersonatedRequest is one request made with an impersonation token,
+// including the ones that were refused.
+type ImpersonatedRequest struct {
+	ID              uint          `gorm:"primaryKey"`
+	ImpersonationID uint          `gorm:"not null;index"`
+	Impersonation   Impersonation `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Method          string        `gorm:"size:10;not null"`
+	Path            string        `gorm:"size:500;not null"`
+	Status          int           `gorm:"not null"`
+	ClientIP        string        `gorm:"size:64"`
+	CreatedAt       time.Time
+}
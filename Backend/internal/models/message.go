@@ -0,0 +1,38 @@
+package models
+
+import "time"
+
+// AdoptionMessage is a message in the conversation between the adopter and
+// the pet's shelter about an adoption request. FromShelter tells which side
+// sent it, since any member of the shelter may answer.
+type AdoptionMessage struct {
+	ID          uint                `gorm:"primaryKey"`
+	RequestID   uint                `gorm:"not null;index"`
+	SenderID    *uint               `gorm:"index"`
+	Sender      *User               `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+	FromShelter bool                `gorm:"not null;default:false"`
+	Body        string              `gorm:"type:text;not null"`
+	Attachments []MessageAttachment `gorm:"foreignKey:MessageID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CreatedAt   time.Time
+}
+
+// MessageAttachment references a file shared in a message; the file itself
+// lives wherever URL points.
+type MessageAttachment struct {
+	ID          uint   `gorm:"primaryKey"`
+	MessageID   uint   `gorm:"not null;index"`
+	Name        string `gorm:"size:255;not null"`
+	URL         string `gorm:"size:1000;not null"`
+	ContentType string `gorm:"size:100"`
+	Size        int64
+}
+
+// ConversationRead is a read receipt: the last message of the request's
+// conversation the user has seen.
+type ConversationRead struct {
+	RequestID         uint `gorm:"primaryKey;autoIncrement:false"`
+	UserID            uint `gorm:"primaryKey;autoIncrement:false"`
+	User              User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	LastReadMessageID uint `gorm:"not null"`
+	ReadAt            time.Time
+}
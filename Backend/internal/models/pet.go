@@ -12,7 +12,7 @@ const (
 type Pet struct {
 	ID          uint      `gorm:"primaryKey"`
 	ShelterID   uint      `gorm:"not null"`
-	Shelter     User      `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Shelter     Shelter   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	Name        string    `gorm:"size:120;not null"`
 	Species     string    `gorm:"size:80;not null"`
 	Breed       string    `gorm:"size:120"`
@@ -23,4 +23,23 @@ type Pet struct {
 	Status      PetStatus `gorm:"size:20;default:'available'"`
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+
+	// PhotoKey names the uploaded photo in storage; PhotoURL then points to
+	// where the API serves it. It is nil for photos hosted elsewhere.
+	PhotoKey *string `gorm:"size:200"`
+
+	// Media is the pet's gallery, loaded only for a single pet. Lists carry
+	// CoverThumbnailURL instead, which is read from the cover photo.
+	Media             []PetMedia `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CoverThumbnailURL *string    `gorm:"->;-:migration"`
+
+	// Latitude and Longitude place the pet for sorting by distance; Distance
+	// is then how far, in kilometres, it is from where the list was asked.
+	Latitude  *float64
+	Longitude *float64
+	Distance  *float64 `gorm:"-"`
+
+	// Snippet is, in searches, the passage that best matches the query,
+	// escaped for HTML and with the matches wrapped in <mark>.
+	Snippet *string `gorm:"->;-:migration"`
 }
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+type PetMediaKind string
+
+const (
+	PetMediaPhoto PetMediaKind = "photo"
+	PetMediaVideo PetMediaKind = "video"
+)
+
+type PetMediaStatus string
+
+const (
+	// PetMediaProcessing photos wait for their smaller sizes to be made.
+	PetMediaProcessing PetMediaStatus = "processing"
+	PetMediaReady      PetMediaStatus = "ready"
+	PetMediaFailed     PetMediaStatus = "failed"
+)
+
+// PetMedia is a photo or video of a pet's gallery, shown by Position. Key
+// names the uploaded file in storage and URL where the API serves it. Photos
+// also get a WebURL, sized for browsing, and a ThumbnailURL once processed;
+// videos are served as uploaded. The cover is always a photo and its
+// thumbnail is what the catalog shows.
+type PetMedia struct {
+	ID           uint           `gorm:"primaryKey"`
+	PetID        uint           `gorm:"not null;index"`
+	Kind         PetMediaKind   `gorm:"size:10;not null"`
+	Status       PetMediaStatus `gorm:"size:20;not null;index"`
+	Position     int            `gorm:"not null"`
+	Cover        bool           `gorm:"not null;default:false"`
+	Caption      string         `gorm:"size:300"`
+	ContentType  string         `gorm:"size:50;not null"`
+	Size         int
+	Width        int
+	Height       int
+	Key          string  `gorm:"size:200;not null"`
+	URL          string  `gorm:"size:255;not null"`
+	WebKey       *string `gorm:"size:200"`
+	WebURL       *string `gorm:"size:255"`
+	ThumbnailKey *string `gorm:"size:200"`
+	ThumbnailURL *string `gorm:"size:255"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Keys returns every file stored for the media.
+func (m PetMedia) Keys() []string {
+	keys := []string{m.Key}
+	if m.WebKey != nil {
+		keys = append(keys, *m.WebKey)
+	}
+	if m.ThumbnailKey != nil {
+		keys = append(keys, *m.ThumbnailKey)
+	}
+	return keys
+}
@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+type ShelterRole string
+
+const (
+	ShelterRoleOwner   ShelterRole = "owner"
+	ShelterRoleManager ShelterRole = "manager"
+	ShelterRoleStaff   ShelterRole = "staff"
+)
+
+// Shelter is the organization that publishes pets and decides on adoption
+// requests. Its staff are users linked through ShelterMember.
+type Shelter struct {
+	ID         uint    `gorm:"primaryKey"`
+	Name       string  `gorm:"size:150;not null"`
+	Phone      *string `gorm:"size:40"`
+	City       *string `gorm:"size:80"`
+	IsApproved bool    `gorm:"default:false"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// ShelterMember links a user to the shelter they work for. A user belongs to
+// at most one shelter.
+type ShelterMember struct {
+	ID        uint        `gorm:"primaryKey"`
+	ShelterID uint        `gorm:"not null;index"`
+	Shelter   Shelter     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	UserID    uint        `gorm:"not null;uniqueIndex"`
+	User      User        `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Role      ShelterRole `gorm:"size:20;not null"`
+	CreatedAt time.Time
+}
+
+// ShelterInvitation is mailed to a prospective member. Only the SHA-256 hash
+// of the token is stored.
+type ShelterInvitation struct {
+	ID          uint        `gorm:"primaryKey"`
+	ShelterID   uint        `gorm:"not null;index"`
+	Shelter     Shelter     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Email       string      `gorm:"size:180;not null;index"`
+	Role        ShelterRole `gorm:"size:20;not null"`
+	TokenHash   string      `gorm:"size:64;not null;uniqueIndex"`
+	InvitedByID uint        `gorm:"not null"`
+	ExpiresAt   time.Time
+	AcceptedAt  *time.Time
+	CreatedAt   time.Time
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// SigningKey is a JWT signing key. The private key is a PKCS#8 PEM block
+// encrypted with the key-encryption secret; RetiredAt is set when a newer
+// key takes over signing.
+type SigningKey struct {
+	ID         string `gorm:"primaryKey;size:64"`
+	Algorithm  string `gorm:"size:16;not null"`
+	PrivateKey string `gorm:"type:text;not null"`
+	CreatedAt  time.Time
+	RetiredAt  *time.Time
+}
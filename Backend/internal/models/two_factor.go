@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// TwoFactor holds a user's TOTP secret. It is created unconfirmed during
+// setup and only enforced once ConfirmedAt is set.
+type TwoFactor struct {
+	UserID       uint   `gorm:"primaryKey;autoIncrement:false"`
+	User         User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Secret       string `gorm:"size:64;not null"`
+	ConfirmedAt  *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	User      User   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	CodeHash  string `gorm:"size:64;not null;index"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -10,17 +10,36 @@ const (
 	RoleAdmin   UserRole = "admin"
 )
 
+type UserStatus string
+
+const (
+	// UserStatusPending accounts wait for an admin, e.g. new shelters.
+	UserStatusPending   UserStatus = "pending"
+	UserStatusActive    UserStatus = "active"
+	UserStatusRejected  UserStatus = "rejected"
+	UserStatusSuspended UserStatus = "suspended"
+)
+
 type User struct {
-	ID           uint     `gorm:"primaryKey"`
-	Name         string   `gorm:"size:120;not null"`
-	Email        string   `gorm:"size:180;not null;uniqueIndex"`
-	PasswordHash string   `gorm:"size:255;not null"`
-	Role         UserRole `gorm:"size:20;not null"`
-	ShelterName  *string  `gorm:"size:150"`
-	Phone        *string  `gorm:"size:40"`
-	City         *string  `gorm:"size:80"`
-	IsApproved   bool     `gorm:"default:false"`
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	Pets         []Pet `gorm:"foreignKey:ShelterID"`
+	ID               uint     `gorm:"primaryKey"`
+	Name             string   `gorm:"size:120;not null"`
+	Email            string   `gorm:"size:180;not null;uniqueIndex"`
+	PasswordHash     string   `gorm:"size:255;not null"`
+	Role             UserRole `gorm:"size:20;not null"`
+	ShelterName      *string  `gorm:"size:150"`
+	Phone            *string  `gorm:"size:40"`
+	City             *string  `gorm:"size:80"`
+	IsApproved       bool     `gorm:"default:false"`
+	EmailVerified    bool     `gorm:"default:false"`
+	EmailVerifiedAt  *time.Time
+	TwoFactorEnabled bool `gorm:"default:false"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+
+	// Only active accounts can sign in. The other fields record the admin
+	// decision behind the current status, if any.
+	Status            UserStatus `gorm:"size:20;not null;default:'active';index"`
+	StatusReason      *string    `gorm:"size:500"`
+	StatusChangedAt   *time.Time
+	StatusChangedByID *uint
 }
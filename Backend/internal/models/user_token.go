@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+type UserTokenPurpose string
+
+const (
+	TokenPurposePasswordReset     UserTokenPurpose = "password_reset"
+	TokenPurposeEmailVerification UserTokenPurpose = "email_verification"
+	TokenPurposeEmailChange       UserTokenPurpose = "email_change"
+)
+
+// UserToken is a single-use secret mailed to a user. Only the SHA-256 hash of
+// the token is stored.
+type UserToken struct {
+	ID        uint             `gorm:"primaryKey"`
+	UserID    uint             `gorm:"not null;index"`
+	User      User             `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Purpose   UserTokenPurpose `gorm:"size:40;not null;index"`
+	TokenHash string           `gorm:"size:64;not null;uniqueIndex"`
+	// Payload holds purpose specific data, e.g. the new address of an email
+	// change.
+	Payload   string `gorm:"size:255"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+type VisitStatus string
+
+const (
+	VisitStatusBooked    VisitStatus = "booked"
+	VisitStatusCancelled VisitStatus = "cancelled"
+)
+
+// VisitSlot is a time the shelter can receive an adopter for a
+// meet-and-greet. BookingID points to the booking holding the slot; setting
+// it only while it is nil is what keeps a slot from being booked twice.
+type VisitSlot struct {
+	ID          uint      `gorm:"primaryKey"`
+	ShelterID   uint      `gorm:"not null;index"`
+	Shelter     Shelter   `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	StartsAt    time.Time `gorm:"not null;index"`
+	EndsAt      time.Time `gorm:"not null"`
+	Location    string    `gorm:"size:255"`
+	BookingID   *uint     `gorm:"index"`
+	CreatedByID *uint
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// VisitBooking is an adopter's visit, booked for an adoption request.
+// Rescheduling moves the same booking to another slot and bumps Sequence,
+// so calendar apps update the event instead of adding a second one.
+type VisitBooking struct {
+	ID             uint            `gorm:"primaryKey"`
+	RequestID      uint            `gorm:"not null;index"`
+	Request        AdoptionRequest `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	SlotID         uint            `gorm:"not null;index"`
+	Slot           VisitSlot       `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Status         VisitStatus     `gorm:"size:20;not null;default:'booked'"`
+	Sequence       int             `gorm:"not null;default:0"`
+	ReminderSentAt *time.Time
+	CancelledAt    *time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"errors"
+
+	"petmatch/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type AdoptionFormRepository struct {
+	db *gorm.DB
+}
+
+func NewAdoptionFormRepository(db *gorm.DB) *AdoptionFormRepository {
+	return &AdoptionFormRepository{db: db}
+}
+
+func (r *AdoptionFormRepository) Create(form *models.AdoptionForm) error {
+	return r.db.Create(form).Error
+}
+
+// Replace saves the form and swaps its fields for form.Fields.
+func (r *AdoptionFormRepository) Replace(form *models.AdoptionForm) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Fields").Save(form).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("form_id = ?", form.ID).Delete(&models.AdoptionFormField{}).Error; err != nil {
+			return err
+		}
+		for i := range form.Fields {
+			form.Fields[i].ID = 0
+			form.Fields[i].FormID = form.ID
+		}
+		if len(form.Fields) == 0 {
+			return nil
+		}
+		return tx.Create(&form.Fields).Error
+	})
+}
+
+func (r *AdoptionFormRepository) Delete(form *models.AdoptionForm) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("form_id = ?", form.ID).Delete(&models.AdoptionFormField{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.AdoptionForm{}, form.ID).Error
+	})
+}
+
+func (r *AdoptionFormRepository) FindByID(id uint) (*models.AdoptionForm, error) {
+	var form models.AdoptionForm
+	if err := r.withFields().First(&form, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &form, nil
+}
+
+// FindBySpecies returns the shelter's form for exactly that species; an
+// empty species finds the shelter's general form.
+func (r *AdoptionFormRepository) FindBySpecies(shelterID uint, species string) (*models.AdoptionForm, error) {
+	var form models.AdoptionForm
+	if err := r.withFields().
+		Where("shelter_id = ? AND species = ?", shelterID, species).
+		First(&form).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &form, nil
+}
+
+func (r *AdoptionFormRepository) ListByShelter(shelterID uint) ([]models.AdoptionForm, error) {
+	var forms []models.AdoptionForm
+	if err := r.withFields().
+		Where("shelter_id = ?", shelterID).
+		Order("species asc").
+		Find(&forms).Error; err != nil {
+		return nil, err
+	}
+	return forms, nil
+}
+
+func (r *AdoptionFormRepository) withFields() *gorm.DB {
+	return r.db.Preload("Fields", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	})
+}
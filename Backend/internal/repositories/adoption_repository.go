@@ -6,6 +6,7 @@ import (
 	"petmatch/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type AdoptionRepository struct {
@@ -16,17 +17,352 @@ func NewAdoptionRepository(db *gorm.DB) *AdoptionRepository {
 	return &AdoptionRepository{db: db}
 }
 
-func (r *AdoptionRepository) Create(req *models.AdoptionRequest) error {
-	return r.db.Create(req).Error
+// Create stores the request with change, the first entry of its history,
+// unless the adopter already has a request for the pet in one of the open
+// statuses (ErrOpenRequestExists) or, when maxOpen is positive, maxOpen open
+// requests in all (ErrOpenRequestLimit). The checks and the insert share a
+// transaction that starts by writing to the adopter's row, so concurrent
+// submissions of one adopter run one after the other; the partial unique
+// index on open requests backs the duplicate check up.
+func (r *AdoptionRepository) Create(req *models.AdoptionRequest, change *models.AdoptionStatusChange, open []models.AdoptionStatus, maxOpen int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE users SET id = id WHERE id = ?", req.AdopterID).Error; err != nil {
+			return err
+		}
+
+		var total, forPet int64
+		query := tx.Model(&models.AdoptionRequest{}).Where("adopter_id = ? AND status IN ?", req.AdopterID, open)
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			return err
+		}
+		if err := query.Session(&gorm.Session{}).Where("pet_id = ?", req.PetID).Count(&forPet).Error; err != nil {
+			return err
+		}
+		if forPet > 0 {
+			return ErrOpenRequestExists
+		}
+		if maxOpen > 0 && total >= int64(maxOpen) {
+			return ErrOpenRequestLimit
+		}
+
+		if err := tx.Create(req).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrOpenRequestExists
+			}
+			return err
+		}
+		change.RequestID = req.ID
+		return tx.Create(change).Error
+	})
 }
 
 func (r *AdoptionRepository) Update(req *models.AdoptionRequest) error {
 	return r.db.Save(req).Error
 }
 
+// Transition moves the request from change.From to change.To and records
+// the change in its history. It stamps change.CreatedAt in status_changed_at
+// and in column, when given. A rejected request loses its booked visit. It
+// reports false when the request was no longer in the expected status, so
+// concurrent changes cannot both apply.
+func (r *AdoptionRepository) Transition(change *models.AdoptionStatusChange, column string) (bool, error) {
+	updates := map[string]interface{}{
+		"status":            change.To,
+		"status_changed_at": change.CreatedAt,
+	}
+	if column != "" {
+		updates[column] = change.CreatedAt
+	}
+
+	moved := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.AdoptionRequest{}).
+			Where("id = ? AND status = ?", change.RequestID, change.From).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return nil
+		}
+		moved = true
+		if err := tx.Create(change).Error; err != nil {
+			return err
+		}
+		if change.To == models.AdoptionStatusRejected {
+			return cancelVisits(tx, []uint{change.RequestID}, change.CreatedAt)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return moved, nil
+}
+
+// Approve records change, which approves the request, marks its pet adopted
+// and rejects the other open requests for the pet with closingComment in
+// their history, cancelling their visits, all in one transaction. It reports
+// false, and changes nothing, when the request was no longer in status
+// change.From or the pet was no longer available. The requests it rejected
+// are returned with their adopters.
+func (r *AdoptionRepository) Approve(request *models.AdoptionRequest, change *models.AdoptionStatusChange, open []models.AdoptionStatus, closingComment string) ([]models.AdoptionRequest, bool, error) {
+	at := change.CreatedAt
+	var closed []models.AdoptionRequest
+	approved := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.AdoptionRequest{}).
+			Where("id = ? AND status = ?", request.ID, change.From).
+			Updates(map[string]interface{}{
+				"status":            models.AdoptionStatusApproved,
+				"status_changed_at": at,
+				"approved_at":       at,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return nil
+		}
+
+		result = tx.Model(&models.Pet{}).
+			Where("id = ? AND status = ?", request.PetID, models.PetStatusAvailable).
+			Update("status", models.PetStatusAdopted)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errPetTaken
+		}
+
+		if err := tx.Preload("Adopter").
+			Where("pet_id = ? AND id <> ? AND status IN ?", request.PetID, request.ID, open).
+			Find(&closed).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(change).Error; err != nil {
+			return err
+		}
+
+		if len(closed) > 0 {
+			ids := make([]uint, len(closed))
+			history := make([]models.AdoptionStatusChange, len(closed))
+			for i, other := range closed {
+				ids[i] = other.ID
+				history[i] = models.AdoptionStatusChange{
+					RequestID: other.ID,
+					From:      other.Status,
+					To:        models.AdoptionStatusRejected,
+					ActorID:   change.ActorID,
+					Comment:   closingComment,
+					CreatedAt: at,
+				}
+			}
+			if err := tx.Model(&models.AdoptionRequest{}).
+				Where("id IN ?", ids).
+				Updates(map[string]interface{}{
+					"status":            models.AdoptionStatusRejected,
+					"status_changed_at": at,
+					"rejected_at":       at,
+				}).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&history).Error; err != nil {
+				return err
+			}
+			if err := cancelVisits(tx, ids, at); err != nil {
+				return err
+			}
+		}
+
+		approved = true
+		return nil
+	})
+	if errors.Is(err, errPetTaken) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return closed, approved, nil
+}
+
+// Withdraw records change, which withdraws the request, if the request is
+// still in status change.From, and cancels its booked visit. Withdrawing an
+// approved request puts its pet back up for adoption in the same
+// transaction and reopens the requests its approval rejected with
+// closingComment, each in the status it had then, recording reopeningComment
+// in their history. The reopened requests are returned with their adopters.
+func (r *AdoptionRepository) Withdraw(request *models.AdoptionRequest, change *models.AdoptionStatusChange, closingComment, reopeningComment string) ([]models.AdoptionRequest, bool, error) {
+	var reopened []models.AdoptionRequest
+	withdrawn := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.AdoptionRequest{}).
+			Where("id = ? AND status = ?", request.ID, change.From).
+			Updates(map[string]interface{}{
+				"status":            models.AdoptionStatusWithdrawn,
+				"status_changed_at": change.CreatedAt,
+				"withdrawn_at":      change.CreatedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return nil
+		}
+
+		if err := tx.Create(change).Error; err != nil {
+			return err
+		}
+		if err := cancelVisits(tx, []uint{request.ID}, change.CreatedAt); err != nil {
+			return err
+		}
+
+		if change.From == models.AdoptionStatusApproved {
+			result := tx.Model(&models.Pet{}).
+				Where("id = ? AND status = ?", request.PetID, models.PetStatusAdopted).
+				Update("status", models.PetStatusAvailable)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 1 {
+				var err error
+				if reopened, err = reopenClosed(tx, request, change, closingComment, reopeningComment); err != nil {
+					return err
+				}
+			}
+		}
+
+		withdrawn = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return reopened, withdrawn, nil
+}
+
+// reopenClosed puts the requests rejected by the approval of request, which
+// is being withdrawn by change, back in the status they had before. They are
+// found by their closing entry, which Approve stamped with the approval time.
+func reopenClosed(tx *gorm.DB, request *models.AdoptionRequest, change *models.AdoptionStatusChange, closingComment, reopeningComment string) ([]models.AdoptionRequest, error) {
+	var closings []models.AdoptionStatusChange
+	if err := tx.Joins("JOIN adoption_requests ON adoption_requests.id = adoption_status_changes.request_id").
+		Where("adoption_requests.pet_id = ? AND adoption_requests.id <> ? AND adoption_requests.status = ?",
+			request.PetID, request.ID, models.AdoptionStatusRejected).
+		Where(`adoption_status_changes."to" = ? AND adoption_status_changes.comment = ?`,
+			models.AdoptionStatusRejected, closingComment).
+		Where("adoption_status_changes.created_at = adoption_requests.rejected_at").
+		Where("adoption_requests.rejected_at = (SELECT approved.approved_at FROM adoption_requests approved WHERE approved.id = ?)", request.ID).
+		Find(&closings).Error; err != nil {
+		return nil, err
+	}
+	if len(closings) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]uint, len(closings))
+	history := make([]models.AdoptionStatusChange, len(closings))
+	for i, closing := range closings {
+		ids[i] = closing.RequestID
+		history[i] = models.AdoptionStatusChange{
+			RequestID: closing.RequestID,
+			From:      models.AdoptionStatusRejected,
+			To:        closing.From,
+			ActorID:   change.ActorID,
+			Comment:   reopeningComment,
+			CreatedAt: change.CreatedAt,
+		}
+		if err := tx.Model(&models.AdoptionRequest{}).
+			Where("id = ?", closing.RequestID).
+			Updates(map[string]interface{}{
+				"status":            closing.From,
+				"status_changed_at": change.CreatedAt,
+			}).Error; err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return nil, err
+	}
+
+	var reopened []models.AdoptionRequest
+	if err := tx.Preload("Adopter").Where("id IN ?", ids).Find(&reopened).Error; err != nil {
+		return nil, err
+	}
+	return reopened, nil
+}
+
+// ListHistory returns the status changes of the request, oldest first.
+func (r *AdoptionRepository) ListHistory(requestID uint) ([]models.AdoptionStatusChange, error) {
+	var history []models.AdoptionStatusChange
+	if err := r.db.Preload("Actor").
+		Where("request_id = ?", requestID).
+		Order("created_at asc, id asc").
+		Find(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func (r *AdoptionRepository) FindEvaluation(requestID uint) (*models.AdoptionEvaluation, error) {
+	var evaluation models.AdoptionEvaluation
+	if err := r.db.Preload("UpdatedBy").Where("request_id = ?", requestID).First(&evaluation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &evaluation, nil
+}
+
+// SaveEvaluation creates or replaces the evaluation of its request.
+func (r *AdoptionRepository) SaveEvaluation(evaluation *models.AdoptionEvaluation) error {
+	return r.db.Omit("UpdatedBy").Clauses(clause.OnConflict{UpdateAll: true}).Create(evaluation).Error
+}
+
+func (r *AdoptionRepository) CreateNote(note *models.AdoptionNote) error {
+	return r.db.Omit("Author").Create(note).Error
+}
+
+func (r *AdoptionRepository) FindNote(requestID, id uint) (*models.AdoptionNote, error) {
+	var note models.AdoptionNote
+	if err := r.db.Where("id = ? AND request_id = ?", id, requestID).First(&note).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &note, nil
+}
+
+func (r *AdoptionRepository) DeleteNote(id uint) error {
+	return r.db.Delete(&models.AdoptionNote{}, id).Error
+}
+
+// ListNotes returns the notes on the request, oldest first.
+func (r *AdoptionRepository) ListNotes(requestID uint) ([]models.AdoptionNote, error) {
+	var notes []models.AdoptionNote
+	if err := r.db.Preload("Author").
+		Where("request_id = ?", requestID).
+		Order("created_at asc, id asc").
+		Find(&notes).Error; err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+var (
+	ErrOpenRequestExists = errors.New("the adopter already has an open request for the pet")
+	ErrOpenRequestLimit  = errors.New("the adopter has too many open requests")
+)
+
+// errPetTaken rolls back an approval whose pet was adopted concurrently.
+var errPetTaken = errors.New("pet is no longer available")
+
 func (r *AdoptionRepository) FindByID(id uint) (*models.AdoptionRequest, error) {
 	var request models.AdoptionRequest
-	if err := r.db.Preload("Pet").Preload("Adopter").First(&request, id).Error; err != nil {
+	if err := r.db.Preload("Pet.Shelter").Preload("Adopter").First(&request, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, nil
 		}
@@ -35,28 +371,40 @@ func (r *AdoptionRepository) FindByID(id uint) (*models.AdoptionRequest, error)
 	return &request, nil
 }
 
-func (r *AdoptionRepository) ListByShelter(shelterID uint) ([]models.AdoptionRequest, error) {
-	var requests []models.AdoptionRequest
-	if err := r.db.
+// adoptionSortFields lists the sorts of the request lists.
+var adoptionSortFields = map[string]sortField{
+	"created_at": {expr: "adoption_requests.created_at", kind: sortTime},
+	"updated_at": {expr: "adoption_requests.updated_at", kind: sortTime},
+}
+
+// ListByShelter returns a page of the requests for the shelter's pets,
+// sorted by created_at or updated_at.
+func (r *AdoptionRepository) ListByShelter(shelterID uint, page PageRequest) ([]models.AdoptionRequest, PageInfo, error) {
+	query := r.db.Model(&models.AdoptionRequest{}).
 		Joins("JOIN pets ON pets.id = adoption_requests.pet_id").
-		Where("pets.shelter_id = ?", shelterID).
-		Preload("Pet").
-		Preload("Adopter").
-		Order("adoption_requests.created_at desc").
-		Find(&requests).Error; err != nil {
-		return nil, err
+		Where("pets.shelter_id = ?", shelterID)
+
+	var requests []models.AdoptionRequest
+	info, err := paginate(query, adoptionSortFields, "adoption_requests.id", page, &requests, preloadPetAndAdopter)
+	if err != nil {
+		return nil, PageInfo{}, err
 	}
-	return requests, nil
+	return requests, info, nil
 }
 
-func (r *AdoptionRepository) ListByAdopter(adopterID uint) ([]models.AdoptionRequest, error) {
+// ListByAdopter returns a page of the adopter's requests, sorted like
+// ListByShelter.
+func (r *AdoptionRepository) ListByAdopter(adopterID uint, page PageRequest) ([]models.AdoptionRequest, PageInfo, error) {
+	query := r.db.Model(&models.AdoptionRequest{}).Where("adoption_requests.adopter_id = ?", adopterID)
+
 	var requests []models.AdoptionRequest
-	if err := r.db.Where("adopter_id = ?", adopterID).
-		Preload("Pet").
-		Preload("Adopter").
-		Order("created_at desc").
-		Find(&requests).Error; err != nil {
-		return nil, err
+	info, err := paginate(query, adoptionSortFields, "adoption_requests.id", page, &requests, preloadPetAndAdopter)
+	if err != nil {
+		return nil, PageInfo{}, err
 	}
-	return requests, nil
+	return requests, info, nil
+}
+
+func preloadPetAndAdopter(db *gorm.DB) *gorm.DB {
+	return db.Preload("Pet.Shelter").Preload("Adopter")
 }
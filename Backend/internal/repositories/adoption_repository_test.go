@@ -0,0 +1,159 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"petmatch/internal/database"
+	"petmatch/internal/models"
+	"petmatch/internal/testdb"
+)
+
+var testOpenStatuses = []models.AdoptionStatus{
+	models.AdoptionStatusSubmitted,
+	models.AdoptionStatusUnderReview,
+	models.AdoptionStatusInterviewScheduled,
+}
+
+// seedAdoptionFixtures stores an adopter and pets pets of one shelter.
+func seedAdoptionFixtures(t *testing.T, repo *AdoptionRepository, pets int) (models.User, []models.Pet) {
+	t.Helper()
+
+	adopter := models.User{Name: "Ana", Email: "ana@example.com", PasswordHash: "x", Role: models.RoleAdopter}
+	if err := repo.db.Create(&adopter).Error; err != nil {
+		t.Fatal(err)
+	}
+	shelter := models.Shelter{Name: "Refugio"}
+	if err := repo.db.Create(&shelter).Error; err != nil {
+		t.Fatal(err)
+	}
+	list := make([]models.Pet, pets)
+	for i := range list {
+		list[i] = models.Pet{ShelterID: shelter.ID, Name: fmt.Sprintf("Pet %d", i), Species: "dog", Age: 1}
+	}
+	if err := repo.db.Create(&list).Error; err != nil {
+		t.Fatal(err)
+	}
+	return adopter, list
+}
+
+func submitRequest(repo *AdoptionRepository, adopterID, petID uint, maxOpen int) error {
+	now := time.Now()
+	request := &models.AdoptionRequest{
+		PetID:           petID,
+		AdopterID:       adopterID,
+		Status:          models.AdoptionStatusSubmitted,
+		StatusChangedAt: &now,
+	}
+	change := &models.AdoptionStatusChange{To: models.AdoptionStatusSubmitted, ActorID: &adopterID, CreatedAt: now}
+	return repo.Create(request, change, testOpenStatuses, maxOpen)
+}
+
+func newAdoptionTestRepo(t *testing.T) *AdoptionRepository {
+	t.Helper()
+
+	db := testdb.Open(t)
+	if err := database.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return NewAdoptionRepository(db)
+}
+
+func TestAdoptionCreateChecksOpenRequests(t *testing.T) {
+	repo := newAdoptionTestRepo(t)
+	adopter, pets := seedAdoptionFixtures(t, repo, 4)
+
+	// The submissions are made in this order with at most 2 open requests.
+	tests := []struct {
+		name string
+		pet  int
+		want error
+	}{
+		{"first request", 0, nil},
+		{"same pet again", 0, ErrOpenRequestExists},
+		{"second pet", 1, nil},
+		{"over the limit", 2, ErrOpenRequestLimit},
+	}
+	for _, tt := range tests {
+		if err := submitRequest(repo, adopter.ID, pets[tt.pet].ID, 2); !errors.Is(err, tt.want) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// A closed request no longer counts.
+	if err := repo.db.Model(&models.AdoptionRequest{}).
+		Where("pet_id = ?", pets[0].ID).
+		Update("status", models.AdoptionStatusWithdrawn).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := submitRequest(repo, adopter.ID, pets[0].ID, 2); err != nil {
+		t.Errorf("request after withdrawing: %v", err)
+	}
+}
+
+func TestAdoptionCreateIndexRefusesDuplicates(t *testing.T) {
+	repo := newAdoptionTestRepo(t)
+	adopter, pets := seedAdoptionFixtures(t, repo, 1)
+	if err := submitRequest(repo, adopter.ID, pets[0].ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Inserting around the checks still hits the unique index.
+	err := repo.db.Create(&models.AdoptionRequest{
+		PetID:     pets[0].ID,
+		AdopterID: adopter.ID,
+		Status:    models.AdoptionStatusUnderReview,
+	}).Error
+	if err == nil {
+		t.Fatal("the database accepted a second open request for the pet")
+	}
+}
+
+func TestAdoptionCreateConcurrentSubmissions(t *testing.T) {
+	tests := []struct {
+		name    string
+		pets    int
+		maxOpen int
+		want    int
+	}{
+		{"same pet", 1, 0, 1},
+		{"different pets over the limit", 8, 3, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newAdoptionTestRepo(t)
+			adopter, pets := seedAdoptionFixtures(t, repo, tt.pets)
+
+			const submissions = 8
+			errs := make(chan error, submissions)
+			var wg sync.WaitGroup
+			for i := 0; i < submissions; i++ {
+				wg.Add(1)
+				go func(pet models.Pet) {
+					defer wg.Done()
+					errs <- submitRequest(repo, adopter.ID, pet.ID, tt.maxOpen)
+				}(pets[i%len(pets)])
+			}
+			wg.Wait()
+			close(errs)
+
+			created := 0
+			for err := range errs {
+				switch {
+				case err == nil:
+					created++
+				case errors.Is(err, ErrOpenRequestExists), errors.Is(err, ErrOpenRequestLimit):
+				default:
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+			if created != tt.want {
+				t.Errorf("%d submissions succeeded, want %d", created, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"petmatch/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+func (r *APIKeyRepository) Create(key *models.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *APIKeyRepository) FindByHash(keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := r.db.Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *APIKeyRepository) ListByShelter(shelterID uint) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := r.db.Preload("CreatedBy").
+		Where("shelter_id = ?", shelterID).
+		Order("created_at desc").
+		Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke revokes an active key of the shelter. It reports false when there
+// was none with that id.
+func (r *APIKeyRepository) Revoke(shelterID, id uint, now time.Time) (bool, error) {
+	result := r.db.Model(&models.APIKey{}).
+		Where("id = ? AND shelter_id = ? AND revoked_at IS NULL", id, shelterID).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Touch records a use of the key. Writes are skipped when the previous use is
+// more recent than resolution, so busy integrations don't write on every
+// request.
+func (r *APIKeyRepository) Touch(id uint, now time.Time, resolution time.Duration) error {
+	return r.db.Model(&models.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-resolution)).
+		Update("last_used_at", now).Error
+}
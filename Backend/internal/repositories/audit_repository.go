@@ -0,0 +1,70 @@
+package repositories
+
+import (
+	"time"
+
+	"petmatch/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type AuditRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditRepository(db *gorm.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+func (r *AuditRepository) Create(event *models.AuditEvent) error {
+	return r.db.Create(event).Error
+}
+
+type AuditFilter struct {
+	ActorID    *uint
+	Action     string
+	TargetType string
+	TargetID   *uint
+	RequestID  string
+	From       *time.Time
+	To         *time.Time
+}
+
+// auditSortFields lists the sorts of the audit log.
+var auditSortFields = map[string]sortField{
+	"created_at": {expr: "audit_events.created_at", kind: sortTime},
+}
+
+// List returns a page of events matching the filter, sorted by created_at.
+func (r *AuditRepository) List(filter AuditFilter, page PageRequest) ([]models.AuditEvent, PageInfo, error) {
+	query := r.db.Model(&models.AuditEvent{})
+	if filter.ActorID != nil {
+		query = query.Where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != nil {
+		query = query.Where("target_id = ?", *filter.TargetID)
+	}
+	if filter.RequestID != "" {
+		query = query.Where("request_id = ?", filter.RequestID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var events []models.AuditEvent
+	info, err := paginate(query, auditSortFields, "audit_events.id", page, &events,
+		func(db *gorm.DB) *gorm.DB { return db.Preload("Actor") })
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+	return events, info, nil
+}
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"errors"
+
+	"petmatch/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type ImpersonationRepository struct {
+	db *gorm.DB
+}
+
+func NewImpersonationRepository(db *gorm.DB) *ImpersonationRepository {
+	return &ImpersonationRepository{db: db}
+}
+
+// Create stores the impersonation together with the session its token is
+// bound to.
+func (r *ImpersonationRepository) Create(impersonation *models.Impersonation, session *models.Session) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(session).Error; err != nil {
+			return err
+		}
+		impersonation.SessionID = session.ID
+		return tx.Create(impersonation).Error
+	})
+}
+
+func (r *ImpersonationRepository) FindByID(id uint) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	if err := r.db.First(&impersonation, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+func (r *ImpersonationRepository) FindBySessionID(sessionID string) (*models.Impersonation, error) {
+	var impersonation models.Impersonation
+	if err := r.db.Preload("Impersonator").
+		Where("session_id = ?", sessionID).
+		First(&impersonation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &impersonation, nil
+}
+
+type ImpersonationFilter struct {
+	ImpersonatorID *uint
+	UserID         *uint
+}
+
+// List returns the most recent impersonations, newest first.
+func (r *ImpersonationRepository) List(filter ImpersonationFilter, limit int) ([]models.Impersonation, error) {
+	query := r.db.Preload("Impersonator").Preload("User")
+	if filter.ImpersonatorID != nil {
+		query = query.Where("impersonator_id = ?", *filter.ImpersonatorID)
+	}
+	if filter.UserID != nil {
+		query = query.Where("user_id = ?", *filter.UserID)
+	}
+
+	var impersonations []models.Impersonation
+	if err := query.Order("created_at desc").Limit(limit).Find(&impersonations).Error; err != nil {
+		return nil, err
+	}
+	return impersonations, nil
+}
+
+func (r *ImpersonationRepository) RecordRequest(request *models.ImpersonatedRequest) error {
+	return r.db.Create(request).Error
+}
+
+func (r *ImpersonationRepository) ListRequests(impersonationID uint) ([]models.ImpersonatedRequest, error) {
+	var requests []models.ImpersonatedRequest
+	if err := r.db.
+		Where("impersonation_id = ?", impersonationID).
+		Order("created_at asc, id asc").
+		Find(&requests).Error; err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
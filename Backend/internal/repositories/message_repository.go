@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"petmatch/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MessageRepository struct {
+	db *gorm.DB
+}
+
+// UnreadCount is the number of unread messages in one conversation.
+type UnreadCount struct {
+	RequestID uint
+	Unread    int64
+}
+
+func NewMessageRepository(db *gorm.DB) *MessageRepository {
+	return &MessageRepository{db: db}
+}
+
+// Create stores the message with its attachments.
+func (r *MessageRepository) Create(message *models.AdoptionMessage) error {
+	return r.db.Omit("Sender").Create(message).Error
+}
+
+// List returns a page of the request's messages, newest first, with the
+// total number of messages.
+func (r *MessageRepository) List(requestID uint, offset, limit int) ([]models.AdoptionMessage, int64, error) {
+	query := r.db.Model(&models.AdoptionMessage{}).Where("request_id = ?", requestID)
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var messages []models.AdoptionMessage
+	if err := query.Session(&gorm.Session{}).
+		Preload("Sender").
+		Preload("Attachments").
+		Order("id desc").
+		Offset(offset).
+		Limit(limit).
+		Find(&messages).Error; err != nil {
+		return nil, 0, err
+	}
+	return messages, total, nil
+}
+
+// LatestID returns the id of the request's newest message, or 0 if there is
+// none.
+func (r *MessageRepository) LatestID(requestID uint) (uint, error) {
+	var id uint
+	err := r.db.Model(&models.AdoptionMessage{}).
+		Where("request_id = ?", requestID).
+		Select("COALESCE(MAX(id), 0)").
+		Scan(&id).Error
+	return id, err
+}
+
+// MarkRead moves the user's read receipt forward. It never moves back, so
+// receipts sent out of order cannot mark messages unread again.
+func (r *MessageRepository) MarkRead(read *models.ConversationRead) error {
+	return r.db.Omit("User").Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "request_id"}, {Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"last_read_message_id": gorm.Expr("MAX(conversation_reads.last_read_message_id, excluded.last_read_message_id)"),
+			"read_at":              gorm.Expr("excluded.read_at"),
+		}),
+	}).Create(read).Error
+}
+
+func (r *MessageRepository) ListReads(requestID uint) ([]models.ConversationRead, error) {
+	var reads []models.ConversationRead
+	if err := r.db.Preload("User").
+		Where("request_id = ?", requestID).
+		Order("read_at asc").
+		Find(&reads).Error; err != nil {
+		return nil, err
+	}
+	return reads, nil
+}
+
+// UnreadForAdopter counts, per request of the adopter, the shelter's
+// messages the adopter has not read.
+func (r *MessageRepository) UnreadForAdopter(userID uint) ([]UnreadCount, error) {
+	return r.unread(userID, true, "adoption_requests.adopter_id = ?", userID)
+}
+
+// UnreadForShelter counts, per request for the shelter's pets, the
+// adopters' messages the member has not read.
+func (r *MessageRepository) UnreadForShelter(userID, shelterID uint) ([]UnreadCount, error) {
+	return r.unread(userID, false, "pets.shelter_id = ?", shelterID)
+}
+
+func (r *MessageRepository) unread(userID uint, fromShelter bool, scope string, scopeArg interface{}) ([]UnreadCount, error) {
+	var counts []UnreadCount
+	err := r.db.Model(&models.AdoptionMessage{}).
+		Select("adoption_messages.request_id AS request_id, COUNT(*) AS unread").
+		Joins("JOIN adoption_requests ON adoption_requests.id = adoption_messages.request_id").
+		Joins("JOIN pets ON pets.id = adoption_requests.pet_id").
+		Joins("LEFT JOIN conversation_reads ON conversation_reads.request_id = adoption_messages.request_id AND conversation_reads.user_id = ?", userID).
+		Where(scope, scopeArg).
+		Where("adoption_messages.from_shelter = ?", fromShelter).
+		Where("adoption_messages.id > COALESCE(conversation_reads.last_read_message_id, 0)").
+		Group("adoption_messages.request_id").
+		Order("adoption_messages.request_id").
+		Scan(&counts).Error
+	return counts, err
+}
@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort field")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// PageRequest asks for one page of a list sorted by Sort, one of the fields
+// the list allows. The page starts after Cursor, the Next of the previous
+// page, when there is one, and after Offset rows otherwise.
+type PageRequest struct {
+	Sort   string
+	Desc   bool
+	Size   int
+	Offset int
+	Cursor string
+}
+
+// PageInfo describes a page: Total counts the rows of the whole list and
+// Next is the cursor of the following page, empty on the last one.
+type PageInfo struct {
+	Total int64
+	Next  string
+}
+
+type sortKind int
+
+const (
+	sortNumber sortKind = iota
+	sortText
+	sortTime
+)
+
+// sortField is an SQL expression a list can be sorted by, with the
+// arguments of its placeholders.
+type sortField struct {
+	expr string
+	args []interface{}
+	kind sortKind
+}
+
+// cursor is the position of the last row of a page: its sort value and its
+// id, which breaks ties.
+type cursor struct {
+	Value interface{} `json:"v"`
+	ID    uint        `json:"id"`
+}
+
+// paginate loads into out the page of query that page asks for. fields are
+// the sorts the list allows and idColumn its qualified id column. scopes
+// apply to the rows loaded but not to the count, so they may preload or
+// select more.
+func paginate[T any](query *gorm.DB, fields map[string]sortField, idColumn string, page PageRequest, out *[]T, scopes ...func(*gorm.DB) *gorm.DB) (PageInfo, error) {
+	field, ok := fields[page.Sort]
+	if !ok {
+		return PageInfo{}, ErrInvalidSort
+	}
+
+	var info PageInfo
+	if err := query.Session(&gorm.Session{}).Count(&info.Total).Error; err != nil {
+		return PageInfo{}, err
+	}
+
+	direction, after := "ASC", ">"
+	if page.Desc {
+		direction, after = "DESC", "<"
+	}
+	rows := query.Session(&gorm.Session{}).Scopes(scopes...)
+	if page.Cursor != "" {
+		position, err := decodeCursor(page.Cursor, field.kind)
+		if err != nil {
+			return PageInfo{}, err
+		}
+		args := append([]interface{}{}, field.args...)
+		args = append(args, position.Value)
+		args = append(args, field.args...)
+		args = append(args, position.Value, position.ID)
+		rows = rows.Where("(("+field.expr+") "+after+" ? OR (("+field.expr+") = ? AND "+idColumn+" "+after+" ?))", args...)
+	} else if page.Offset > 0 {
+		rows = rows.Offset(page.Offset)
+	}
+
+	order := clause.OrderBy{Expression: clause.Expr{
+		SQL:                "(" + field.expr + ") " + direction + ", " + idColumn + " " + direction,
+		Vars:               field.args,
+		WithoutParentheses: true,
+	}}
+	if err := rows.Clauses(order).Limit(page.Size + 1).Find(out).Error; err != nil {
+		return PageInfo{}, err
+	}
+	if len(*out) <= page.Size {
+		return info, nil
+	}
+
+	// The extra row only tells that there is a next page. Its cursor holds
+	// the sort value of the last row as the database compares it.
+	*out = (*out)[:page.Size]
+	lastID := uint(reflect.ValueOf((*out)[page.Size-1]).FieldByName("ID").Uint())
+	var value interface{}
+	switch field.kind {
+	case sortNumber:
+		value = new(float64)
+	case sortText:
+		value = new(string)
+	case sortTime:
+		value = new(time.Time)
+	}
+	err := query.Session(&gorm.Session{}).
+		Select(field.expr, field.args...).
+		Where(idColumn+" = ?", lastID).
+		Row().Scan(value)
+	if err != nil {
+		return PageInfo{}, err
+	}
+	info.Next = encodeCursor(cursor{Value: reflect.ValueOf(value).Elem().Interface(), ID: lastID})
+	return info, nil
+}
+
+func encodeCursor(position cursor) string {
+	if t, ok := position.Value.(time.Time); ok {
+		position.Value = t.Format(time.RFC3339Nano)
+	}
+	data, _ := json.Marshal(position)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor reads a cursor back, restoring its value to the type its
+// sort field compares.
+func decodeCursor(raw string, kind sortKind) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	var position cursor
+	if err := json.Unmarshal(data, &position); err != nil || position.ID == 0 {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	switch value := position.Value.(type) {
+	case float64:
+		if kind != sortNumber {
+			return cursor{}, ErrInvalidCursor
+		}
+	case string:
+		switch kind {
+		case sortText:
+		case sortTime:
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return cursor{}, ErrInvalidCursor
+			}
+			position.Value = t
+		default:
+			return cursor{}, ErrInvalidCursor
+		}
+	default:
+		return cursor{}, ErrInvalidCursor
+	}
+	return position, nil
+}
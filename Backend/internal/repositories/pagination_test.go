@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"petmatch/internal/testdb"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	at := time.Date(2024, 3, 9, 17, 4, 5, 123456789, time.FixedZone("PET", -5*3600))
+
+	tests := []struct {
+		name string
+		kind sortKind
+		in   cursor
+	}{
+		{"number", sortNumber, cursor{Value: 2.5, ID: 7}},
+		{"zero number", sortNumber, cursor{Value: 0.0, ID: 1}},
+		{"text", sortText, cursor{Value: "Ñandú, \"el veloz\"", ID: 42}},
+		{"empty text", sortText, cursor{Value: "", ID: 3}},
+		{"time", sortTime, cursor{Value: at, ID: 9}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := decodeCursor(encodeCursor(tt.in), tt.kind)
+			if err != nil {
+				t.Fatalf("decodeCursor: %v", err)
+			}
+			if out.ID != tt.in.ID {
+				t.Errorf("ID = %d, want %d", out.ID, tt.in.ID)
+			}
+			if want, ok := tt.in.Value.(time.Time); ok {
+				if got, ok := out.Value.(time.Time); !ok || !got.Equal(want) {
+					t.Errorf("Value = %v, want %v", out.Value, want)
+				}
+				return
+			}
+			if !reflect.DeepEqual(out.Value, tt.in.Value) {
+				t.Errorf("Value = %#v, want %#v", out.Value, tt.in.Value)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	raw := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+		kind   sortKind
+	}{
+		{"not base64", "%%%", sortText},
+		{"not json", raw("nope"), sortText},
+		{"missing id", raw(`{"v":"a"}`), sortText},
+		{"zero id", raw(`{"v":"a","id":0}`), sortText},
+		{"number for a text sort", raw(`{"v":1,"id":1}`), sortText},
+		{"text for a number sort", raw(`{"v":"1","id":1}`), sortNumber},
+		{"text that is not a time", raw(`{"v":"yesterday","id":1}`), sortTime},
+		{"null value", raw(`{"v":null,"id":1}`), sortText},
+		{"object value", raw(`{"v":{},"id":1}`), sortNumber},
+	}
+
+	for _, tt := range tests {
+		if _, err := decodeCursor(tt.cursor, tt.kind); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: error = %v, want ErrInvalidCursor", tt.name, err)
+		}
+	}
+}
+
+// pageRow is a list row for the paginate tests.
+type pageRow struct {
+	ID        uint
+	Name      string
+	Score     float64
+	CreatedAt time.Time
+}
+
+func TestPaginateFollowsCursors(t *testing.T) {
+	db := testdb.Open(t, &pageRow{})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Repeated values make the id break ties across page boundaries.
+	rows := []pageRow{
+		{Name: "Toby", Score: 3, CreatedAt: base.Add(2 * time.Hour)},
+		{Name: "Luna", Score: 1.5, CreatedAt: base},
+		{Name: "Toby", Score: 3, CreatedAt: base.Add(time.Hour)},
+		{Name: "Max", Score: 0, CreatedAt: base.Add(time.Hour)},
+		{Name: "Ñoño", Score: 3, CreatedAt: base.Add(time.Millisecond)},
+		{Name: "Luna", Score: 7.25, CreatedAt: base.Add(time.Hour)},
+		{Name: "Bruno", Score: 1.5, CreatedAt: base.Add(3 * time.Hour)},
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]sortField{
+		"name":      {expr: "name", kind: sortText},
+		"score":     {expr: "score", kind: sortNumber},
+		"createdAt": {expr: "created_at", kind: sortTime},
+	}
+
+	tests := []struct {
+		sort    string
+		desc    bool
+		compare func(a, b pageRow) int
+	}{
+		{"name", false, func(a, b pageRow) int { return cmp.Compare(a.Name, b.Name) }},
+		{"name", true, func(a, b pageRow) int { return cmp.Compare(a.Name, b.Name) }},
+		{"score", false, func(a, b pageRow) int { return cmp.Compare(a.Score, b.Score) }},
+		{"score", true, func(a, b pageRow) int { return cmp.Compare(a.Score, b.Score) }},
+		{"createdAt", false, func(a, b pageRow) int { return a.CreatedAt.Compare(b.CreatedAt) }},
+		{"createdAt", true, func(a, b pageRow) int { return a.CreatedAt.Compare(b.CreatedAt) }},
+	}
+
+	for _, tt := range tests {
+		want := make([]uint, 0, len(rows))
+		sorted := append([]pageRow(nil), rows...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			c := tt.compare(sorted[i], sorted[j])
+			if c == 0 {
+				c = cmp.Compare(sorted[i].ID, sorted[j].ID)
+			}
+			if tt.desc {
+				return c > 0
+			}
+			return c < 0
+		})
+		for _, row := range sorted {
+			want = append(want, row.ID)
+		}
+
+		for size := 1; size <= len(rows); size++ {
+			var got []uint
+			page := PageRequest{Sort: tt.sort, Desc: tt.desc, Size: size}
+			for pages := 0; ; pages++ {
+				if pages > len(rows) {
+					t.Fatalf("%s desc=%v size=%d: cursors never reached the end", tt.sort, tt.desc, size)
+				}
+				var out []pageRow
+				info, err := paginate(db.Model(&pageRow{}), fields, "id", page, &out)
+				if err != nil {
+					t.Fatalf("%s desc=%v size=%d: %v", tt.sort, tt.desc, size, err)
+				}
+				if info.Total != int64(len(rows)) {
+					t.Fatalf("%s desc=%v size=%d: total %d, want %d", tt.sort, tt.desc, size, info.Total, len(rows))
+				}
+				for _, row := range out {
+					got = append(got, row.ID)
+				}
+				if info.Next == "" {
+					break
+				}
+				page.Cursor = info.Next
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s desc=%v size=%d: ids %v, want %v", tt.sort, tt.desc, size, got, want)
+			}
+		}
+	}
+}
+
+func TestPaginateRejectsUnknownSort(t *testing.T) {
+	db := testdb.Open(t, &pageRow{})
+	var out []pageRow
+	_, err := paginate(db.Model(&pageRow{}), map[string]sortField{}, "id", PageRequest{Sort: "name", Size: 10}, &out)
+	if !errors.Is(err, ErrInvalidSort) {
+		t.Fatalf("error = %v, want ErrInvalidSort", err)
+	}
+}
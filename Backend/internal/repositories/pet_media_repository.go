@@ -0,0 +1,169 @@
+package repositories
+
+import (
+	"errors"
+
+	"petmatch/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// errMediaChanged rolls back a reorder whose list no longer matches the
+// gallery.
+var errMediaChanged = errors.New("pet media changed")
+
+type PetMediaRepository struct {
+	db *gorm.DB
+}
+
+func NewPetMediaRepository(db *gorm.DB) *PetMediaRepository {
+	return &PetMediaRepository{db: db}
+}
+
+// ListByPet returns the pet's gallery in display order.
+func (r *PetMediaRepository) ListByPet(petID uint) ([]models.PetMedia, error) {
+	var media []models.PetMedia
+	err := r.db.Where("pet_id = ?", petID).Order("position, id").Find(&media).Error
+	return media, err
+}
+
+func (r *PetMediaRepository) Find(petID, id uint) (*models.PetMedia, error) {
+	var media models.PetMedia
+	if err := r.db.Where("pet_id = ?", petID).First(&media, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &media, nil
+}
+
+// Create adds the media at the end of the gallery. The first photo becomes
+// the cover.
+func (r *PetMediaRepository) Create(media *models.PetMedia) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var last *int
+		if err := tx.Model(&models.PetMedia{}).Where("pet_id = ?", media.PetID).
+			Select("MAX(position)").Scan(&last).Error; err != nil {
+			return err
+		}
+		media.Position = 0
+		if last != nil {
+			media.Position = *last + 1
+		}
+
+		if media.Kind == models.PetMediaPhoto {
+			var covers int64
+			if err := tx.Model(&models.PetMedia{}).Where("pet_id = ? AND cover = ?", media.PetID, true).
+				Count(&covers).Error; err != nil {
+				return err
+			}
+			media.Cover = covers == 0
+		}
+		return tx.Create(media).Error
+	})
+}
+
+func (r *PetMediaRepository) UpdateCaption(media *models.PetMedia) error {
+	return r.db.Model(media).Update("caption", media.Caption).Error
+}
+
+// SetCover makes the photo the pet's only cover.
+func (r *PetMediaRepository) SetCover(media *models.PetMedia) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.PetMedia{}).Where("pet_id = ? AND cover = ?", media.PetID, true).
+			Update("cover", false).Error; err != nil {
+			return err
+		}
+		media.Cover = true
+		return tx.Model(media).Update("cover", true).Error
+	})
+}
+
+// Reorder positions the pet's media in the order of ids, which must list
+// the whole gallery. It reports false when it does not.
+func (r *PetMediaRepository) Reorder(petID uint, ids []uint) (bool, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.PetMedia{}).Where("pet_id = ?", petID).Count(&count).Error; err != nil {
+			return err
+		}
+		if int(count) != len(ids) {
+			return errMediaChanged
+		}
+		for position, id := range ids {
+			result := tx.Model(&models.PetMedia{}).Where("id = ? AND pet_id = ?", id, petID).
+				Update("position", position)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errMediaChanged
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errMediaChanged) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Delete removes the media. When it was the cover, the next photo of the
+// gallery takes its place.
+func (r *PetMediaRepository) Delete(media *models.PetMedia) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.PetMedia{}, media.ID).Error; err != nil {
+			return err
+		}
+		if !media.Cover {
+			return nil
+		}
+
+		var next models.PetMedia
+		err := tx.Where("pet_id = ? AND kind = ?", media.PetID, models.PetMediaPhoto).
+			Order("position, id").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&next).Update("cover", true).Error
+	})
+}
+
+// DeleteByPet removes the pet's whole gallery and returns what it held.
+func (r *PetMediaRepository) DeleteByPet(petID uint) ([]models.PetMedia, error) {
+	var media []models.PetMedia
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("pet_id = ?", petID).Find(&media).Error; err != nil {
+			return err
+		}
+		return tx.Where("pet_id = ?", petID).Delete(&models.PetMedia{}).Error
+	})
+	return media, err
+}
+
+// ListPending returns the photos still waiting to be processed, oldest
+// first.
+func (r *PetMediaRepository) ListPending(limit int) ([]models.PetMedia, error) {
+	var media []models.PetMedia
+	err := r.db.Where("status = ?", models.PetMediaProcessing).Order("id").Limit(limit).Find(&media).Error
+	return media, err
+}
+
+// FinishProcessing stores the outcome of processing the photo. It reports
+// false when the photo was deleted or processed in the meantime.
+func (r *PetMediaRepository) FinishProcessing(media *models.PetMedia) (bool, error) {
+	result := r.db.Model(&models.PetMedia{}).
+		Where("id = ? AND status = ?", media.ID, models.PetMediaProcessing).
+		Updates(map[string]interface{}{
+			"status":        media.Status,
+			"web_key":       media.WebKey,
+			"web_url":       media.WebURL,
+			"thumbnail_key": media.ThumbnailKey,
+			"thumbnail_url": media.ThumbnailURL,
+		})
+	return result.RowsAffected == 1, result.Error
+}
@@ -2,14 +2,28 @@ package repositories
 
 import (
 	"errors"
+	"html"
+	"math"
+	"strings"
+	"unicode"
 
 	"petmatch/internal/models"
 
 	"gorm.io/gorm"
 )
 
+// Full-text search marks matches in snippets with these characters, which
+// pet texts do not use, so that the text around them can be escaped.
+const (
+	snippetMatchStart = "\x02"
+	snippetMatchEnd   = "\x03"
+)
+
+var ErrSearchUnavailable = errors.New("pet search is not available")
+
 type PetRepository struct {
-	db *gorm.DB
+	db     *gorm.DB
+	search bool
 }
 
 type PetFilter struct {
@@ -20,10 +34,21 @@ type PetFilter struct {
 	ShelterID *uint
 	MinAge    *uint
 	MaxAge    *uint
+	// Near is where distances are measured from.
+	Near *Point
+	// Query is searched for in the name, breed, description and location.
+	Query string
+}
+
+type Point struct {
+	Latitude  float64
+	Longitude float64
 }
 
-func NewPetRepository(db *gorm.DB) *PetRepository {
-	return &PetRepository{db: db}
+// NewPetRepository takes whether the full-text index of the pets exists,
+// which needs SQLite with FTS5.
+func NewPetRepository(db *gorm.DB, search bool) *PetRepository {
+	return &PetRepository{db: db, search: search}
 }
 
 func (r *PetRepository) Create(pet *models.Pet) error {
@@ -49,41 +74,154 @@ func (r *PetRepository) FindByID(id uint) (*models.Pet, error) {
 	return &pet, nil
 }
 
-func (r *PetRepository) List(filter PetFilter) ([]models.Pet, error) {
-	query := r.db.Preload("Shelter").Model(&models.Pet{})
+// FindWithMedia returns the pet with its gallery, leaving out the photos
+// that are not ready to be shown.
+func (r *PetRepository) FindWithMedia(id uint) (*models.Pet, error) {
+	var pet models.Pet
+	err := r.db.Scopes(withCoverThumbnail).Preload("Shelter").
+		Preload("Media", func(db *gorm.DB) *gorm.DB {
+			return db.Where("status = ?", models.PetMediaReady).Order("position, id")
+		}).
+		First(&pet, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &pet, nil
+}
+
+// List returns a page of pets without their galleries; each carries the
+// thumbnail of its cover photo only, to keep the catalog small. Pets sort
+// by age, name, created_at, with filter.Near, distance and, with
+// filter.Query, relevance. Searching also fills each pet's Snippet.
+func (r *PetRepository) List(filter PetFilter, page PageRequest) ([]models.Pet, PageInfo, error) {
+	query := r.db.Model(&models.Pet{})
+	fields := petSortFields(filter.Near)
+	selectColumns := withCoverThumbnail
+
+	match := searchMatch(filter.Query)
+	if match != "" {
+		if !r.search {
+			return nil, PageInfo{}, ErrSearchUnavailable
+		}
+		query = query.Joins("JOIN pets_fts ON pets_fts.rowid = pets.id").Where("pets_fts MATCH ?", match)
+		// bm25 ranks better matches lower; the name weighs the most.
+		fields["relevance"] = sortField{expr: "bm25(pets_fts, 10.0, 5.0, 1.0, 2.0)", kind: sortNumber}
+		selectColumns = withSnippet
+	} else if strings.TrimSpace(filter.Query) != "" {
+		// A query without words matches nothing to rank by; the list keeps
+		// the order in which the pets were added.
+		fields["relevance"] = sortField{expr: "0.0", kind: sortNumber}
+	}
 
 	if filter.Species != "" {
-		query = query.Where("species = ?", filter.Species)
+		query = query.Where("pets.species = ?", filter.Species)
 	}
 
 	if filter.Breed != "" {
-		query = query.Where("breed = ?", filter.Breed)
+		query = query.Where("pets.breed = ?", filter.Breed)
 	}
 
 	if filter.Location != "" {
-		query = query.Where("location LIKE ?", "%"+filter.Location+"%")
+		query = query.Where("pets.location LIKE ?", "%"+filter.Location+"%")
 	}
 
 	if filter.Status != nil {
-		query = query.Where("status = ?", *filter.Status)
+		query = query.Where("pets.status = ?", *filter.Status)
 	}
 
 	if filter.ShelterID != nil {
-		query = query.Where("shelter_id = ?", *filter.ShelterID)
+		query = query.Where("pets.shelter_id = ?", *filter.ShelterID)
 	}
 
 	if filter.MinAge != nil {
-		query = query.Where("age >= ?", *filter.MinAge)
+		query = query.Where("pets.age >= ?", *filter.MinAge)
 	}
 
 	if filter.MaxAge != nil {
-		query = query.Where("age <= ?", *filter.MaxAge)
+		query = query.Where("pets.age <= ?", *filter.MaxAge)
 	}
 
 	var pets []models.Pet
-	if err := query.Order("created_at desc").Find(&pets).Error; err != nil {
-		return nil, err
+	info, err := paginate(query, fields, "pets.id", page, &pets,
+		selectColumns, func(db *gorm.DB) *gorm.DB { return db.Preload("Shelter") })
+	if err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	for i := range pets {
+		if pets[i].Snippet != nil {
+			snippet := highlight(*pets[i].Snippet)
+			pets[i].Snippet = &snippet
+		}
+	}
+	return pets, info, nil
+}
+
+// petSortFields lists the sorts of the catalog. Distance compares squared
+// degrees, with longitude shrunk by the cosine of the origin's latitude:
+// close enough to order pets by how far they are, and SQLite has no
+// trigonometry. Pets without a location come last.
+func petSortFields(near *Point) map[string]sortField {
+	fields := map[string]sortField{
+		"age":        {expr: "pets.age", kind: sortNumber},
+		"name":       {expr: "pets.name COLLATE NOCASE", kind: sortText},
+		"created_at": {expr: "pets.created_at", kind: sortTime},
+	}
+	if near != nil {
+		scale := math.Cos(near.Latitude * math.Pi / 180)
+		fields["distance"] = sortField{
+			expr: "COALESCE((pets.latitude - ?) * (pets.latitude - ?) + " +
+				"((pets.longitude - ?) * ?) * ((pets.longitude - ?) * ?), 1e9)",
+			args: []interface{}{near.Latitude, near.Latitude, near.Longitude, scale, near.Longitude, scale},
+			kind: sortNumber,
+		}
+	}
+	return fields
+}
+
+// withCoverThumbnail selects the thumbnail of each pet's cover photo into
+// CoverThumbnailURL.
+func withCoverThumbnail(db *gorm.DB) *gorm.DB {
+	return db.Select("pets.*, (?) AS cover_thumbnail_url", coverThumbnail(db))
+}
+
+// withSnippet selects, besides the cover thumbnail, the passage of the
+// searched pet that best matches, with its matches marked.
+func withSnippet(db *gorm.DB) *gorm.DB {
+	return db.Select("pets.*, (?) AS cover_thumbnail_url, snippet(pets_fts, -1, ?, ?, ?, 16) AS snippet",
+		coverThumbnail(db), snippetMatchStart, snippetMatchEnd, "…")
+}
+
+func coverThumbnail(db *gorm.DB) *gorm.DB {
+	return db.Session(&gorm.Session{NewDB: true}).
+		Model(&models.PetMedia{}).
+		Select("thumbnail_url").
+		Where("pet_media.pet_id = pets.id AND pet_media.cover = ? AND pet_media.status = ?", true, models.PetMediaReady).
+		Limit(1)
+}
+
+// searchMatch turns what an adopter typed into an FTS5 query that matches
+// pets with any of its words, or the start of them. Ranking puts the pets
+// that match more of them first. It is empty when there are no words.
+func searchMatch(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > 16 {
+		words = words[:16]
 	}
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = `"` + word + `"*`
+	}
+	return strings.Join(terms, " OR ")
+}
 
-	return pets, nil
+// highlight escapes a snippet for HTML and wraps its matches in <mark>.
+func highlight(snippet string) string {
+	return strings.NewReplacer(snippetMatchStart, "<mark>", snippetMatchEnd, "</mark>").
+		Replace(html.EscapeString(snippet))
 }
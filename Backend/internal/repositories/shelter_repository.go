@@ -0,0 +1,218 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"petmatch/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type ShelterRepository struct {
+	db *gorm.DB
+}
+
+func NewShelterRepository(db *gorm.DB) *ShelterRepository {
+	return &ShelterRepository{db: db}
+}
+
+// CreateWithOwner stores the shelter and makes owner its first member. The
+// owner is created too when it has not been saved yet.
+func (r *ShelterRepository) CreateWithOwner(shelter *models.Shelter, owner *models.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if owner.ID == 0 {
+			if err := tx.Create(owner).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(shelter).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.ShelterMember{
+			ShelterID: shelter.ID,
+			UserID:    owner.ID,
+			Role:      models.ShelterRoleOwner,
+		}).Error
+	})
+}
+
+func (r *ShelterRepository) Update(shelter *models.Shelter) error {
+	return r.db.Save(shelter).Error
+}
+
+func (r *ShelterRepository) FindByID(id uint) (*models.Shelter, error) {
+	var shelter models.Shelter
+	if err := r.db.First(&shelter, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &shelter, nil
+}
+
+func (r *ShelterRepository) List(approved *bool) ([]models.Shelter, error) {
+	query := r.db.Model(&models.Shelter{})
+	if approved != nil {
+		query = query.Where("is_approved = ?", *approved)
+	}
+
+	var shelters []models.Shelter
+	if err := query.Order("created_at desc").Find(&shelters).Error; err != nil {
+		return nil, err
+	}
+	return shelters, nil
+}
+
+// Approve marks the shelter as approved and activates its members that were
+// waiting for it. Suspended or rejected members keep their status.
+func (r *ShelterRepository) Approve(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Shelter{}).
+			Where("id = ?", id).
+			Update("is_approved", true).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id IN (?) AND status = ?",
+				tx.Model(&models.ShelterMember{}).Select("user_id").Where("shelter_id = ?", id),
+				models.UserStatusPending).
+			Updates(map[string]interface{}{"is_approved": true, "status": models.UserStatusActive}).Error
+	})
+}
+
+// FindMembership returns the membership of the user, with its shelter, or nil
+// when the user does not belong to any shelter.
+func (r *ShelterRepository) FindMembership(userID uint) (*models.ShelterMember, error) {
+	var member models.ShelterMember
+	if err := r.db.Preload("Shelter").Where("user_id = ?", userID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *ShelterRepository) FindMember(shelterID, userID uint) (*models.ShelterMember, error) {
+	var member models.ShelterMember
+	if err := r.db.Preload("User").
+		Where("shelter_id = ? AND user_id = ?", shelterID, userID).
+		First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (r *ShelterRepository) ListMembers(shelterID uint) ([]models.ShelterMember, error) {
+	var members []models.ShelterMember
+	if err := r.db.Preload("User").
+		Where("shelter_id = ?", shelterID).
+		Order("created_at asc").
+		Find(&members).Error; err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+func (r *ShelterRepository) CountOwners(shelterID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.ShelterMember{}).
+		Where("shelter_id = ? AND role = ?", shelterID, models.ShelterRoleOwner).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *ShelterRepository) UpdateMemberRole(member *models.ShelterMember) error {
+	return r.db.Model(&models.ShelterMember{}).
+		Where("id = ?", member.ID).
+		Update("role", member.Role).Error
+}
+
+func (r *ShelterRepository) RemoveMember(member *models.ShelterMember) error {
+	return r.db.Delete(&models.ShelterMember{}, member.ID).Error
+}
+
+// CreateInvitation stores the invitation, replacing any pending one sent to
+// the same address for the same shelter.
+func (r *ShelterRepository) CreateInvitation(invitation *models.ShelterInvitation) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("shelter_id = ? AND email = ? AND accepted_at IS NULL", invitation.ShelterID, invitation.Email).
+			Delete(&models.ShelterInvitation{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(invitation).Error
+	})
+}
+
+func (r *ShelterRepository) FindInvitationByHash(tokenHash string) (*models.ShelterInvitation, error) {
+	var invitation models.ShelterInvitation
+	if err := r.db.Preload("Shelter").Where("token_hash = ?", tokenHash).First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+func (r *ShelterRepository) ListPendingInvitations(shelterID uint, now time.Time) ([]models.ShelterInvitation, error) {
+	var invitations []models.ShelterInvitation
+	if err := r.db.
+		Where("shelter_id = ? AND accepted_at IS NULL AND expires_at > ?", shelterID, now).
+		Order("created_at desc").
+		Find(&invitations).Error; err != nil {
+		return nil, err
+	}
+	return invitations, nil
+}
+
+// DeleteInvitation removes a pending invitation of the shelter. It reports
+// false when there was none with that id.
+func (r *ShelterRepository) DeleteInvitation(shelterID, id uint) (bool, error) {
+	result := r.db.
+		Where("id = ? AND shelter_id = ? AND accepted_at IS NULL", id, shelterID).
+		Delete(&models.ShelterInvitation{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// AcceptInvitation burns the invitation and adds user to the shelter in a
+// single transaction. The user is created when it has not been saved yet,
+// otherwise its changes are stored. It reports false when the invitation
+// was accepted concurrently.
+func (r *ShelterRepository) AcceptInvitation(invitation *models.ShelterInvitation, user *models.User, now time.Time) (bool, error) {
+	accepted := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.ShelterInvitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Update("accepted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return nil
+		}
+
+		if err := tx.Save(user).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.ShelterMember{
+			ShelterID: invitation.ShelterID,
+			UserID:    user.ID,
+			Role:      invitation.Role,
+		}).Error; err != nil {
+			return err
+		}
+
+		accepted = true
+		return nil
+	})
+	return accepted, err
+}
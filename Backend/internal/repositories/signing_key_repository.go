@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"time"
+
+	"petmatch/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type SigningKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewSigningKeyRepository(db *gorm.DB) *SigningKeyRepository {
+	return &SigningKeyRepository{db: db}
+}
+
+func (r *SigningKeyRepository) Create(key *models.SigningKey) error {
+	return r.db.Create(key).Error
+}
+
+// ListUsable returns the active key(s) and the keys retired after since.
+func (r *SigningKeyRepository) ListUsable(since time.Time) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	if err := r.db.
+		Where("retired_at IS NULL OR retired_at > ?", since).
+		Order("created_at asc").
+		Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// SealPrivateKey replaces a key stored in plaintext with its encrypted form,
+// unless another instance already did.
+func (r *SigningKeyRepository) SealPrivateKey(id, plaintext, sealed string) error {
+	return r.db.Model(&models.SigningKey{}).
+		Where("id = ? AND private_key = ?", id, plaintext).
+		Update("private_key", sealed).Error
+}
+
+func (r *SigningKeyRepository) Retire(id string, at time.Time) error {
+	return r.db.Model(&models.SigningKey{}).
+		Where("id = ? AND retired_at IS NULL", id).
+		Update("retired_at", at).Error
+}
+
+func (r *SigningKeyRepository) DeleteRetiredBefore(before time.Time) error {
+	return r.db.Where("retired_at IS NOT NULL AND retired_at < ?", before).
+		Delete(&models.SigningKey{}).Error
+}
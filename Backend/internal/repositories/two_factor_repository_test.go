@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"testing"
+
+	"petmatch/internal/models"
+	"petmatch/internal/testdb"
+)
+
+func TestTwoFactorMarkStepUsedRefusesReplay(t *testing.T) {
+	db := testdb.Open(t, &models.User{}, &models.TwoFactor{}, &models.RecoveryCode{})
+	user := models.User{Name: "Ana", Email: "ana@example.com", PasswordHash: "x", Role: models.RoleAdopter}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	repo := NewTwoFactorRepository(db)
+	if err := repo.Save(&models.TwoFactor{UserID: user.ID, Secret: "GEZDGNBVGY3TQOJQ", LastUsedStep: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The steps are used in this order; each one must be newer than every
+	// step accepted before it.
+	tests := []struct {
+		name  string
+		step  int64
+		fresh bool
+	}{
+		{"step used at enrollment", 100, false},
+		{"older step", 99, false},
+		{"next step", 101, true},
+		{"same step again", 101, false},
+		{"skipped ahead", 105, true},
+		{"step between the last two", 103, false},
+	}
+
+	for _, tt := range tests {
+		fresh, err := repo.MarkStepUsed(user.ID, tt.step)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if fresh != tt.fresh {
+			t.Errorf("%s: MarkStepUsed(%d) = %v, want %v", tt.name, tt.step, fresh, tt.fresh)
+		}
+	}
+}
+
+func TestTwoFactorConsumeRecoveryCodeOnce(t *testing.T) {
+	db := testdb.Open(t, &models.User{}, &models.TwoFactor{}, &models.RecoveryCode{})
+	user := models.User{Name: "Ana", Email: "ana@example.com", PasswordHash: "x", Role: models.RoleAdopter}
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	repo := NewTwoFactorRepository(db)
+	if err := repo.ReplaceRecoveryCodes(user.ID, []string{"hash-a", "hash-b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		hash     string
+		consumed bool
+	}{
+		{"hash-a", true},
+		{"hash-a", false},
+		{"hash-c", false},
+		{"hash-b", true},
+	}
+
+	for _, tt := range tests {
+		consumed, err := repo.ConsumeRecoveryCode(user.ID, tt.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if consumed != tt.consumed {
+			t.Errorf("ConsumeRecoveryCode(%s) = %v, want %v", tt.hash, consumed, tt.consumed)
+		}
+	}
+}
@@ -15,6 +15,7 @@ type UserRepository struct {
 type UserFilter struct {
 	Role     *models.UserRole
 	Approved *bool
+	Status   *models.UserStatus
 }
 
 func NewUserRepository(db *gorm.DB) *UserRepository {
@@ -29,6 +30,23 @@ func (r *UserRepository) Update(user *models.User) error {
 	return r.db.Save(user).Error
 }
 
+// DemoteAdmin gives an admin another role unless no other active admin
+// would be left. The check and the change are a single statement, so two
+// admins demoting each other cannot both succeed. It reports false when the
+// user was the last admin or no longer is one.
+func (r *UserRepository) DemoteAdmin(user *models.User, role models.UserRole) (bool, error) {
+	otherAdmins := r.db.Model(&models.User{}).
+		Select("COUNT(*)").
+		Where("role = ? AND status = ? AND id <> ?", models.RoleAdmin, models.UserStatusActive, user.ID)
+	result := r.db.Model(&models.User{}).
+		Where("id = ? AND role = ? AND (?) > 0", user.ID, models.RoleAdmin, otherAdmins).
+		Update("role", role)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
 func (r *UserRepository) FindByEmail(email string) (*models.User, error) {
 	var user models.User
 	if err := r.db.Where("email = ?", email).First(&user).Error; err != nil {
@@ -51,7 +69,15 @@ func (r *UserRepository) FindByID(id uint) (*models.User, error) {
 	return &user, nil
 }
 
-func (r *UserRepository) List(filter UserFilter) ([]models.User, error) {
+// userSortFields lists the sorts of the user list.
+var userSortFields = map[string]sortField{
+	"name":       {expr: "users.name COLLATE NOCASE", kind: sortText},
+	"email":      {expr: "users.email", kind: sortText},
+	"created_at": {expr: "users.created_at", kind: sortTime},
+}
+
+// List returns a page of users, sorted by name, email or created_at.
+func (r *UserRepository) List(filter UserFilter, page PageRequest) ([]models.User, PageInfo, error) {
 	query := r.db.Model(&models.User{})
 
 	if filter.Role != nil {
@@ -62,10 +88,15 @@ func (r *UserRepository) List(filter UserFilter) ([]models.User, error) {
 		query = query.Where("is_approved = ?", *filter.Approved)
 	}
 
+	if filter.Status != nil {
+		query = query.Where("status = ?", *filter.Status)
+	}
+
 	var users []models.User
-	if err := query.Order("created_at desc").Find(&users).Error; err != nil {
-		return nil, err
+	info, err := paginate(query, userSortFields, "users.id", page, &users)
+	if err != nil {
+		return nil, PageInfo{}, err
 	}
 
-	return users, nil
+	return users, info, nil
 }
@@ -0,0 +1,53 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"petmatch/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type UserTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewUserTokenRepository(db *gorm.DB) *UserTokenRepository {
+	return &UserTokenRepository{db: db}
+}
+
+func (r *UserTokenRepository) Create(token *models.UserToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *UserTokenRepository) FindByHash(hash string, purpose models.UserTokenPurpose) (*models.UserToken, error) {
+	var token models.UserToken
+	if err := r.db.Where("token_hash = ? AND purpose = ?", hash, purpose).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// Consume marks the token as used and reports whether this call was the one
+// that did it.
+func (r *UserTokenRepository) Consume(id uint) (bool, error) {
+	result := r.db.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// InvalidateForUser consumes every outstanding token of the given purpose so
+// only the most recently issued one stays usable.
+func (r *UserTokenRepository) InvalidateForUser(userID uint, purpose models.UserTokenPurpose) error {
+	return r.db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,270 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"petmatch/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type VisitRepository struct {
+	db *gorm.DB
+}
+
+func NewVisitRepository(db *gorm.DB) *VisitRepository {
+	return &VisitRepository{db: db}
+}
+
+// errSlotTaken rolls back a booking whose slot was booked concurrently.
+var errSlotTaken = errors.New("visit slot is already booked")
+
+var ErrActiveBookingExists = errors.New("the request already has a booked visit")
+
+func (r *VisitRepository) CreateSlot(slot *models.VisitSlot) error {
+	return r.db.Omit("Shelter").Create(slot).Error
+}
+
+func (r *VisitRepository) FindSlot(shelterID, id uint) (*models.VisitSlot, error) {
+	var slot models.VisitSlot
+	if err := r.db.Where("shelter_id = ?", shelterID).First(&slot, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &slot, nil
+}
+
+// DeleteSlot removes the slot unless it has been booked in the meantime.
+func (r *VisitRepository) DeleteSlot(id uint) (bool, error) {
+	result := r.db.Where("id = ? AND booking_id IS NULL", id).Delete(&models.VisitSlot{})
+	return result.RowsAffected == 1, result.Error
+}
+
+// ListSlots returns the shelter's slots that have not ended by from, soonest
+// first.
+func (r *VisitRepository) ListSlots(shelterID uint, from time.Time) ([]models.VisitSlot, error) {
+	var slots []models.VisitSlot
+	if err := r.db.Where("shelter_id = ? AND ends_at > ?", shelterID, from).
+		Order("starts_at asc, id asc").
+		Find(&slots).Error; err != nil {
+		return nil, err
+	}
+	return slots, nil
+}
+
+// ListFreeSlots returns the shelter's slots that start after from and are
+// not booked, soonest first.
+func (r *VisitRepository) ListFreeSlots(shelterID uint, from time.Time) ([]models.VisitSlot, error) {
+	var slots []models.VisitSlot
+	if err := r.db.Where("shelter_id = ? AND starts_at > ? AND booking_id IS NULL", shelterID, from).
+		Order("starts_at asc, id asc").
+		Find(&slots).Error; err != nil {
+		return nil, err
+	}
+	return slots, nil
+}
+
+// ListBookingsForSlots returns the bookings holding the slots, with the
+// request, its pet and its adopter.
+func (r *VisitRepository) ListBookingsForSlots(slotIDs []uint) ([]models.VisitBooking, error) {
+	var bookings []models.VisitBooking
+	if len(slotIDs) == 0 {
+		return bookings, nil
+	}
+	if err := r.db.Preload("Request.Pet").
+		Preload("Request.Adopter").
+		Where("slot_id IN ? AND status = ?", slotIDs, models.VisitStatusBooked).
+		Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+	return bookings, nil
+}
+
+// FindActiveBooking returns the request's booked visit, with its slot, or
+// nil when it has none.
+func (r *VisitRepository) FindActiveBooking(requestID uint) (*models.VisitBooking, error) {
+	var booking models.VisitBooking
+	if err := r.db.Preload("Slot").
+		Where("request_id = ? AND status = ?", requestID, models.VisitStatusBooked).
+		First(&booking).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &booking, nil
+}
+
+// Book stores the booking and claims its slot in one transaction. It
+// reports false, and stores nothing, when the slot was already booked, and
+// ErrActiveBookingExists when the request already has a booked visit. The
+// transaction starts by writing to the request's row, so concurrent bookings
+// for one request run one after the other; the partial unique index on
+// booked visits backs the check up.
+func (r *VisitRepository) Book(booking *models.VisitBooking) (bool, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE adoption_requests SET id = id WHERE id = ?", booking.RequestID).Error; err != nil {
+			return err
+		}
+
+		var active int64
+		if err := tx.Model(&models.VisitBooking{}).
+			Where("request_id = ? AND status = ?", booking.RequestID, models.VisitStatusBooked).
+			Count(&active).Error; err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrActiveBookingExists
+		}
+
+		if err := tx.Omit("Request", "Slot").Create(booking).Error; err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				return ErrActiveBookingExists
+			}
+			return err
+		}
+		return claimSlot(tx, booking.SlotID, booking.ID)
+	})
+	if errors.Is(err, errSlotTaken) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Reschedule moves the booking from its current slot to slotID, frees the
+// old slot and bumps the booking's sequence. A reminder is sent again for
+// the new time. It reports false when slotID was already booked or the
+// booking is no longer active.
+func (r *VisitRepository) Reschedule(booking *models.VisitBooking, slotID uint, at time.Time) (bool, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.VisitBooking{}).
+			Where("id = ? AND slot_id = ? AND status = ?", booking.ID, booking.SlotID, models.VisitStatusBooked).
+			Updates(map[string]interface{}{
+				"slot_id":          slotID,
+				"sequence":         gorm.Expr("sequence + 1"),
+				"reminder_sent_at": nil,
+				"updated_at":       at,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errSlotTaken
+		}
+		if err := claimSlot(tx, slotID, booking.ID); err != nil {
+			return err
+		}
+		return tx.Model(&models.VisitSlot{}).
+			Where("id = ? AND booking_id = ?", booking.SlotID, booking.ID).
+			Update("booking_id", nil).Error
+	})
+	if errors.Is(err, errSlotTaken) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Cancel cancels the booking and frees its slot. It reports false when the
+// booking was no longer active.
+func (r *VisitRepository) Cancel(booking *models.VisitBooking, at time.Time) (bool, error) {
+	cancelled := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.VisitBooking{}).
+			Where("id = ? AND status = ?", booking.ID, models.VisitStatusBooked).
+			Updates(map[string]interface{}{
+				"status":       models.VisitStatusCancelled,
+				"sequence":     gorm.Expr("sequence + 1"),
+				"cancelled_at": at,
+				"updated_at":   at,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return nil
+		}
+		cancelled = true
+		return tx.Model(&models.VisitSlot{}).
+			Where("id = ? AND booking_id = ?", booking.SlotID, booking.ID).
+			Update("booking_id", nil).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return cancelled, nil
+}
+
+// ListDueReminders returns the booked visits starting between from and
+// until that have not been reminded yet, with everything the reminder
+// mentions.
+func (r *VisitRepository) ListDueReminders(from, until time.Time) ([]models.VisitBooking, error) {
+	var bookings []models.VisitBooking
+	if err := r.db.Joins("Slot").
+		Preload("Request.Pet").
+		Preload("Request.Adopter").
+		Where("visit_bookings.status = ? AND visit_bookings.reminder_sent_at IS NULL", models.VisitStatusBooked).
+		Where("Slot.starts_at > ? AND Slot.starts_at <= ?", from, until).
+		Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+	return bookings, nil
+}
+
+// MarkReminded records that the booking's reminder went out. It reports
+// false when another process got to it first.
+func (r *VisitRepository) MarkReminded(id uint, at time.Time) (bool, error) {
+	result := r.db.Model(&models.VisitBooking{}).
+		Where("id = ? AND reminder_sent_at IS NULL", id).
+		Update("reminder_sent_at", at)
+	return result.RowsAffected == 1, result.Error
+}
+
+// claimSlot points the slot to the booking if nobody holds it yet.
+func claimSlot(tx *gorm.DB, slotID, bookingID uint) error {
+	result := tx.Model(&models.VisitSlot{}).
+		Where("id = ? AND booking_id IS NULL", slotID).
+		Update("booking_id", bookingID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return errSlotTaken
+	}
+	return nil
+}
+
+// cancelVisits cancels the booked visits of requests that were closed and
+// frees their slots, within the transaction closing them.
+func cancelVisits(tx *gorm.DB, requestIDs []uint, at time.Time) error {
+	var bookingIDs []uint
+	if err := tx.Model(&models.VisitBooking{}).
+		Where("request_id IN ? AND status = ?", requestIDs, models.VisitStatusBooked).
+		Pluck("id", &bookingIDs).Error; err != nil {
+		return err
+	}
+	if len(bookingIDs) == 0 {
+		return nil
+	}
+	if err := tx.Model(&models.VisitBooking{}).
+		Where("id IN ?", bookingIDs).
+		Updates(map[string]interface{}{
+			"status":       models.VisitStatusCancelled,
+			"sequence":     gorm.Expr("sequence + 1"),
+			"cancelled_at": at,
+			"updated_at":   at,
+		}).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.VisitSlot{}).
+		Where("booking_id IN ?", bookingIDs).
+		Update("booking_id", nil).Error
+}
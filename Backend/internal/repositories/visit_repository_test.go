@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"petmatch/internal/models"
+)
+
+// seedVisitFixtures stores an open request and slots free slots of the
+// pet's shelter.
+func seedVisitFixtures(t *testing.T, slots int) (*VisitRepository, models.AdoptionRequest, []models.VisitSlot) {
+	t.Helper()
+
+	adoptions := newAdoptionTestRepo(t)
+	adopter, pets := seedAdoptionFixtures(t, adoptions, 1)
+	if err := submitRequest(adoptions, adopter.ID, pets[0].ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	var request models.AdoptionRequest
+	if err := adoptions.db.First(&request).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(24 * time.Hour)
+	list := make([]models.VisitSlot, slots)
+	for i := range list {
+		list[i] = models.VisitSlot{
+			ShelterID: pets[0].ShelterID,
+			StartsAt:  start.Add(time.Duration(i) * time.Hour),
+			EndsAt:    start.Add(time.Duration(i)*time.Hour + 30*time.Minute),
+		}
+	}
+	if err := adoptions.db.Create(&list).Error; err != nil {
+		t.Fatal(err)
+	}
+	return NewVisitRepository(adoptions.db), request, list
+}
+
+func book(repo *VisitRepository, requestID, slotID uint) (bool, error) {
+	return repo.Book(&models.VisitBooking{RequestID: requestID, SlotID: slotID, Status: models.VisitStatusBooked})
+}
+
+func TestVisitBookKeepsOneActiveBooking(t *testing.T) {
+	repo, request, slots := seedVisitFixtures(t, 2)
+
+	if booked, err := book(repo, request.ID, slots[0].ID); err != nil || !booked {
+		t.Fatalf("first booking = %v, %v; want true, nil", booked, err)
+	}
+	if _, err := book(repo, request.ID, slots[1].ID); !errors.Is(err, ErrActiveBookingExists) {
+		t.Fatalf("second booking: error = %v, want ErrActiveBookingExists", err)
+	}
+	var slot models.VisitSlot
+	if err := repo.db.First(&slot, slots[1].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if slot.BookingID != nil {
+		t.Error("the refused booking claimed its slot")
+	}
+
+	// Inserting around the check still hits the unique index.
+	err := repo.db.Omit("Request", "Slot").Create(&models.VisitBooking{
+		RequestID: request.ID,
+		SlotID:    slots[1].ID,
+		Status:    models.VisitStatusBooked,
+	}).Error
+	if err == nil {
+		t.Fatal("the database accepted a second booked visit for the request")
+	}
+
+	// A cancelled visit no longer counts.
+	active, err := repo.FindActiveBooking(request.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled, err := repo.Cancel(active, time.Now()); err != nil || !cancelled {
+		t.Fatalf("Cancel = %v, %v; want true, nil", cancelled, err)
+	}
+	if booked, err := book(repo, request.ID, slots[1].ID); err != nil || !booked {
+		t.Errorf("booking after cancelling = %v, %v; want true, nil", booked, err)
+	}
+}
+
+func TestVisitBookConcurrentBookings(t *testing.T) {
+	const bookings = 8
+	repo, request, slots := seedVisitFixtures(t, bookings)
+
+	errs := make(chan error, bookings)
+	var wg sync.WaitGroup
+	for _, slot := range slots {
+		wg.Add(1)
+		go func(slotID uint) {
+			defer wg.Done()
+			booked, err := book(repo, request.ID, slotID)
+			if err == nil && !booked {
+				err = errSlotTaken
+			}
+			errs <- err
+		}(slot.ID)
+	}
+	wg.Wait()
+	close(errs)
+
+	created := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case errors.Is(err, ErrActiveBookingExists):
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d bookings succeeded, want 1", created)
+	}
+}
@@ -1,12 +1,19 @@
 package router
 
 import (
+	"time"
+
+	"petmatch/internal/authz"
 	"petmatch/internal/config"
+	"petmatch/internal/database"
 	"petmatch/internal/handlers"
+	"petmatch/internal/lockout"
+	"petmatch/internal/mail"
 	"petmatch/internal/middleware"
-	"petmatch/internal/models"
 	"petmatch/internal/repositories"
 	"petmatch/internal/services"
+	"petmatch/internal/signing"
+	"petmatch/internal/storage"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -14,23 +21,111 @@ import (
 
 func New(db *gorm.DB, cfg config.Config) (*gin.Engine, error) {
 	userRepo := repositories.NewUserRepository(db)
-	petRepo := repositories.NewPetRepository(db)
+	petRepo := repositories.NewPetRepository(db, database.FullTextSearch(db))
+	petMediaRepo := repositories.NewPetMediaRepository(db)
 	adoptionRepo := repositories.NewAdoptionRepository(db)
+	adoptionFormRepo := repositories.NewAdoptionFormRepository(db)
+	messageRepo := repositories.NewMessageRepository(db)
+	visitRepo := repositories.NewVisitRepository(db)
+	sessionRepo := repositories.NewSessionRepository(db)
+	userTokenRepo := repositories.NewUserTokenRepository(db)
+	twoFactorRepo := repositories.NewTwoFactorRepository(db)
+	shelterRepo := repositories.NewShelterRepository(db)
+	apiKeyRepo := repositories.NewAPIKeyRepository(db)
+	impersonationRepo := repositories.NewImpersonationRepository(db)
+	auditor := services.NewAuditor(repositories.NewAuditRepository(db))
+
+	mailer, err := mail.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	loginGuard := lockout.NewGuard(
+		lockout.NewMemoryStore(24*time.Hour),
+		lockout.Policy{
+			MaxAttempts:     cfg.LoginMaxAttempts,
+			Window:          cfg.LoginAttemptWindow,
+			LockoutDuration: cfg.LoginLockoutDuration,
+			DelayAfter:      3,
+			BaseDelay:       time.Second,
+			MaxDelay:        30 * time.Second,
+		},
+		lockout.Policy{
+			MaxAttempts:     cfg.LoginIPMaxAttempts,
+			Window:          cfg.LoginAttemptWindow,
+			LockoutDuration: cfg.LoginLockoutDuration,
+		},
+	)
+
+	// Password reset and verification emails, counted per address and per
+	// client IP.
+	mailGuard := lockout.NewGuard(
+		lockout.NewMemoryStore(24*time.Hour),
+		lockout.Policy{
+			MaxAttempts:     3,
+			Window:          time.Hour,
+			LockoutDuration: time.Hour,
+		},
+		lockout.Policy{
+			MaxAttempts:     20,
+			Window:          time.Hour,
+			LockoutDuration: time.Hour,
+		},
+	)
 
-	authService, err := services.NewAuthService(userRepo, cfg)
+	keyRing, err := newKeyRing(repositories.NewSigningKeyRepository(db), cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	petService := services.NewPetService(petRepo)
-	adoptionService := services.NewAdoptionService(adoptionRepo, petRepo)
+	authService, err := services.NewAuthService(userRepo, sessionRepo, twoFactorRepo, shelterRepo, impersonationRepo, loginGuard, keyRing, auditor, cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	authHandler := handlers.NewAuthHandler(authService)
+	policy, err := authz.LoadPolicy(cfg.PermissionsFile)
+	if err != nil {
+		return nil, err
+	}
+	authorizer := authz.NewAuthorizer(policy)
+
+	petService := services.NewPetService(petRepo, petMediaRepo, shelterRepo, authorizer, auditor, store, cfg)
+	adoptionService := services.NewAdoptionService(adoptionRepo, petRepo, adoptionFormRepo, shelterRepo, authorizer, auditor, mailer, cfg)
+	accountService := services.NewAccountService(userRepo, userTokenRepo, sessionRepo, mailer, mailGuard, auditor, cfg)
+	shelterService := services.NewShelterService(shelterRepo, userRepo, mailer, auditor, cfg)
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, shelterRepo, userRepo, authorizer, auditor)
+	adoptionFormService := services.NewAdoptionFormService(adoptionFormRepo, shelterRepo, petRepo, auditor)
+	messageService := services.NewMessageService(messageRepo, adoptionRepo, shelterRepo)
+	visitService := services.NewVisitService(visitRepo, adoptionRepo, shelterRepo, auditor, mailer, cfg)
+
+	authHandler := handlers.NewAuthHandler(authService, accountService)
 	petHandler := handlers.NewPetHandler(petService)
 	adoptionHandler := handlers.NewAdoptionHandler(adoptionService)
-	adminHandler := handlers.NewAdminHandler(userRepo, authService)
+	shelterHandler := handlers.NewShelterHandler(shelterService)
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService)
+	adoptionFormHandler := handlers.NewAdoptionFormHandler(adoptionFormService)
+	messageHandler := handlers.NewMessageHandler(messageService)
+	visitHandler := handlers.NewVisitHandler(visitService)
+	adminHandler := handlers.NewAdminHandler(userRepo, authService, shelterService, auditor, authorizer)
 
 	r := gin.Default()
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, err
+	}
+	r.Use(middleware.RequestID())
+
+	r.GET("/.well-known/jwks.json", handlers.JWKSHandler(keyRing))
+
+	authMiddleware := middleware.Authentication(authService, apiKeyService)
+	// requireSession keeps API keys away from routes meant for people.
+	requireSession := middleware.RequireSession()
+	// rejectImpersonation guards actions only the account holder may take.
+	rejectImpersonation := middleware.RejectImpersonation()
 
 	v1 := r.Group("/api/v1")
 
@@ -38,45 +133,160 @@ func New(db *gorm.DB, cfg config.Config) (*gin.Engine, error) {
 	{
 		authRoutes.POST("/register", authHandler.Register)
 		authRoutes.POST("/login", authHandler.Login)
-		authRoutes.GET("/me", middleware.Authentication(authService), handlers.CurrentUserHandler)
+		authRoutes.POST("/refresh", authHandler.Refresh)
+		authRoutes.POST("/logout", authHandler.Logout)
+		authRoutes.POST("/password/forgot", authHandler.ForgotPassword)
+		authRoutes.POST("/password/reset", authHandler.ResetPassword)
+		authRoutes.GET("/verify", authHandler.VerifyEmail)
+		authRoutes.POST("/verify/resend", authHandler.ResendVerification)
+		authRoutes.GET("/me", authMiddleware, requireSession, handlers.CurrentUserHandler)
+		authRoutes.PATCH("/me", authMiddleware, requireSession, rejectImpersonation, authHandler.UpdateProfile)
+		authRoutes.POST("/me/password", authMiddleware, requireSession, rejectImpersonation, authHandler.ChangePassword)
+		authRoutes.POST("/me/email", authMiddleware, requireSession, rejectImpersonation, authHandler.RequestEmailChange)
+		authRoutes.DELETE("/impersonation", authMiddleware, authHandler.StopImpersonation)
+		authRoutes.GET("/email/confirm", authHandler.ConfirmEmailChange)
+		authRoutes.POST("/login/2fa", authHandler.LoginTwoFactor)
+		authRoutes.POST("/login/2fa/setup", authHandler.BeginTwoFactorEnrollment)
+		authRoutes.POST("/login/2fa/confirm", authHandler.ConfirmTwoFactorEnrollment)
+	}
+
+	twoFactorRoutes := authRoutes.Group("/2fa")
+	twoFactorRoutes.Use(authMiddleware, requireSession, rejectImpersonation)
+	{
+		twoFactorRoutes.POST("/setup", authHandler.BeginTwoFactorSetup)
+		twoFactorRoutes.POST("/confirm", authHandler.ConfirmTwoFactorSetup)
+		twoFactorRoutes.POST("/disable", authHandler.DisableTwoFactor)
+		twoFactorRoutes.POST("/recovery-codes", authHandler.RegenerateRecoveryCodes)
 	}
 
 	v1.GET("/pets", petHandler.List)
 	v1.GET("/pets/:id", petHandler.Get)
-
-	authMiddleware := middleware.Authentication(authService)
+	v1.GET("/pets/:id/adoption-form", adoptionFormHandler.ForPet)
+	v1.GET("/photos/:key", petHandler.Photo)
 
     shelterGroup := v1.Group("")
-    shelterGroup.Use(authMiddleware, middleware.RequireRoles(models.RoleShelter))
+    shelterGroup.Use(authMiddleware, middleware.RequirePermission(authorizer, authz.PetsWrite))
     {
         shelterPets := shelterGroup.Group("/pets")
         shelterPets.POST("", petHandler.Create)
         shelterPets.PUT("/:id", petHandler.Update)
         shelterPets.DELETE("/:id", petHandler.Delete)
+        shelterPets.PUT("/:id/photo", petHandler.UploadPhoto)
+        shelterPets.DELETE("/:id/photo", petHandler.DeletePhoto)
+        shelterPets.GET("/:id/media", petHandler.Gallery)
+        shelterPets.POST("/:petId/media", petHandler.AddMedia)
+        shelterPets.PUT("/:id/media/order", petHandler.ReorderMedia)
+        shelterPets.PATCH("/:id/media/:mediaId", petHandler.UpdateMedia)
+        shelterPets.DELETE("/:id/media/:mediaId", petHandler.DeleteMedia)
 
     }
 
     adopterGroup := v1.Group("")
-    adopterGroup.Use(authMiddleware, middleware.RequireRoles(models.RoleAdopter))
+    adopterGroup.Use(authMiddleware, middleware.RequirePermission(authorizer, authz.AdoptionsCreate))
     {
         adopterGroup.POST("/pets/:petId/adoption-requests", adoptionHandler.Create)
+        adopterGroup.POST("/adoption-requests/:id/withdraw", adoptionHandler.Withdraw)
     }
 
-    // Shared route for listing adoption requests based on role
+    // Shared route for listing adoption requests based on permissions
     requestsGroup := v1.Group("")
-    requestsGroup.Use(authMiddleware, middleware.RequireRoles(models.RoleShelter, models.RoleAdopter))
+    requestsGroup.Use(authMiddleware, middleware.RequirePermission(authorizer, authz.AdoptionsReview, authz.AdoptionsReadOwn))
     {
         requestsGroup.GET("/adoption-requests", adoptionHandler.List)
+        requestsGroup.GET("/adoption-requests/:id", adoptionHandler.Get)
     }
 
-    shelterGroup.PATCH("/adoption-requests/:id", adoptionHandler.UpdateStatus)
+    v1.PATCH("/adoption-requests/:id", authMiddleware, middleware.RequirePermission(authorizer, authz.AdoptionsReview, authz.AdoptionsDecide), adoptionHandler.UpdateStatus)
+
+    // Private to the pet's shelter, which AdoptionService checks.
+    reviewGroup := v1.Group("/adoption-requests/:id")
+    reviewGroup.Use(authMiddleware, middleware.RequirePermission(authorizer, authz.AdoptionsReview))
+    {
+        reviewGroup.PUT("/evaluation", adoptionHandler.UpdateEvaluation)
+        reviewGroup.POST("/notes", adoptionHandler.AddNote)
+        reviewGroup.DELETE("/notes/:noteId", adoptionHandler.DeleteNote)
+    }
+
+	// Only the request's adopter and its pet's shelter take part in its
+	// conversation; MessageService checks both.
+	conversations := v1.Group("")
+	conversations.Use(authMiddleware, requireSession)
+	{
+		conversations.GET("/adoption-requests/:id/messages", messageHandler.List)
+		conversations.POST("/adoption-requests/:id/messages", messageHandler.Send)
+		conversations.POST("/adoption-requests/:id/messages/read", messageHandler.MarkRead)
+		conversations.GET("/messages/unread", messageHandler.Unread)
+	}
+
+	// Visits follow the same rule: the adopter books, reschedules and
+	// cancels, the pet's shelter can see and cancel. VisitService checks it.
+	visits := v1.Group("/adoption-requests/:id")
+	visits.Use(authMiddleware, requireSession)
+	{
+		visits.GET("/visit-slots", visitHandler.AvailableSlots)
+		visits.GET("/visit", visitHandler.Get)
+		visits.GET("/visit.ics", visitHandler.Calendar)
+		visits.POST("/visit", visitHandler.Book)
+		visits.PUT("/visit", visitHandler.Reschedule)
+		visits.DELETE("/visit", visitHandler.Cancel)
+	}
+
+	// Membership roles inside the shelter are checked by ShelterService.
+	myShelter := v1.Group("/shelter")
+	myShelter.Use(authMiddleware, requireSession)
+	{
+		myShelter.GET("", shelterHandler.Get)
+		myShelter.PATCH("", shelterHandler.Update)
+		myShelter.POST("/invitations", rejectImpersonation, shelterHandler.Invite)
+		myShelter.DELETE("/invitations/:id", rejectImpersonation, shelterHandler.RevokeInvitation)
+		myShelter.PATCH("/members/:userId", rejectImpersonation, shelterHandler.ChangeMemberRole)
+		myShelter.DELETE("/members/:userId", rejectImpersonation, shelterHandler.RemoveMember)
+		myShelter.GET("/api-keys", apiKeyHandler.List)
+		myShelter.POST("/api-keys", rejectImpersonation, apiKeyHandler.Create)
+		myShelter.DELETE("/api-keys/:id", rejectImpersonation, apiKeyHandler.Revoke)
+		myShelter.GET("/adoption-forms", adoptionFormHandler.List)
+		myShelter.POST("/adoption-forms", adoptionFormHandler.Create)
+		myShelter.PUT("/adoption-forms/:id", adoptionFormHandler.Update)
+		myShelter.DELETE("/adoption-forms/:id", adoptionFormHandler.Delete)
+		myShelter.GET("/visit-slots", visitHandler.ListSlots)
+		myShelter.POST("/visit-slots", visitHandler.CreateSlot)
+		myShelter.DELETE("/visit-slots/:id", visitHandler.DeleteSlot)
+	}
+
+	v1.POST("/shelter-invitations/accept", authMiddleware, requireSession, rejectImpersonation, shelterHandler.AcceptInvitation)
+	v1.POST("/shelter-invitations/register", shelterHandler.RegisterMember)
 
 	adminGroup := v1.Group("/admin")
-	adminGroup.Use(authMiddleware, middleware.RequireRoles(models.RoleAdmin))
+	adminGroup.Use(authMiddleware, requireSession, rejectImpersonation)
 	{
-		adminGroup.GET("/users", adminHandler.ListUsers)
-		adminGroup.POST("/shelters/:id/approve", adminHandler.ApproveShelter)
+		adminGroup.GET("/users", middleware.RequirePermission(authorizer, authz.UsersRead), adminHandler.ListUsers)
+		adminGroup.PATCH("/users/:id/role", middleware.RequirePermission(authorizer, authz.UsersManageRoles), adminHandler.ChangeRole)
+		adminGroup.POST("/users/:id/reject", middleware.RequirePermission(authorizer, authz.UsersApprove), adminHandler.RejectUser)
+		adminGroup.POST("/users/:id/suspend", middleware.RequirePermission(authorizer, authz.UsersSuspend), adminHandler.SuspendUser)
+		adminGroup.POST("/users/:id/reinstate", middleware.RequirePermission(authorizer, authz.UsersSuspend), adminHandler.ReinstateUser)
+		adminGroup.POST("/users/:id/impersonate", middleware.RequirePermission(authorizer, authz.UsersImpersonate), adminHandler.Impersonate)
+		adminGroup.GET("/impersonations", middleware.RequirePermission(authorizer, authz.SecurityManage), adminHandler.ListImpersonations)
+		adminGroup.GET("/impersonations/:id/requests", middleware.RequirePermission(authorizer, authz.SecurityManage), adminHandler.ListImpersonatedRequests)
+		adminGroup.GET("/shelters", middleware.RequirePermission(authorizer, authz.UsersRead), adminHandler.ListShelters)
+		adminGroup.POST("/shelters/:id/approve", middleware.RequirePermission(authorizer, authz.UsersApprove), adminHandler.ApproveShelter)
+		adminGroup.GET("/audit", middleware.RequirePermission(authorizer, authz.AuditRead), adminHandler.ListAuditEvents)
+		adminGroup.GET("/lockouts", middleware.RequirePermission(authorizer, authz.SecurityManage), adminHandler.ListLockouts)
+		adminGroup.DELETE("/lockouts/:kind/:value", middleware.RequirePermission(authorizer, authz.SecurityManage), adminHandler.ClearLockout)
 	}
 
+	// Reminders go out from this process for as long as it serves requests.
+	go visitService.RunReminders(cfg.VisitReminderInterval)
+	go petService.RunMediaProcessing(cfg.MediaProcessInterval)
+
 	return r, nil
 }
+
+func newKeyRing(repo *repositories.SigningKeyRepository, cfg config.Config) (*signing.KeyRing, error) {
+	if cfg.JWTAlgorithm == signing.AlgorithmHS256 {
+		return signing.NewHMACKeyRing([]byte(cfg.JWTSecret)), nil
+	}
+	// Allow a minute of clock skew between PetMatch and the services
+	// verifying its tokens.
+	grace := services.MaxTokenLifetime(cfg) + time.Minute
+	return signing.NewKeyRing(repo, cfg.JWTAlgorithm, []byte(cfg.SigningKeySecret), cfg.JWTKeyRotation, grace)
+}
@@ -0,0 +1,432 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"petmatch/internal/config"
+	"petmatch/internal/lockout"
+	"petmatch/internal/mail"
+	"petmatch/internal/models"
+	"petmatch/internal/repositories"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidResetToken        = errors.New("invalid or expired reset token")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailNotVerified         = errors.New("email address not verified")
+	ErrInvalidEmailChangeToken  = errors.New("invalid or expired email change token")
+	ErrInvalidCurrentPassword   = errors.New("current password is incorrect")
+	ErrShelterNameNotAllowed    = errors.New("only shelters have a shelter name")
+	ErrSameEmail                = errors.New("new email matches the current one")
+)
+
+// MailThrottledError is returned when an address or client IP has asked for
+// too many password reset or verification emails.
+type MailThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *MailThrottledError) Error() string {
+	return "too many emails requested, try again later"
+}
+
+// AccountService handles self-service account management: profile and
+// password changes, plus the flows driven by mailed, single-use tokens
+// (password recovery, email verification and email changes).
+type AccountService struct {
+	users            *repositories.UserRepository
+	tokens           *repositories.UserTokenRepository
+	sessions         *repositories.SessionRepository
+	mailer           mail.Mailer
+	mailGuard        *lockout.Guard
+	audit            *Auditor
+	appURL           string
+	passwordResetTTL time.Duration
+	verificationTTL  time.Duration
+}
+
+type UpdateProfileInput struct {
+	Name        *string
+	Phone       *string
+	City        *string
+	ShelterName *string
+}
+
+func NewAccountService(
+	users *repositories.UserRepository,
+	tokens *repositories.UserTokenRepository,
+	sessions *repositories.SessionRepository,
+	mailer mail.Mailer,
+	mailGuard *lockout.Guard,
+	auditor *Auditor,
+	cfg config.Config,
+) *AccountService {
+	return &AccountService{
+		users:            users,
+		tokens:           tokens,
+		sessions:         sessions,
+		mailer:           mailer,
+		mailGuard:        mailGuard,
+		audit:            auditor,
+		appURL:           strings.TrimRight(cfg.AppURL, "/"),
+		passwordResetTTL: cfg.PasswordResetTTL,
+		verificationTTL:  cfg.EmailVerificationTTL,
+	}
+}
+
+// ForgotPassword mails a reset link when the email belongs to an account.
+// Unknown addresses are ignored so the endpoint can't be used to probe which
+// emails are registered: the account is looked up and mailed after the
+// caller is answered, so neither the time taken nor a mail failure sets
+// registered addresses apart. Only the throttling of the address or the
+// client IP is reported.
+func (s *AccountService) ForgotPassword(email, clientIP string) error {
+	if err := s.throttleMail(email, clientIP); err != nil {
+		return err
+	}
+	go func() {
+		if err := s.sendPasswordReset(email); err != nil {
+			log.Printf("failed to send password reset email: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *AccountService) sendPasswordReset(email string) error {
+	user, err := s.users.FindByEmail(strings.ToLower(email))
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	raw, err := s.issueToken(user.ID, models.TokenPurposePasswordReset, s.passwordResetTTL, "")
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", s.appURL, url.QueryEscape(raw))
+	return s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Restablece tu contraseña de PetMatch",
+		Body: fmt.Sprintf(
+			"Hola %s,\n\nRecibimos una solicitud para restablecer tu contraseña. Usa este enlace antes de %d minutos:\n\n%s\n\nSi no fuiste tú, ignora este mensaje.",
+			user.Name, int(s.passwordResetTTL.Minutes()), link,
+		),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out everywhere.
+func (s *AccountService) ResetPassword(rawToken, newPassword string) error {
+	token, err := s.consumeToken(rawToken, models.TokenPurposePasswordReset, ErrInvalidResetToken)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.users.FindByID(token.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrInvalidResetToken
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hash)
+
+	if err := s.users.Update(user); err != nil {
+		return err
+	}
+
+	return s.sessions.RevokeAllForUser(user.ID)
+}
+
+// SendVerification mails a fresh verification link to the user, replacing any
+// link sent before.
+func (s *AccountService) SendVerification(user *models.User) error {
+	if user.EmailVerified {
+		return nil
+	}
+
+	raw, err := s.issueToken(user.ID, models.TokenPurposeEmailVerification, s.verificationTTL, "")
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.appURL, url.QueryEscape(raw))
+	return s.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Confirma tu correo en PetMatch",
+		Body: fmt.Sprintf(
+			"Hola %s,\n\nConfirma que este correo te pertenece abriendo el siguiente enlace:\n\n%s\n\nEl enlace vence en %d horas.",
+			user.Name, link, int(s.verificationTTL.Hours()),
+		),
+	})
+}
+
+// ResendVerification behaves like ForgotPassword: unknown or already
+// verified addresses are silently ignored.
+func (s *AccountService) ResendVerification(email, clientIP string) error {
+	if err := s.throttleMail(email, clientIP); err != nil {
+		return err
+	}
+	go func() {
+		if err := s.resendVerification(email); err != nil {
+			log.Printf("failed to resend verification email: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *AccountService) resendVerification(email string) error {
+	user, err := s.users.FindByEmail(strings.ToLower(email))
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+	return s.SendVerification(user)
+}
+
+// throttleMail counts a request for an email to the address, whether it is
+// registered or not, and from the client IP, so the endpoints cannot be used
+// to flood an inbox.
+func (s *AccountService) throttleMail(email, clientIP string) error {
+	wait, err := s.mailGuard.Attempt(email, clientIP, time.Now())
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &MailThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+func (s *AccountService) VerifyEmail(rawToken string) (*models.User, error) {
+	token, err := s.consumeToken(rawToken, models.TokenPurposeEmailVerification, ErrInvalidVerificationToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.FindByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	if !user.EmailVerified {
+		now := time.Now()
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+		if err := s.users.Update(user); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// UpdateProfile applies the non-nil fields of input. Empty optional fields
+// clear the stored value.
+func (s *AccountService) UpdateProfile(user *models.User, input UpdateProfileInput, meta RequestMeta) (*models.User, error) {
+	if input.ShelterName != nil && user.Role != models.RoleShelter {
+		return nil, ErrShelterNameNotAllowed
+	}
+
+	before := *user
+	if input.Name != nil {
+		user.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Phone != nil {
+		user.Phone = optionalString(*input.Phone)
+	}
+	if input.City != nil {
+		user.City = optionalString(*input.City)
+	}
+	if input.ShelterName != nil {
+		user.ShelterName = optionalString(*input.ShelterName)
+	}
+
+	if err := s.users.Update(user); err != nil {
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditUserProfileUpdate, AuditTargetUser, user.ID, &before, user)
+	return user, nil
+}
+
+// ChangePassword replaces the password after checking the current one and
+// revokes every session except currentSessionID.
+func (s *AccountService) ChangePassword(user *models.User, currentSessionID, currentPassword, newPassword string, meta RequestMeta) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+		return ErrInvalidCurrentPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = string(hash)
+
+	if err := s.users.Update(user); err != nil {
+		return err
+	}
+	s.audit.Record(user, meta, AuditUserPasswordChange, AuditTargetUser, user.ID, nil, nil)
+
+	return s.sessions.RevokeAllForUserExcept(user.ID, currentSessionID)
+}
+
+// RequestEmailChange mails a confirmation link to the new address. The
+// account keeps its current email until the link is opened.
+func (s *AccountService) RequestEmailChange(user *models.User, newEmail, currentPassword string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(currentPassword)); err != nil {
+		return ErrInvalidCurrentPassword
+	}
+
+	newEmail = strings.ToLower(strings.TrimSpace(newEmail))
+	if newEmail == user.Email {
+		return ErrSameEmail
+	}
+
+	existing, err := s.users.FindByEmail(newEmail)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return ErrEmailInUse
+	}
+
+	raw, err := s.issueToken(user.ID, models.TokenPurposeEmailChange, s.verificationTTL, newEmail)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/confirm-email?token=%s", s.appURL, url.QueryEscape(raw))
+	return s.mailer.Send(mail.Message{
+		To:      newEmail,
+		Subject: "Confirma tu nuevo correo en PetMatch",
+		Body: fmt.Sprintf(
+			"Hola %s,\n\nPediste usar esta dirección en tu cuenta de PetMatch. Confírmala con este enlace:\n\n%s\n\nEl enlace vence en %d horas.",
+			user.Name, link, int(s.verificationTTL.Hours()),
+		),
+	})
+}
+
+// ConfirmEmailChange switches the account to the address the token was sent
+// to and lets the previous address know about it.
+func (s *AccountService) ConfirmEmailChange(rawToken string, meta RequestMeta) (*models.User, error) {
+	token, err := s.consumeToken(rawToken, models.TokenPurposeEmailChange, ErrInvalidEmailChangeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.users.FindByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || token.Payload == "" {
+		return nil, ErrInvalidEmailChangeToken
+	}
+
+	existing, err := s.users.FindByEmail(token.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.ID != user.ID {
+		return nil, ErrEmailInUse
+	}
+
+	before := *user
+	previous := user.Email
+	now := time.Now()
+	user.Email = token.Payload
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
+	if err := s.users.Update(user); err != nil {
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditUserEmailChange, AuditTargetUser, user.ID, &before, user)
+
+	// The change is already stored; a failed notice must not report the
+	// confirmation as failed.
+	if err := s.mailer.Send(mail.Message{
+		To:      previous,
+		Subject: "Tu correo de PetMatch cambió",
+		Body: fmt.Sprintf(
+			"Hola %s,\n\nEl correo de tu cuenta ahora es %s. Si no hiciste este cambio, contáctanos de inmediato.",
+			user.Name, user.Email,
+		),
+	}); err != nil {
+		log.Printf("failed to notify %s about email change of user %d: %v", previous, user.ID, err)
+	}
+
+	return user, nil
+}
+
+func (s *AccountService) issueToken(userID uint, purpose models.UserTokenPurpose, ttl time.Duration, payload string) (string, error) {
+	if err := s.tokens.InvalidateForUser(userID, purpose); err != nil {
+		return "", err
+	}
+
+	raw, err := newOpaqueToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	token := &models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hashToken(raw),
+		Payload:   payload,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := s.tokens.Create(token); err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// consumeToken validates a mailed token and burns it. invalid is returned for
+// unknown, expired or already used tokens.
+func (s *AccountService) consumeToken(raw string, purpose models.UserTokenPurpose, invalid error) (*models.UserToken, error) {
+	token, err := s.tokens.FindByHash(hashToken(raw), purpose)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || token.UsedAt != nil || !time.Now().Before(token.ExpiresAt) {
+		return nil, invalid
+	}
+
+	consumed, err := s.tokens.Consume(token.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, invalid
+	}
+
+	return token, nil
+}
+
+func optionalString(value string) *string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
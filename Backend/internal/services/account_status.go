@@ -0,0 +1,180 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"petmatch/internal/models"
+)
+
+var (
+	ErrUserNotFound            = errors.New("user not found")
+	ErrInvalidStatusTransition = errors.New("account status does not allow this change")
+	ErrCannotChangeOwnStatus   = errors.New("admins cannot change their own account status")
+	ErrStatusReasonRequired    = errors.New("a reason is required")
+	ErrCannotChangeOwnRole     = errors.New("admins cannot change their own role")
+	ErrLastAdmin               = errors.New("the last active admin cannot be given another role")
+	ErrRoleNeedsShelter        = errors.New("only members of a shelter can have the shelter role; invite the user to the shelter instead")
+	ErrRoleLeavesShelter       = errors.New("the user belongs to a shelter; remove them from it before changing their role")
+)
+
+// AccountStatusError is returned when a rejected or suspended account tries
+// to sign in. Reason is the explanation the admin recorded.
+type AccountStatusError struct {
+	Status models.UserStatus
+	Reason string
+}
+
+func (e *AccountStatusError) Error() string {
+	switch e.Status {
+	case models.UserStatusRejected:
+		return "account application was rejected"
+	case models.UserStatusSuspended:
+		return "account suspended"
+	default:
+		return "account is not active"
+	}
+}
+
+// RejectAccount turns down an account waiting for approval.
+func (s *AuthService) RejectAccount(admin *models.User, userID uint, reason string, meta RequestMeta) (*models.User, error) {
+	return s.changeStatus(admin, userID, models.UserStatusRejected, reason, meta, AuditUserReject, models.UserStatusPending)
+}
+
+// SuspendAccount blocks an active account and signs it out everywhere.
+func (s *AuthService) SuspendAccount(admin *models.User, userID uint, reason string, meta RequestMeta) (*models.User, error) {
+	user, err := s.changeStatus(admin, userID, models.UserStatusSuspended, reason, meta, AuditUserSuspend, models.UserStatusActive)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.sessions.RevokeAllForUser(user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ReinstateAccount reactivates a suspended or rejected account. Only the
+// status changes: it does not approve the account or the shelter of a
+// rejected applicant; that remains a separate step.
+func (s *AuthService) ReinstateAccount(admin *models.User, userID uint, reason string, meta RequestMeta) (*models.User, error) {
+	return s.changeStatus(admin, userID, models.UserStatusActive, reason, meta, AuditUserReinstate,
+		models.UserStatusSuspended, models.UserStatusRejected)
+}
+
+// ChangeRole gives the user another role. The caller checks that the role
+// exists in the permission policy. Admins cannot change their own role nor
+// leave the application without an active admin. The shelter role goes
+// with a shelter membership, which joining or leaving a shelter manages, so
+// it can be neither given nor taken away here.
+func (s *AuthService) ChangeRole(admin *models.User, userID uint, role models.UserRole, meta RequestMeta) (*models.User, error) {
+	if admin.ID == userID {
+		return nil, ErrCannotChangeOwnRole
+	}
+
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if user.Role == role {
+		return user, nil
+	}
+
+	member, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member != nil {
+		return nil, ErrRoleLeavesShelter
+	}
+	if role == models.RoleShelter {
+		return nil, ErrRoleNeedsShelter
+	}
+
+	before := *user
+	user.Role = role
+	if before.Role == models.RoleAdmin {
+		ok, err := s.users.DemoteAdmin(user, role)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrLastAdmin
+		}
+	} else if err := s.users.Update(user); err != nil {
+		return nil, err
+	}
+	s.audit.Record(admin, meta, AuditUserRoleChange, AuditTargetUser, user.ID, &before, user)
+	return user, nil
+}
+
+func (s *AuthService) changeStatus(
+	admin *models.User,
+	userID uint,
+	to models.UserStatus,
+	reason string,
+	meta RequestMeta,
+	action string,
+	from ...models.UserStatus,
+) (*models.User, error) {
+	if admin.ID == userID {
+		return nil, ErrCannotChangeOwnStatus
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" && to != models.UserStatusActive {
+		return nil, ErrStatusReasonRequired
+	}
+
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+
+	allowed := false
+	for _, status := range from {
+		if user.Status == status {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	before := *user
+	now := time.Now()
+	user.Status = to
+	user.StatusReason = optionalString(reason)
+	user.StatusChangedAt = &now
+	user.StatusChangedByID = &admin.ID
+
+	if err := s.users.Update(user); err != nil {
+		return nil, err
+	}
+	s.audit.Record(admin, meta, action, AuditTargetUser, user.ID, &before, user)
+	return user, nil
+}
+
+// checkAccountStatus lets only active accounts obtain tokens.
+func checkAccountStatus(user *models.User) error {
+	switch user.Status {
+	case models.UserStatusActive:
+		return nil
+	case models.UserStatusPending:
+		return ErrShelterNotApproved
+	default:
+		reason := ""
+		if user.StatusReason != nil {
+			reason = *user.StatusReason
+		}
+		return &AccountStatusError{Status: user.Status, Reason: reason}
+	}
+}
@@ -0,0 +1,520 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"petmatch/internal/models"
+	"petmatch/internal/repositories"
+)
+
+const (
+	maxFormFields     = 50
+	maxFormOptions    = 100
+	maxTextAnswer     = 500
+	maxLongTextAnswer = 5000
+	formDateLayout    = "2006-01-02"
+)
+
+var (
+	ErrAdoptionFormNotFound = errors.New("adoption form not found")
+	ErrAdoptionFormExists   = errors.New("the shelter already has an adoption form for this species")
+	ErrAdoptionFormTitle    = errors.New("form title is required")
+	ErrAdoptionFormEmpty    = errors.New("a form needs between 1 and 50 fields")
+)
+
+var formFieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,59}$`)
+
+// FormDefinitionError reports a field that cannot be part of a form.
+type FormDefinitionError struct {
+	Field  string
+	Reason string
+}
+
+func (e *FormDefinitionError) Error() string {
+	return fmt.Sprintf("form field %s: %s", e.Field, e.Reason)
+}
+
+// FormAnswersError lists, by field key, the answers that do not satisfy the
+// adoption form.
+type FormAnswersError struct {
+	Fields map[string]string
+}
+
+func (e *FormAnswersError) Error() string {
+	return "answers do not satisfy the adoption form"
+}
+
+// AdoptionFormService manages the questionnaires shelters attach to adoption
+// requests. Every member can read them; managers and owners edit them.
+type AdoptionFormService struct {
+	forms    *repositories.AdoptionFormRepository
+	shelters *repositories.ShelterRepository
+	pets     *repositories.PetRepository
+	audit    *Auditor
+}
+
+type AdoptionFormInput struct {
+	Species string
+	Title   string
+	Fields  []AdoptionFormFieldInput
+}
+
+type AdoptionFormFieldInput struct {
+	Key       string
+	Label     string
+	Type      models.FormFieldType
+	Required  bool
+	Options   []string
+	MinLength *int
+	MaxLength *int
+	Min       *float64
+	Max       *float64
+	Pattern   string
+}
+
+func NewAdoptionFormService(
+	forms *repositories.AdoptionFormRepository,
+	shelters *repositories.ShelterRepository,
+	pets *repositories.PetRepository,
+	auditor *Auditor,
+) *AdoptionFormService {
+	return &AdoptionFormService{
+		forms:    forms,
+		shelters: shelters,
+		pets:     pets,
+		audit:    auditor,
+	}
+}
+
+func (s *AdoptionFormService) List(user *models.User) ([]models.AdoptionForm, error) {
+	member, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrNotShelterMember
+	}
+	return s.forms.ListByShelter(member.ShelterID)
+}
+
+func (s *AdoptionFormService) Create(user *models.User, input AdoptionFormInput, meta RequestMeta) (*models.AdoptionForm, error) {
+	member, err := s.manager(user)
+	if err != nil {
+		return nil, err
+	}
+
+	form := &models.AdoptionForm{ShelterID: member.ShelterID}
+	if err := s.apply(form, input); err != nil {
+		return nil, err
+	}
+	if err := s.forms.Create(form); err != nil {
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditAdoptionFormCreate, AuditTargetAdoptionForm, form.ID, nil, form)
+
+	return form, nil
+}
+
+// Update replaces the form's species, title and fields. Requests already
+// submitted keep the answers they were given.
+func (s *AdoptionFormService) Update(user *models.User, formID uint, input AdoptionFormInput, meta RequestMeta) (*models.AdoptionForm, error) {
+	member, err := s.manager(user)
+	if err != nil {
+		return nil, err
+	}
+
+	form, err := s.forms.FindByID(formID)
+	if err != nil {
+		return nil, err
+	}
+	if form == nil || form.ShelterID != member.ShelterID {
+		return nil, ErrAdoptionFormNotFound
+	}
+
+	before := *form
+	if err := s.apply(form, input); err != nil {
+		return nil, err
+	}
+	form.UpdatedAt = time.Now()
+	if err := s.forms.Replace(form); err != nil {
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditAdoptionFormUpdate, AuditTargetAdoptionForm, form.ID, &before, form)
+
+	return form, nil
+}
+
+func (s *AdoptionFormService) Delete(user *models.User, formID uint, meta RequestMeta) error {
+	member, err := s.manager(user)
+	if err != nil {
+		return err
+	}
+
+	form, err := s.forms.FindByID(formID)
+	if err != nil {
+		return err
+	}
+	if form == nil || form.ShelterID != member.ShelterID {
+		return ErrAdoptionFormNotFound
+	}
+
+	if err := s.forms.Delete(form); err != nil {
+		return err
+	}
+	s.audit.Record(user, meta, AuditAdoptionFormDelete, AuditTargetAdoptionForm, form.ID, form, nil)
+
+	return nil
+}
+
+// ForPet returns the form adopters fill in to request the pet, or nil when
+// its shelter has none.
+func (s *AdoptionFormService) ForPet(petID uint) (*models.AdoptionForm, error) {
+	pet, err := s.pets.FindByID(petID)
+	if err != nil {
+		return nil, err
+	}
+	if pet == nil {
+		return nil, ErrPetNotFound
+	}
+	return adoptionFormFor(s.forms, pet)
+}
+
+// apply validates input and copies it onto form. The species must not be
+// taken by another form of the shelter.
+func (s *AdoptionFormService) apply(form *models.AdoptionForm, input AdoptionFormInput) error {
+	title := strings.TrimSpace(input.Title)
+	if title == "" || utf8.RuneCountInString(title) > 120 {
+		return ErrAdoptionFormTitle
+	}
+
+	fields, err := buildFormFields(input.Fields)
+	if err != nil {
+		return err
+	}
+
+	species := normalizeSpecies(input.Species)
+	existing, err := s.forms.FindBySpecies(form.ShelterID, species)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.ID != form.ID {
+		return ErrAdoptionFormExists
+	}
+
+	form.Species = species
+	form.Title = title
+	form.Fields = fields
+	return nil
+}
+
+func (s *AdoptionFormService) manager(user *models.User) (*models.ShelterMember, error) {
+	member, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrNotShelterMember
+	}
+	if !atLeast(member, models.ShelterRoleManager) {
+		return nil, ErrShelterRoleForbidden
+	}
+	return member, nil
+}
+
+// adoptionFormFor returns the form of the pet's shelter for its species,
+// falling back to the shelter's general form.
+func adoptionFormFor(forms *repositories.AdoptionFormRepository, pet *models.Pet) (*models.AdoptionForm, error) {
+	if species := normalizeSpecies(pet.Species); species != "" {
+		form, err := forms.FindBySpecies(pet.ShelterID, species)
+		if err != nil || form != nil {
+			return form, err
+		}
+	}
+	return forms.FindBySpecies(pet.ShelterID, "")
+}
+
+func normalizeSpecies(species string) string {
+	return strings.ToLower(strings.TrimSpace(species))
+}
+
+func buildFormFields(inputs []AdoptionFormFieldInput) ([]models.AdoptionFormField, error) {
+	if len(inputs) == 0 || len(inputs) > maxFormFields {
+		return nil, ErrAdoptionFormEmpty
+	}
+
+	fields := make([]models.AdoptionFormField, 0, len(inputs))
+	seen := make(map[string]bool, len(inputs))
+	for i, input := range inputs {
+		key := strings.TrimSpace(input.Key)
+		name := key
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		invalid := func(reason string) error {
+			return &FormDefinitionError{Field: name, Reason: reason}
+		}
+
+		if !formFieldKeyPattern.MatchString(key) {
+			return nil, invalid("key must be lowercase letters, digits and underscores, starting with a letter")
+		}
+		if seen[key] {
+			return nil, invalid("key is repeated")
+		}
+		seen[key] = true
+
+		label := strings.TrimSpace(input.Label)
+		if label == "" || utf8.RuneCountInString(label) > 200 {
+			return nil, invalid("label is required and must be at most 200 characters")
+		}
+
+		field := models.AdoptionFormField{
+			Position: i,
+			Key:      key,
+			Label:    label,
+			Type:     input.Type,
+			Required: input.Required,
+		}
+
+		isText := input.Type == models.FormFieldText || input.Type == models.FormFieldLongText
+		isSelect := input.Type == models.FormFieldSelect || input.Type == models.FormFieldMultiSelect
+		switch input.Type {
+		case models.FormFieldText, models.FormFieldLongText, models.FormFieldNumber,
+			models.FormFieldBoolean, models.FormFieldDate,
+			models.FormFieldSelect, models.FormFieldMultiSelect:
+		default:
+			return nil, invalid(fmt.Sprintf("unknown type %q", input.Type))
+		}
+
+		if isSelect {
+			options, err := formOptions(input.Options)
+			if err != nil {
+				return nil, invalid(err.Error())
+			}
+			field.Options = options
+		} else if len(input.Options) > 0 {
+			return nil, invalid("options only apply to select fields")
+		}
+
+		if input.MinLength != nil || input.MaxLength != nil || input.Pattern != "" {
+			if !isText {
+				return nil, invalid("minLength, maxLength and pattern only apply to text fields")
+			}
+			if (input.MinLength != nil && *input.MinLength < 0) || (input.MaxLength != nil && *input.MaxLength < 1) ||
+				(input.MinLength != nil && input.MaxLength != nil && *input.MinLength > *input.MaxLength) {
+				return nil, invalid("minLength and maxLength must describe a valid range")
+			}
+			if input.Pattern != "" {
+				if len(input.Pattern) > 255 {
+					return nil, invalid("pattern must be at most 255 characters")
+				}
+				if _, err := regexp.Compile(input.Pattern); err != nil {
+					return nil, invalid("pattern is not a valid regular expression")
+				}
+			}
+			field.MinLength = input.MinLength
+			field.MaxLength = input.MaxLength
+			field.Pattern = input.Pattern
+		}
+
+		if input.Min != nil || input.Max != nil {
+			if input.Type != models.FormFieldNumber {
+				return nil, invalid("min and max only apply to number fields")
+			}
+			if input.Min != nil && input.Max != nil && *input.Min > *input.Max {
+				return nil, invalid("min must not be greater than max")
+			}
+			field.Min = input.Min
+			field.Max = input.Max
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+func formOptions(inputs []string) (models.StringList, error) {
+	options := make(models.StringList, 0, len(inputs))
+	seen := make(map[string]bool, len(inputs))
+	for _, option := range inputs {
+		option = strings.TrimSpace(option)
+		if option == "" || seen[option] {
+			continue
+		}
+		if utf8.RuneCountInString(option) > 200 {
+			return nil, errors.New("options must be at most 200 characters")
+		}
+		seen[option] = true
+		options = append(options, option)
+	}
+	if len(options) == 0 || len(options) > maxFormOptions {
+		return nil, errors.New("select fields need between 1 and 100 options")
+	}
+	return options, nil
+}
+
+// validateAnswers checks answers against the form and returns them cleaned
+// up: text trimmed, unanswered optional fields dropped. Without a form no
+// answers are accepted.
+func validateAnswers(form *models.AdoptionForm, answers map[string]interface{}) (models.FormAnswers, error) {
+	problems := make(map[string]string)
+	cleaned := make(models.FormAnswers)
+
+	var fields []models.AdoptionFormField
+	if form != nil {
+		fields = form.Fields
+	}
+	known := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		known[field.Key] = true
+
+		value, problem := formAnswer(field, answers[field.Key])
+		switch {
+		case problem != "":
+			problems[field.Key] = problem
+		case value == nil && field.Required:
+			problems[field.Key] = "is required"
+		case value != nil:
+			cleaned[field.Key] = value
+		}
+	}
+	for key := range answers {
+		if !known[key] {
+			problems[key] = "is not a question of this form"
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &FormAnswersError{Fields: problems}
+	}
+	if form == nil {
+		return nil, nil
+	}
+	return cleaned, nil
+}
+
+// formAnswer checks one answer. It returns nil when the field was left
+// empty, or a description of what is wrong with the answer.
+func formAnswer(field models.AdoptionFormField, raw interface{}) (interface{}, string) {
+	if raw == nil {
+		return nil, ""
+	}
+
+	switch field.Type {
+	case models.FormFieldText, models.FormFieldLongText:
+		text, ok := raw.(string)
+		if !ok {
+			return nil, "must be text"
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, ""
+		}
+		length := utf8.RuneCountInString(text)
+		limit := maxTextAnswer
+		if field.Type == models.FormFieldLongText {
+			limit = maxLongTextAnswer
+		}
+		if field.MaxLength != nil && *field.MaxLength < limit {
+			limit = *field.MaxLength
+		}
+		if length > limit {
+			return nil, fmt.Sprintf("must be at most %d characters", limit)
+		}
+		if field.MinLength != nil && length < *field.MinLength {
+			return nil, fmt.Sprintf("must be at least %d characters", *field.MinLength)
+		}
+		if field.Pattern != "" {
+			pattern, err := regexp.Compile(`^(?:` + field.Pattern + `)$`)
+			if err != nil || !pattern.MatchString(text) {
+				return nil, "has an invalid format"
+			}
+		}
+		return text, ""
+
+	case models.FormFieldNumber:
+		number, ok := raw.(float64)
+		if !ok {
+			return nil, "must be a number"
+		}
+		if field.Min != nil && number < *field.Min {
+			return nil, fmt.Sprintf("must be at least %g", *field.Min)
+		}
+		if field.Max != nil && number > *field.Max {
+			return nil, fmt.Sprintf("must be at most %g", *field.Max)
+		}
+		return number, ""
+
+	case models.FormFieldBoolean:
+		answer, ok := raw.(bool)
+		if !ok {
+			return nil, "must be true or false"
+		}
+		return answer, ""
+
+	case models.FormFieldDate:
+		text, ok := raw.(string)
+		if !ok {
+			return nil, "must be a date (YYYY-MM-DD)"
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return nil, ""
+		}
+		if _, err := time.Parse(formDateLayout, text); err != nil {
+			return nil, "must be a date (YYYY-MM-DD)"
+		}
+		return text, ""
+
+	case models.FormFieldSelect:
+		choice, ok := raw.(string)
+		if !ok {
+			return nil, "must be one of the options"
+		}
+		if choice == "" {
+			return nil, ""
+		}
+		if !hasOption(field.Options, choice) {
+			return nil, "must be one of the options"
+		}
+		return choice, ""
+
+	case models.FormFieldMultiSelect:
+		list, ok := raw.([]interface{})
+		if !ok {
+			return nil, "must be a list of options"
+		}
+		choices := make([]string, 0, len(list))
+		seen := make(map[string]bool, len(list))
+		for _, item := range list {
+			choice, ok := item.(string)
+			if !ok || !hasOption(field.Options, choice) {
+				return nil, "must only contain the options"
+			}
+			if !seen[choice] {
+				seen[choice] = true
+				choices = append(choices, choice)
+			}
+		}
+		if len(choices) == 0 {
+			return nil, ""
+		}
+		return choices, ""
+	}
+
+	return nil, "cannot be answered"
+}
+
+func hasOption(options []string, choice string) bool {
+	for _, option := range options {
+		if option == choice {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"petmatch/internal/authz"
+	"petmatch/internal/models"
+)
+
+const maxAdoptionNote = 5000
+
+var (
+	ErrInvalidScore         = errors.New("score must be between 1 and 5")
+	ErrInvalidOutcome       = errors.New("outcome must be pending, passed or failed")
+	ErrNoteRequired         = errors.New("note must be between 1 and 5000 characters")
+	ErrAdoptionNoteNotFound = errors.New("note not found")
+)
+
+type EvaluationInput struct {
+	Score            *int
+	InterviewOutcome models.EvaluationOutcome
+	ReferenceCheck   models.EvaluationOutcome
+}
+
+// AdoptionReview is what the shelter keeps to itself about a request.
+type AdoptionReview struct {
+	Evaluation *models.AdoptionEvaluation
+	Notes      []models.AdoptionNote
+}
+
+// UpdateEvaluation replaces the shelter's evaluation of the request. Empty
+// outcomes are stored as pending.
+func (s *AdoptionService) UpdateEvaluation(user *models.User, requestID uint, input EvaluationInput, meta RequestMeta) (*models.AdoptionEvaluation, error) {
+	if input.Score != nil && (*input.Score < 1 || *input.Score > 5) {
+		return nil, ErrInvalidScore
+	}
+	interview, err := parseEvaluationOutcome(input.InterviewOutcome)
+	if err != nil {
+		return nil, err
+	}
+	references, err := parseEvaluationOutcome(input.ReferenceCheck)
+	if err != nil {
+		return nil, err
+	}
+
+	request, _, err := s.reviewable(user, requestID, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := s.adoptions.FindEvaluation(request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	evaluation := &models.AdoptionEvaluation{
+		RequestID:        request.ID,
+		Score:            input.Score,
+		InterviewOutcome: interview,
+		ReferenceCheck:   references,
+		UpdatedByID:      &user.ID,
+		UpdatedAt:        time.Now(),
+	}
+	if err := s.adoptions.SaveEvaluation(evaluation); err != nil {
+		return nil, err
+	}
+	evaluation.UpdatedBy = user
+	s.audit.Record(user, meta, AuditAdoptionEvaluate, AuditTargetAdoption, request.ID, before, evaluation)
+
+	return evaluation, nil
+}
+
+func (s *AdoptionService) AddNote(user *models.User, requestID uint, body string, meta RequestMeta) (*models.AdoptionNote, error) {
+	body = strings.TrimSpace(body)
+	if body == "" || utf8.RuneCountInString(body) > maxAdoptionNote {
+		return nil, ErrNoteRequired
+	}
+
+	request, _, err := s.reviewable(user, requestID, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	note := &models.AdoptionNote{
+		RequestID: request.ID,
+		AuthorID:  &user.ID,
+		Body:      body,
+	}
+	if err := s.adoptions.CreateNote(note); err != nil {
+		return nil, err
+	}
+	note.Author = user
+	s.audit.Record(user, meta, AuditAdoptionNoteCreate, AuditTargetAdoptionNote, note.ID, nil, note)
+
+	return note, nil
+}
+
+// DeleteNote removes a note. Authors can delete their own notes; managers
+// and owners any note of their shelter.
+func (s *AdoptionService) DeleteNote(user *models.User, requestID, noteID uint, meta RequestMeta) error {
+	request, member, err := s.reviewable(user, requestID, meta)
+	if err != nil {
+		return err
+	}
+
+	note, err := s.adoptions.FindNote(request.ID, noteID)
+	if err != nil {
+		return err
+	}
+	if note == nil {
+		return ErrAdoptionNoteNotFound
+	}
+	isAuthor := note.AuthorID != nil && *note.AuthorID == user.ID
+	if !isAuthor && !atLeast(member, models.ShelterRoleManager) {
+		return ErrShelterRoleForbidden
+	}
+
+	if err := s.adoptions.DeleteNote(note.ID); err != nil {
+		return err
+	}
+	s.audit.Record(user, meta, AuditAdoptionNoteDelete, AuditTargetAdoptionNote, note.ID, note, nil)
+
+	return nil
+}
+
+func (s *AdoptionService) review(requestID uint) (*AdoptionReview, error) {
+	evaluation, err := s.adoptions.FindEvaluation(requestID)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := s.adoptions.ListNotes(requestID)
+	if err != nil {
+		return nil, err
+	}
+	return &AdoptionReview{Evaluation: evaluation, Notes: notes}, nil
+}
+
+// reviewable returns the request if the user reviews requests for the
+// shelter of its pet. Requests of other shelters are reported as not found.
+func (s *AdoptionService) reviewable(user *models.User, requestID uint, meta RequestMeta) (*models.AdoptionRequest, *models.ShelterMember, error) {
+	if !s.can(user, meta, authz.AdoptionsReview) {
+		return nil, nil, ErrPermissionDenied
+	}
+
+	member, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if member == nil {
+		return nil, nil, ErrNotShelterMember
+	}
+
+	request, err := s.adoptions.FindByID(requestID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if request == nil || request.Pet.ShelterID != member.ShelterID {
+		return nil, nil, ErrRequestNotFound
+	}
+
+	return request, member, nil
+}
+
+func parseEvaluationOutcome(outcome models.EvaluationOutcome) (models.EvaluationOutcome, error) {
+	switch outcome {
+	case "":
+		return models.EvaluationPending, nil
+	case models.EvaluationPending, models.EvaluationPassed, models.EvaluationFailed:
+		return outcome, nil
+	default:
+		return "", ErrInvalidOutcome
+	}
+}
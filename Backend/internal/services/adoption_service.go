@@ -2,7 +2,13 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"time"
 
+	"petmatch/internal/authz"
+	"petmatch/internal/config"
+	"petmatch/internal/mail"
 	"petmatch/internal/models"
 	"petmatch/internal/repositories"
 )
@@ -11,34 +17,75 @@ var (
 	ErrAdopterRoleRequired = errors.New("only adopters can submit requests")
 	ErrRequestNotFound     = errors.New("adoption request not found")
 	ErrShelterOwnership    = errors.New("request does not belong to shelter")
+	ErrPermissionDenied    = errors.New("insufficient permissions")
+	ErrPetNotAvailable     = errors.New("pet is no longer available for adoption")
+	ErrDuplicateRequest    = errors.New("you already have an open request for this pet")
+	ErrOpenRequestLimit    = errors.New("too many open adoption requests")
 )
 
 type AdoptionService struct {
-	adoptions *repositories.AdoptionRepository
-	pets      *repositories.PetRepository
+	adoptions       *repositories.AdoptionRepository
+	pets            *repositories.PetRepository
+	forms           *repositories.AdoptionFormRepository
+	shelters        *repositories.ShelterRepository
+	authz           *authz.Authorizer
+	audit           *Auditor
+	mailer          mail.Mailer
+	requireVerified bool
+	maxOpen         int
 }
 
 type CreateRequestInput struct {
 	PetID   uint
 	Message string
+	Answers map[string]interface{}
 }
 
 type UpdateRequestInput struct {
-	Status models.AdoptionStatus
+	Status  models.AdoptionStatus
+	Comment string
 }
 
-func NewAdoptionService(adoptionRepo *repositories.AdoptionRepository, petRepo *repositories.PetRepository) *AdoptionService {
+// AdoptionRequestDetails is a request together with its status history.
+// Review is only filled in for the pet's shelter.
+type AdoptionRequestDetails struct {
+	Request models.AdoptionRequest
+	History []models.AdoptionStatusChange
+	Review  *AdoptionReview
+}
+
+func NewAdoptionService(
+	adoptionRepo *repositories.AdoptionRepository,
+	petRepo *repositories.PetRepository,
+	formRepo *repositories.AdoptionFormRepository,
+	shelterRepo *repositories.ShelterRepository,
+	authorizer *authz.Authorizer,
+	auditor *Auditor,
+	mailer mail.Mailer,
+	cfg config.Config,
+) *AdoptionService {
 	return &AdoptionService{
-		adoptions: adoptionRepo,
-		pets:      petRepo,
+		adoptions:       adoptionRepo,
+		pets:            petRepo,
+		forms:           formRepo,
+		shelters:        shelterRepo,
+		authz:           authorizer,
+		audit:           auditor,
+		mailer:          mailer,
+		requireVerified: cfg.RequireVerifiedEmailForAdoption,
+		maxOpen:         cfg.MaxOpenAdoptionRequests,
 	}
 }
 
-func (s *AdoptionService) Create(adopter *models.User, input CreateRequestInput) (*models.AdoptionRequest, error) {
-	if adopter.Role != models.RoleAdopter {
+func (s *AdoptionService) Create(adopter *models.User, input CreateRequestInput, meta RequestMeta) (*models.AdoptionRequest, error) {
+	if !s.authz.Can(adopter, authz.AdoptionsCreate) {
 		return nil, ErrAdopterRoleRequired
 	}
 
+	if s.requireVerified && !adopter.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
 	pet, err := s.pets.FindByID(input.PetID)
 	if err != nil {
 		return nil, err
@@ -46,30 +93,79 @@ func (s *AdoptionService) Create(adopter *models.User, input CreateRequestInput)
 	if pet == nil {
 		return nil, ErrPetNotFound
 	}
+	if pet.Status != models.PetStatusAvailable {
+		return nil, ErrPetNotAvailable
+	}
+
+	form, err := adoptionFormFor(s.forms, pet)
+	if err != nil {
+		return nil, err
+	}
+	answers, err := validateAnswers(form, input.Answers)
+	if err != nil {
+		return nil, err
+	}
 
+	now := time.Now()
 	request := &models.AdoptionRequest{
-		PetID:     pet.ID,
-		AdopterID: adopter.ID,
-		Message:   input.Message,
-		Status:    models.AdoptionStatusPending,
+		PetID:           pet.ID,
+		AdopterID:       adopter.ID,
+		Message:         input.Message,
+		Status:          models.AdoptionStatusSubmitted,
+		StatusChangedAt: &now,
+		Answers:         answers,
+	}
+	if form != nil {
+		request.FormID = &form.ID
 	}
 
-	if err := s.adoptions.Create(request); err != nil {
+	err = s.adoptions.Create(request, newStatusChange(request, "", adopter, "", now), openAdoptionStatuses, s.maxOpen)
+	switch {
+	case errors.Is(err, repositories.ErrOpenRequestExists):
+		return nil, ErrDuplicateRequest
+	case errors.Is(err, repositories.ErrOpenRequestLimit):
+		return nil, ErrOpenRequestLimit
+	case err != nil:
 		return nil, err
 	}
+	s.audit.Record(adopter, meta, AuditAdoptionCreate, AuditTargetAdoption, request.ID, nil, request)
 
+	request.Pet = *pet
+	request.Adopter = *adopter
 	return request, nil
 }
 
-func (s *AdoptionService) ListForShelter(shelterID uint) ([]models.AdoptionRequest, error) {
-	return s.adoptions.ListByShelter(shelterID)
+func (s *AdoptionService) ListForShelter(shelterID uint, page repositories.PageRequest) ([]models.AdoptionRequest, repositories.PageInfo, error) {
+	return s.adoptions.ListByShelter(shelterID, page)
+}
+
+func (s *AdoptionService) ListForAdopter(adopterID uint, page repositories.PageRequest) ([]models.AdoptionRequest, repositories.PageInfo, error) {
+	return s.adoptions.ListByAdopter(adopterID, page)
 }
 
-func (s *AdoptionService) ListForAdopter(adopterID uint) ([]models.AdoptionRequest, error) {
-	return s.adoptions.ListByAdopter(adopterID)
+// ListVisible returns the requests the user may see: those for the pets of
+// their shelter when they review requests, otherwise the ones they submitted.
+func (s *AdoptionService) ListVisible(user *models.User, page repositories.PageRequest) ([]models.AdoptionRequest, repositories.PageInfo, error) {
+	switch {
+	case s.authz.Can(user, authz.AdoptionsReview):
+		member, err := s.shelters.FindMembership(user.ID)
+		if err != nil {
+			return nil, repositories.PageInfo{}, err
+		}
+		if member == nil {
+			return nil, repositories.PageInfo{}, ErrNotShelterMember
+		}
+		return s.ListForShelter(member.ShelterID, page)
+	case s.authz.Can(user, authz.AdoptionsReadOwn):
+		return s.ListForAdopter(user.ID, page)
+	default:
+		return nil, repositories.PageInfo{}, ErrPermissionDenied
+	}
 }
 
-func (s *AdoptionService) UpdateStatus(shelter *models.User, requestID uint, input UpdateRequestInput) (*models.AdoptionRequest, error) {
+// Get returns a request and its history to whoever would see it listed by
+// ListVisible: reviewers from the pet's shelter or the adopter who filed it.
+func (s *AdoptionService) Get(user *models.User, requestID uint) (*AdoptionRequestDetails, error) {
 	request, err := s.adoptions.FindByID(requestID)
 	if err != nil {
 		return nil, err
@@ -78,23 +174,261 @@ func (s *AdoptionService) UpdateStatus(shelter *models.User, requestID uint, inp
 		return nil, ErrRequestNotFound
 	}
 
-	pet, err := s.pets.FindByID(request.PetID)
+	details := &AdoptionRequestDetails{Request: *request}
+	switch {
+	case s.authz.Can(user, authz.AdoptionsReview):
+		member, err := s.shelters.FindMembership(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if member == nil {
+			return nil, ErrNotShelterMember
+		}
+		if request.Pet.ShelterID != member.ShelterID {
+			return nil, ErrRequestNotFound
+		}
+		if details.Review, err = s.review(request.ID); err != nil {
+			return nil, err
+		}
+	case s.authz.Can(user, authz.AdoptionsReadOwn):
+		if request.AdopterID != user.ID {
+			return nil, ErrRequestNotFound
+		}
+	default:
+		return nil, ErrPermissionDenied
+	}
+
+	details.History, err = s.adoptions.ListHistory(request.ID)
 	if err != nil {
 		return nil, err
 	}
-	if pet == nil {
-		return nil, ErrPetNotFound
+
+	return details, nil
+}
+
+// UpdateStatus moves the request along the adoption workflow. Members of the
+// pet's shelter review requests, managers and owners decide them, and the
+// adopter can withdraw their own.
+func (s *AdoptionService) UpdateStatus(user *models.User, requestID uint, input UpdateRequestInput, meta RequestMeta) (*models.AdoptionRequest, error) {
+	if _, err := ParseAdoptionStatus(string(input.Status)); err != nil {
+		return nil, err
+	}
+
+	request, err := s.adoptions.FindByID(requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, ErrRequestNotFound
+	}
+
+	isAdopter := request.AdopterID == user.ID
+	var member *models.ShelterMember
+	if !isAdopter {
+		pet, err := s.pets.FindByID(request.PetID)
+		if err != nil {
+			return nil, err
+		}
+		if pet == nil {
+			return nil, ErrPetNotFound
+		}
+
+		member, err = s.shelters.FindMembership(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if member == nil {
+			return nil, ErrNotShelterMember
+		}
+		if pet.ShelterID != member.ShelterID {
+			return nil, ErrShelterOwnership
+		}
+	}
+
+	by, ok := adoptionTransitions[request.Status][input.Status]
+	if !ok {
+		return nil, ErrInvalidAdoptionTransition
+	}
+
+	switch by {
+	case adoptionAdopter:
+		if !isAdopter {
+			return nil, ErrPermissionDenied
+		}
+	case adoptionReviewer:
+		if member == nil || !s.can(user, meta, authz.AdoptionsReview) {
+			return nil, ErrPermissionDenied
+		}
+	case adoptionDecider:
+		if member == nil || !s.can(user, meta, authz.AdoptionsDecide) {
+			return nil, ErrPermissionDenied
+		}
+		// Staff can follow requests, but only managers and owners decide them.
+		if !atLeast(member, models.ShelterRoleManager) {
+			return nil, ErrShelterRoleForbidden
+		}
 	}
 
-	if pet.ShelterID != shelter.ID {
-		return nil, ErrShelterOwnership
+	switch input.Status {
+	case models.AdoptionStatusApproved:
+		return s.approve(user, request, input.Comment, meta)
+	case models.AdoptionStatusWithdrawn:
+		return s.withdraw(user, request, input.Comment, meta)
 	}
 
-	request.Status = input.Status
+	before := *request
+	now := time.Now()
+	column := stampAdoptionStatus(request, input.Status, now)
 
-	if err := s.adoptions.Update(request); err != nil {
+	moved, err := s.adoptions.Transition(newStatusChange(request, before.Status, user, input.Comment, now), column)
+	if err != nil {
 		return nil, err
 	}
+	if !moved {
+		return nil, ErrInvalidAdoptionTransition
+	}
+	s.audit.Record(user, meta, AuditAdoptionStatus, AuditTargetAdoption, request.ID, &before, request)
 
 	return request, nil
 }
+
+// Withdraw lets the adopter take back their own request while it is open or
+// approved.
+func (s *AdoptionService) Withdraw(user *models.User, requestID uint, comment string, meta RequestMeta) (*models.AdoptionRequest, error) {
+	request, err := s.adoptions.FindByID(requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request == nil {
+		return nil, ErrRequestNotFound
+	}
+	if request.AdopterID != user.ID {
+		return nil, ErrPermissionDenied
+	}
+	if _, ok := adoptionTransitions[request.Status][models.AdoptionStatusWithdrawn]; !ok {
+		return nil, ErrInvalidAdoptionTransition
+	}
+
+	return s.withdraw(user, request, comment, meta)
+}
+
+// withdraw withdraws the request. If it had been approved, the pet becomes
+// available again and the requests closed by that approval are reopened, so
+// their adopters are told they are back in the running.
+func (s *AdoptionService) withdraw(user *models.User, request *models.AdoptionRequest, comment string, meta RequestMeta) (*models.AdoptionRequest, error) {
+	before := *request
+	petBefore := request.Pet
+	now := time.Now()
+	stampAdoptionStatus(request, models.AdoptionStatusWithdrawn, now)
+
+	change := newStatusChange(request, before.Status, user, comment, now)
+	reopened, withdrawn, err := s.adoptions.Withdraw(request, change, closedByApprovalComment, reopenedByWithdrawalComment)
+	if err != nil {
+		return nil, err
+	}
+	if !withdrawn {
+		return nil, ErrInvalidAdoptionTransition
+	}
+	s.audit.Record(user, meta, AuditAdoptionStatus, AuditTargetAdoption, request.ID, &before, request)
+
+	if before.Status == models.AdoptionStatusApproved && petBefore.Status == models.PetStatusAdopted {
+		request.Pet.Status = models.PetStatusAvailable
+		request.Pet.UpdatedAt = now
+		s.audit.Record(user, meta, AuditPetUpdate, AuditTargetPet, request.PetID, &petBefore, &request.Pet)
+	}
+	for i := range reopened {
+		other := reopened[i]
+		other.Status = models.AdoptionStatusRejected
+		reopened[i].UpdatedAt = now
+		s.audit.Record(user, meta, AuditAdoptionStatus, AuditTargetAdoption, other.ID, &other, &reopened[i])
+	}
+
+	for _, other := range reopened {
+		s.notify(other.Adopter, mail.Message{
+			To:      other.Adopter.Email,
+			Subject: fmt.Sprintf("Tu solicitud para adoptar a %s fue reabierta", request.Pet.Name),
+			Body: fmt.Sprintf(
+				"Hola %s,\n\nLa adopción aprobada de %s no siguió adelante, así que reabrimos tu solicitud. El refugio volverá a revisarla y te avisaremos de cualquier novedad.",
+				other.Adopter.Name, request.Pet.Name,
+			),
+		})
+	}
+
+	return request, nil
+}
+
+// approve approves the request and hands the pet over to its adopter. The pet
+// is marked adopted and the other open requests for it are rejected in the
+// same transaction, so of two concurrent approvals only one succeeds. The
+// adopters involved are notified once the transaction has committed.
+func (s *AdoptionService) approve(user *models.User, request *models.AdoptionRequest, comment string, meta RequestMeta) (*models.AdoptionRequest, error) {
+	if request.Pet.Status != models.PetStatusAvailable {
+		return nil, ErrPetNotAvailable
+	}
+
+	before := *request
+	petBefore := request.Pet
+	now := time.Now()
+	stampAdoptionStatus(request, models.AdoptionStatusApproved, now)
+
+	change := newStatusChange(request, before.Status, user, comment, now)
+	closed, approved, err := s.adoptions.Approve(request, change, openAdoptionStatuses, closedByApprovalComment)
+	if err != nil {
+		return nil, err
+	}
+	if !approved {
+		// Someone else decided first: either this request moved on or the
+		// pet went to a competing request.
+		pet, err := s.pets.FindByID(request.PetID)
+		if err != nil {
+			return nil, err
+		}
+		if pet == nil || pet.Status != models.PetStatusAvailable {
+			return nil, ErrPetNotAvailable
+		}
+		return nil, ErrInvalidAdoptionTransition
+	}
+
+	request.Pet.Status = models.PetStatusAdopted
+	request.Pet.UpdatedAt = now
+	s.audit.Record(user, meta, AuditAdoptionStatus, AuditTargetAdoption, request.ID, &before, request)
+	s.audit.Record(user, meta, AuditPetUpdate, AuditTargetPet, request.PetID, &petBefore, &request.Pet)
+	for i := range closed {
+		other := closed[i]
+		stampAdoptionStatus(&closed[i], models.AdoptionStatusRejected, now)
+		s.audit.Record(user, meta, AuditAdoptionStatus, AuditTargetAdoption, other.ID, &other, &closed[i])
+	}
+
+	s.notify(request.Adopter, mail.Message{
+		To:      request.Adopter.Email,
+		Subject: fmt.Sprintf("¡Tu solicitud para adoptar a %s fue aprobada!", request.Pet.Name),
+		Body: fmt.Sprintf(
+			"Hola %s,\n\nTu solicitud para adoptar a %s fue aprobada. El refugio se pondrá en contacto contigo para coordinar los siguientes pasos.",
+			request.Adopter.Name, request.Pet.Name,
+		),
+	})
+	for _, other := range closed {
+		s.notify(other.Adopter, mail.Message{
+			To:      other.Adopter.Email,
+			Subject: fmt.Sprintf("Tu solicitud para adoptar a %s fue cerrada", request.Pet.Name),
+			Body: fmt.Sprintf(
+				"Hola %s,\n\n%s ya encontró un hogar, así que cerramos tu solicitud de adopción. Gracias por tu interés: en PetMatch hay muchas otras mascotas esperando una familia.",
+				other.Adopter.Name, request.Pet.Name,
+			),
+		})
+	}
+
+	return request, nil
+}
+
+// notify sends a courtesy email about a decision that has already been
+// stored, so a failure is only logged.
+func (s *AdoptionService) notify(user models.User, message mail.Message) {
+	if err := s.mailer.Send(message); err != nil {
+		log.Printf("adoption: notify user %d: %v", user.ID, err)
+	}
+}
+
+func (s *AdoptionService) can(user *models.User, meta RequestMeta, permission authz.Permission) bool {
+	return s.authz.Can(user, permission) && meta.Allows(permission)
+}
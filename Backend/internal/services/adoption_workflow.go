@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"petmatch/internal/models"
+)
+
+var (
+	ErrUnknownAdoptionStatus     = errors.New("unknown adoption request status")
+	ErrInvalidAdoptionTransition = errors.New("adoption request cannot move to that status")
+)
+
+// adoptionActor is who may move a request along a transition.
+type adoptionActor int
+
+const (
+	// adoptionReviewer is any member of the pet's shelter allowed to review
+	// requests.
+	adoptionReviewer adoptionActor = iota
+	// adoptionDecider is a manager or owner of the pet's shelter allowed to
+	// decide requests.
+	adoptionDecider
+	// adoptionAdopter is the adopter who filed the request.
+	adoptionAdopter
+)
+
+// adoptionTransitions lists, for each status, the statuses a request can move
+// to and who may move it there. Rejected, withdrawn and completed requests
+// are final.
+var adoptionTransitions = map[models.AdoptionStatus]map[models.AdoptionStatus]adoptionActor{
+	models.AdoptionStatusSubmitted: {
+		models.AdoptionStatusUnderReview: adoptionReviewer,
+		models.AdoptionStatusApproved:    adoptionDecider,
+		models.AdoptionStatusRejected:    adoptionDecider,
+		models.AdoptionStatusWithdrawn:   adoptionAdopter,
+	},
+	models.AdoptionStatusUnderReview: {
+		models.AdoptionStatusInterviewScheduled: adoptionReviewer,
+		models.AdoptionStatusApproved:           adoptionDecider,
+		models.AdoptionStatusRejected:           adoptionDecider,
+		models.AdoptionStatusWithdrawn:          adoptionAdopter,
+	},
+	models.AdoptionStatusInterviewScheduled: {
+		models.AdoptionStatusUnderReview: adoptionReviewer,
+		models.AdoptionStatusApproved:    adoptionDecider,
+		models.AdoptionStatusRejected:    adoptionDecider,
+		models.AdoptionStatusWithdrawn:   adoptionAdopter,
+	},
+	models.AdoptionStatusApproved: {
+		models.AdoptionStatusCompleted: adoptionDecider,
+		models.AdoptionStatusWithdrawn: adoptionAdopter,
+	},
+}
+
+// openAdoptionStatuses are the statuses of requests still waiting for a
+// decision. They are rejected when another request for the pet is approved.
+var openAdoptionStatuses = []models.AdoptionStatus{
+	models.AdoptionStatusSubmitted,
+	models.AdoptionStatusUnderReview,
+	models.AdoptionStatusInterviewScheduled,
+}
+
+// closedByApprovalComment explains, in their history, why open requests were
+// rejected when another request for the pet was approved.
+const closedByApprovalComment = "Another request for this pet was approved."
+
+// reopenedByWithdrawalComment explains, in their history, why requests closed
+// by an approval were reopened when that approval was withdrawn.
+const reopenedByWithdrawalComment = "The approved request for this pet was withdrawn."
+
+// ParseAdoptionStatus accepts only the statuses of the workflow.
+func ParseAdoptionStatus(status string) (models.AdoptionStatus, error) {
+	parsed := models.AdoptionStatus(status)
+	if parsed == models.AdoptionStatusSubmitted || parsed.Final() {
+		return parsed, nil
+	}
+	if _, ok := adoptionTransitions[parsed]; ok {
+		return parsed, nil
+	}
+	return "", ErrUnknownAdoptionStatus
+}
+
+// stampAdoptionStatus sets the status of the request and the time it entered
+// it. It returns the column holding that time, if the status has one.
+func stampAdoptionStatus(request *models.AdoptionRequest, status models.AdoptionStatus, at time.Time) string {
+	request.Status = status
+	request.StatusChangedAt = &at
+	request.UpdatedAt = at
+
+	switch status {
+	case models.AdoptionStatusUnderReview:
+		request.ReviewStartedAt = &at
+		return "review_started_at"
+	case models.AdoptionStatusInterviewScheduled:
+		request.InterviewScheduledAt = &at
+		return "interview_scheduled_at"
+	case models.AdoptionStatusApproved:
+		request.ApprovedAt = &at
+		return "approved_at"
+	case models.AdoptionStatusRejected:
+		request.RejectedAt = &at
+		return "rejected_at"
+	case models.AdoptionStatusWithdrawn:
+		request.WithdrawnAt = &at
+		return "withdrawn_at"
+	case models.AdoptionStatusCompleted:
+		request.CompletedAt = &at
+		return "completed_at"
+	}
+	return ""
+}
+
+// newStatusChange describes the move of the request from status from to its
+// current status, as an entry of its history.
+func newStatusChange(request *models.AdoptionRequest, from models.AdoptionStatus, actor *models.User, comment string, at time.Time) *models.AdoptionStatusChange {
+	return &models.AdoptionStatusChange{
+		RequestID: request.ID,
+		From:      from,
+		To:        request.Status,
+		ActorID:   &actor.ID,
+		Comment:   strings.TrimSpace(comment),
+		CreatedAt: at,
+	}
+}
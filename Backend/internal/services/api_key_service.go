@@ -0,0 +1,217 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"petmatch/internal/authz"
+	"petmatch/internal/models"
+	"petmatch/internal/repositories"
+)
+
+// APIKeyPrefix starts every API key, which lets the authentication
+// middleware tell keys apart from JWTs.
+const APIKeyPrefix = "pmk_"
+
+const (
+	apiKeyDisplayLength = 12
+	// apiKeyTouchInterval bounds how often last-used tracking writes.
+	apiKeyTouchInterval = time.Minute
+)
+
+var (
+	ErrInvalidAPIKey      = errors.New("invalid, expired or revoked api key")
+	ErrAPIKeyNotFound     = errors.New("api key not found")
+	ErrAPIKeyScopesEmpty  = errors.New("at least one scope is required")
+	ErrAPIKeyExpiryPassed = errors.New("expiry must be in the future")
+)
+
+// apiKeyScopes are the permissions that may be delegated to an API key: the
+// ones a shelter integration needs to sync listings and requests.
+var apiKeyScopes = map[authz.Permission]bool{
+	authz.PetsWrite:       true,
+	authz.AdoptionsReview: true,
+	authz.AdoptionsDecide: true,
+}
+
+// APIKeyScopeError reports a scope that cannot be granted to a key.
+type APIKeyScopeError struct {
+	Scope string
+}
+
+func (e *APIKeyScopeError) Error() string {
+	return fmt.Sprintf("scope %q cannot be granted to an api key", e.Scope)
+}
+
+// APIKeyService manages the API keys of shelters. Owners and managers
+// create and revoke them; a key authenticates as its creator, restricted to
+// its scopes, for as long as the creator stays in the shelter.
+type APIKeyService struct {
+	keys     *repositories.APIKeyRepository
+	shelters *repositories.ShelterRepository
+	users    *repositories.UserRepository
+	authz    *authz.Authorizer
+	audit    *Auditor
+}
+
+type CreateAPIKeyInput struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+// APIKeyPrincipal is the identity behind an authenticated API key.
+type APIKeyPrincipal struct {
+	User *models.User
+	Key  *models.APIKey
+}
+
+func NewAPIKeyService(
+	keys *repositories.APIKeyRepository,
+	shelters *repositories.ShelterRepository,
+	users *repositories.UserRepository,
+	authorizer *authz.Authorizer,
+	auditor *Auditor,
+) *APIKeyService {
+	return &APIKeyService{
+		keys:     keys,
+		shelters: shelters,
+		users:    users,
+		authz:    authorizer,
+		audit:    auditor,
+	}
+}
+
+// Create stores a new key for the user's shelter and returns it with the raw
+// secret, which is not retrievable afterwards.
+func (s *APIKeyService) Create(user *models.User, input CreateAPIKeyInput, meta RequestMeta) (*models.APIKey, string, error) {
+	member, err := s.manager(user)
+	if err != nil {
+		return nil, "", err
+	}
+
+	scopes := make([]string, 0, len(input.Scopes))
+	seen := make(map[string]bool, len(input.Scopes))
+	for _, scope := range input.Scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if scope == "" || seen[scope] {
+			continue
+		}
+		permission := authz.Permission(scope)
+		if !apiKeyScopes[permission] || !s.authz.Can(user, permission) {
+			return nil, "", &APIKeyScopeError{Scope: scope}
+		}
+		seen[scope] = true
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, "", ErrAPIKeyScopesEmpty
+	}
+
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, "", ErrAPIKeyExpiryPassed
+	}
+
+	secret, err := newOpaqueToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	raw := APIKeyPrefix + secret
+
+	key := &models.APIKey{
+		ShelterID:   member.ShelterID,
+		CreatedByID: user.ID,
+		CreatedBy:   *user,
+		Name:        strings.TrimSpace(input.Name),
+		Prefix:      raw[:apiKeyDisplayLength],
+		KeyHash:     hashToken(raw),
+		Scopes:      strings.Join(scopes, ","),
+		ExpiresAt:   input.ExpiresAt,
+	}
+	if err := s.keys.Create(key); err != nil {
+		return nil, "", err
+	}
+	s.audit.Record(user, meta, AuditAPIKeyCreate, AuditTargetAPIKey, key.ID, nil, key)
+
+	return key, raw, nil
+}
+
+func (s *APIKeyService) List(user *models.User) ([]models.APIKey, error) {
+	member, err := s.manager(user)
+	if err != nil {
+		return nil, err
+	}
+	return s.keys.ListByShelter(member.ShelterID)
+}
+
+func (s *APIKeyService) Revoke(user *models.User, keyID uint, meta RequestMeta) error {
+	member, err := s.manager(user)
+	if err != nil {
+		return err
+	}
+
+	revoked, err := s.keys.Revoke(member.ShelterID, keyID, time.Now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrAPIKeyNotFound
+	}
+	s.audit.Record(user, meta, AuditAPIKeyRevoke, AuditTargetAPIKey, keyID, nil, nil)
+	return nil
+}
+
+// Authenticate resolves a raw key to the member it acts for and records the
+// use. Keys die with their creator's membership of the shelter.
+func (s *APIKeyService) Authenticate(raw string) (*APIKeyPrincipal, error) {
+	if !strings.HasPrefix(raw, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	now := time.Now()
+	key, err := s.keys.FindByHash(hashToken(raw))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || !key.Active(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	member, err := s.shelters.FindMembership(key.CreatedByID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil || member.ShelterID != key.ShelterID || !member.Shelter.IsApproved {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.users.FindByID(key.CreatedByID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Status != models.UserStatusActive {
+		return nil, ErrInvalidAPIKey
+	}
+
+	if err := s.keys.Touch(key.ID, now, apiKeyTouchInterval); err != nil {
+		return nil, err
+	}
+
+	return &APIKeyPrincipal{User: user, Key: key}, nil
+}
+
+func (s *APIKeyService) manager(user *models.User) (*models.ShelterMember, error) {
+	member, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrNotShelterMember
+	}
+	if !atLeast(member, models.ShelterRoleManager) {
+		return nil, ErrShelterRoleForbidden
+	}
+	return member, nil
+}
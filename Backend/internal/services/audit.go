@@ -0,0 +1,198 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+
+	"petmatch/internal/authz"
+	"petmatch/internal/models"
+	"petmatch/internal/repositories"
+)
+
+// Audited actions.
+const (
+	AuditPetCreate               = "pet.create"
+	AuditPetUpdate               = "pet.update"
+	AuditPetDelete               = "pet.delete"
+	AuditPetMediaAdd             = "pet_media.add"
+	AuditPetMediaUpdate          = "pet_media.update"
+	AuditPetMediaDelete          = "pet_media.delete"
+	AuditPetMediaReorder         = "pet_media.reorder"
+	AuditAdoptionCreate          = "adoption.create"
+	AuditAdoptionStatus          = "adoption.status_change"
+	AuditAdoptionEvaluate        = "adoption.evaluation_update"
+	AuditAdoptionNoteCreate      = "adoption.note_create"
+	AuditAdoptionNoteDelete      = "adoption.note_delete"
+	AuditAdoptionFormCreate      = "adoption_form.create"
+	AuditAdoptionFormUpdate      = "adoption_form.update"
+	AuditAdoptionFormDelete      = "adoption_form.delete"
+	AuditVisitSlotCreate         = "visit_slot.create"
+	AuditVisitSlotDelete         = "visit_slot.delete"
+	AuditVisitBook               = "visit.book"
+	AuditVisitReschedule         = "visit.reschedule"
+	AuditVisitCancel             = "visit.cancel"
+	AuditShelterUpdate           = "shelter.update"
+	AuditShelterApprove          = "shelter.approve"
+	AuditShelterInvite           = "shelter.invite"
+	AuditShelterInvitationRevoke = "shelter.invitation_revoke"
+	AuditShelterJoin             = "shelter.join"
+	AuditShelterMemberRole       = "shelter.member_role_change"
+	AuditShelterMemberRemove     = "shelter.member_remove"
+	AuditAPIKeyCreate            = "api_key.create"
+	AuditAPIKeyRevoke            = "api_key.revoke"
+	AuditUserRoleChange          = "user.role_change"
+	AuditUserReject              = "user.reject"
+	AuditUserSuspend             = "user.suspend"
+	AuditUserReinstate           = "user.reinstate"
+	AuditUserImpersonate         = "user.impersonate"
+	AuditUserProfileUpdate       = "user.profile_update"
+	AuditUserPasswordChange      = "user.password_change"
+	AuditUserEmailChange         = "user.email_change"
+	AuditUserTwoFactorDisable    = "user.two_factor_disable"
+	AuditUserRecoveryCodesReset  = "user.recovery_codes_reset"
+	AuditLockoutClear            = "lockout.clear"
+)
+
+// Audit target types.
+const (
+	AuditTargetPet          = "pet"
+	AuditTargetPetMedia     = "pet_media"
+	AuditTargetAdoption     = "adoption_request"
+	AuditTargetAdoptionNote = "adoption_note"
+	AuditTargetAdoptionForm = "adoption_form"
+	AuditTargetVisitSlot    = "visit_slot"
+	AuditTargetVisit        = "visit"
+	AuditTargetShelter      = "shelter"
+	AuditTargetInvitation   = "shelter_invitation"
+	AuditTargetAPIKey       = "api_key"
+	AuditTargetUser         = "user"
+	AuditTargetLockout      = "lockout"
+)
+
+// RequestMeta describes the request an action comes from, for the audit log.
+// APIKey is set when the request was authenticated with a key, whose scopes
+// then bound what the user may do.
+type RequestMeta struct {
+	IP             string
+	RequestID      string
+	ImpersonatorID *uint
+	APIKey         *models.APIKey
+}
+
+// Allows reports whether the credentials of the request cover permission.
+// Interactive sessions are only limited by the user's role.
+func (m RequestMeta) Allows(permission authz.Permission) bool {
+	return m.APIKey == nil || m.APIKey.HasScope(string(permission))
+}
+
+// AuditChange is the value of a field before and after an action.
+type AuditChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Auditor writes the audit log. Services call it once an action has been
+// stored; a failure to record is logged rather than undoing the action.
+type Auditor struct {
+	events *repositories.AuditRepository
+}
+
+func NewAuditor(events *repositories.AuditRepository) *Auditor {
+	return &Auditor{events: events}
+}
+
+// Record logs action on the target. before and after are snapshots of the
+// target (nil when it was created or deleted); only the fields that differ
+// are kept.
+func (a *Auditor) Record(actor *models.User, meta RequestMeta, action, targetType string, targetID uint, before, after interface{}) {
+	event := &models.AuditEvent{
+		ImpersonatorID: meta.ImpersonatorID,
+		Action:         action,
+		TargetType:     targetType,
+		TargetID:       targetID,
+		IP:             meta.IP,
+		RequestID:      meta.RequestID,
+	}
+	if actor != nil {
+		event.ActorID = &actor.ID
+	}
+	if meta.APIKey != nil {
+		event.APIKeyID = &meta.APIKey.ID
+	}
+
+	changes, err := json.Marshal(auditDiff(before, after))
+	if err == nil {
+		event.Changes = string(changes)
+		err = a.events.Create(event)
+	}
+	if err != nil {
+		log.Printf("failed to record audit event %s on %s %d: %v", action, targetType, targetID, err)
+	}
+}
+
+func (a *Auditor) List(filter repositories.AuditFilter, page repositories.PageRequest) ([]models.AuditEvent, repositories.PageInfo, error) {
+	return a.events.List(filter, page)
+}
+
+// auditDiff compares the scalar fields of two snapshots. Associations,
+// timestamps and secrets are left out.
+func auditDiff(before, after interface{}) map[string]AuditChange {
+	from := auditFields(before)
+	to := auditFields(after)
+
+	diff := make(map[string]AuditChange)
+	for field, value := range from {
+		if other, ok := to[field]; !ok || !reflect.DeepEqual(value, other) {
+			diff[field] = AuditChange{From: value, To: to[field]}
+		}
+	}
+	for field, value := range to {
+		if _, ok := from[field]; !ok {
+			diff[field] = AuditChange{To: value}
+		}
+	}
+	return diff
+}
+
+func auditFields(snapshot interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if snapshot == nil {
+		return fields
+	}
+	if value := reflect.ValueOf(snapshot); value.Kind() == reflect.Ptr && value.IsNil() {
+		return fields
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fields
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fields
+	}
+
+	for field, value := range raw {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			continue
+		}
+		if field == "CreatedAt" || field == "UpdatedAt" || auditSecret(field) {
+			continue
+		}
+		fields[field] = value
+	}
+	return fields
+}
+
+func auditSecret(field string) bool {
+	field = strings.ToLower(field)
+	for _, word := range []string{"password", "hash", "secret", "token"} {
+		if strings.Contains(field, word) {
+			return true
+		}
+	}
+	return false
+}
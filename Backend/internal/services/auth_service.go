@@ -8,8 +8,10 @@ import (
 	"time"
 
 	"petmatch/internal/config"
+	"petmatch/internal/lockout"
 	"petmatch/internal/models"
 	"petmatch/internal/repositories"
+	"petmatch/internal/signing"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
@@ -21,14 +23,43 @@ var (
 	ErrShelterNotApproved    = errors.New("shelter account pending approval")
 	ErrUnsupportedRole       = errors.New("unsupported role")
 	ErrAdminCredentialsUnset = errors.New("admin credentials must not be empty")
+	ErrInvalidRefreshToken   = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused    = errors.New("refresh token already used, session revoked")
 )
 
+// dummyPasswordHash is compared against when the email is unknown, so that
+// the answer takes as long as for a wrong password and doesn't tell which
+// emails are registered. Its cost matches bcrypt.DefaultCost.
+const dummyPasswordHash = "$2a$10$3TEjUG6I3moIerWS.PIjJ.RZgLhJR4wdSDAB3RBlqslXgRFDKCU/S"
+
+// LoginThrottledError is returned while an account or client IP is locked
+// out or has to wait before the next attempt.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
 type AuthService struct {
-	users          *repositories.UserRepository
-	jwtSecret      []byte
-	adminEmail     string
-	adminPassword  string
-	tokenExpiresIn time.Duration
+	users            *repositories.UserRepository
+	sessions         *repositories.SessionRepository
+	twoFactors       *repositories.TwoFactorRepository
+	shelters         *repositories.ShelterRepository
+	impersonations   *repositories.ImpersonationRepository
+	guard            *lockout.Guard
+	keys             *signing.KeyRing
+	audit            *Auditor
+	issuer           string
+	adminEmail       string
+	adminPassword    string
+	accessTokenTTL   time.Duration
+	refreshTokenTTL  time.Duration
+	impersonationTTL time.Duration
+	requireVerified  bool
+	totpIssuer       string
+	twoFactorRoles   map[models.UserRole]bool
 }
 
 type RegisterInput struct {
@@ -41,22 +72,53 @@ type RegisterInput struct {
 	City        *string
 }
 
+// LoginOutput carries either a new session or, when a second factor is still
+// needed, only a Challenge.
 type LoginOutput struct {
-	Token string
-	User  models.User
+	Token        string
+	RefreshToken string
+	ExpiresIn    time.Duration
+	User         models.User
+	Challenge    *TwoFactorChallenge
 }
 
-func NewAuthService(repo *repositories.UserRepository, cfg config.Config) (*AuthService, error) {
+func NewAuthService(
+	repo *repositories.UserRepository,
+	sessions *repositories.SessionRepository,
+	twoFactors *repositories.TwoFactorRepository,
+	shelters *repositories.ShelterRepository,
+	impersonations *repositories.ImpersonationRepository,
+	guard *lockout.Guard,
+	keys *signing.KeyRing,
+	auditor *Auditor,
+	cfg config.Config,
+) (*AuthService, error) {
 	if strings.TrimSpace(cfg.AdminEmail) == "" || strings.TrimSpace(cfg.AdminPassword) == "" {
 		return nil, ErrAdminCredentialsUnset
 	}
 
 	service := &AuthService{
-		users:          repo,
-		jwtSecret:      []byte(cfg.JWTSecret),
-		adminEmail:     cfg.AdminEmail,
-		adminPassword:  cfg.AdminPassword,
-		tokenExpiresIn: 24 * time.Hour,
+		users:            repo,
+		sessions:         sessions,
+		twoFactors:       twoFactors,
+		shelters:         shelters,
+		impersonations:   impersonations,
+		guard:            guard,
+		keys:             keys,
+		audit:            auditor,
+		issuer:           cfg.JWTIssuer,
+		adminEmail:       cfg.AdminEmail,
+		adminPassword:    cfg.AdminPassword,
+		accessTokenTTL:   cfg.AccessTokenTTL,
+		refreshTokenTTL:  cfg.RefreshTokenTTL,
+		impersonationTTL: cfg.ImpersonationTTL,
+		requireVerified:  cfg.RequireVerifiedEmailForLogin,
+		totpIssuer:       cfg.TwoFactorIssuer,
+		twoFactorRoles:   make(map[models.UserRole]bool),
+	}
+
+	for _, role := range cfg.TwoFactorRequiredRoles {
+		service.twoFactorRoles[models.UserRole(strings.ToLower(role))] = true
 	}
 
 	if err := service.ensureDefaultAdmin(); err != nil {
@@ -94,51 +156,168 @@ func (s *AuthService) Register(input RegisterInput) (*models.User, error) {
 		Phone:        input.Phone,
 		City:         input.City,
 		IsApproved:   role != models.RoleShelter,
+		Status:       models.UserStatusActive,
+	}
+
+	if role != models.RoleShelter {
+		if err := s.users.Create(user); err != nil {
+			return nil, err
+		}
+		return user, nil
 	}
 
-	if err := s.users.Create(user); err != nil {
+	// A shelter sign-up creates the organization too, owned by the new user,
+	// and waits for an admin.
+	user.Status = models.UserStatusPending
+	shelter := &models.Shelter{
+		Name:  input.Name,
+		Phone: input.Phone,
+		City:  input.City,
+	}
+	if input.ShelterName != nil && strings.TrimSpace(*input.ShelterName) != "" {
+		shelter.Name = strings.TrimSpace(*input.ShelterName)
+	}
+	if err := s.shelters.CreateWithOwner(shelter, user); err != nil {
 		return nil, err
 	}
 
 	return user, nil
 }
 
-func (s *AuthService) Login(email, password string) (*LoginOutput, error) {
+// Login checks the password of the account. clientIP is used, together with
+// the email, to throttle repeated failures.
+func (s *AuthService) Login(email, password, clientIP string) (*LoginOutput, error) {
+	if err := s.reserveAttempt(email, clientIP); err != nil {
+		return nil, err
+	}
+
 	user, err := s.users.FindByEmail(strings.ToLower(email))
 	if err != nil {
-		return nil, err
+		return nil, s.releaseAttempt(email, clientIP, err)
 	}
 	if user == nil {
+		bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
 		return nil, ErrInvalidCredentials
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
 		return nil, ErrInvalidCredentials
 	}
+	if err := s.guard.Release(email, clientIP); err != nil {
+		return nil, err
+	}
 
-	if user.Role == models.RoleShelter && !user.IsApproved {
-		return nil, ErrShelterNotApproved
+	if err := checkAccountStatus(user); err != nil {
+		return nil, err
 	}
 
-	token, err := s.generateToken(*user)
+	if s.requireVerified && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	challenge, err := s.twoFactorChallenge(user)
 	if err != nil {
 		return nil, err
 	}
+	if challenge != nil {
+		return &LoginOutput{User: *user, Challenge: challenge}, nil
+	}
 
-	return &LoginOutput{
-		Token: token,
-		User:  *user,
-	}, nil
+	if err := s.guard.Succeed(user.Email); err != nil {
+		return nil, err
+	}
+
+	return s.startSession(user)
 }
 
-func (s *AuthService) ParseToken(rawToken string) (*models.User, error) {
-	token, err := jwt.Parse(rawToken, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+// Refresh exchanges a refresh token for a new access/refresh pair. Each
+// refresh token can be used once; presenting an already used token revokes
+// the whole session because it means the token family has leaked.
+func (s *AuthService) Refresh(rawRefreshToken string) (*LoginOutput, error) {
+	token, err := s.sessions.FindRefreshTokenByHash(hashToken(rawRefreshToken))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	session, err := s.sessions.FindByID(token.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if session == nil || !session.Active(now) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if token.UsedAt != nil {
+		if err := s.sessions.Revoke(session.ID); err != nil {
+			return nil, err
 		}
-		return s.jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
+		return nil, ErrRefreshTokenReused
+	}
+
+	if !now.Before(token.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	claimed, err := s.sessions.MarkRefreshTokenUsed(token.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		if err := s.sessions.Revoke(session.ID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+
+	user, err := s.users.FindByID(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	return s.rotateSession(session, user)
+}
+
+// Logout revokes the session the refresh token belongs to, which also
+// invalidates every access token issued for it.
+func (s *AuthService) Logout(rawRefreshToken string) error {
+	token, err := s.sessions.FindRefreshTokenByHash(hashToken(rawRefreshToken))
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return ErrInvalidRefreshToken
+	}
+	return s.sessions.Revoke(token.SessionID)
+}
+
+// AccessToken is the verified content of an access JWT. Impersonation is set
+// when an admin is acting as User.
+type AccessToken struct {
+	User          *models.User
+	SessionID     string
+	Impersonation *models.Impersonation
+}
+
+func (s *AuthService) ParseToken(rawToken string) (*models.User, error) {
+	access, err := s.ParseAccessToken(rawToken)
+	if err != nil {
+		return nil, err
+	}
+	return access.User, nil
+}
+
+// ParseAccessToken verifies an access token and checks that its session is
+// still active.
+func (s *AuthService) ParseAccessToken(rawToken string) (*AccessToken, error) {
+	token, err := s.parseJWT(rawToken)
+	if err != nil {
 		return nil, ErrInvalidCredentials
 	}
 
@@ -152,6 +331,19 @@ func (s *AuthService) ParseToken(rawToken string) (*models.User, error) {
 		return nil, ErrInvalidCredentials
 	}
 
+	sid, ok := claims["sid"].(string)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	session, err := s.sessions.FindByID(sid)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || !session.Active(time.Now()) {
+		return nil, ErrInvalidCredentials
+	}
+
 	id, err := strconv.Atoi(sub)
 	if err != nil {
 		return nil, ErrInvalidCredentials
@@ -161,30 +353,165 @@ func (s *AuthService) ParseToken(rawToken string) (*models.User, error) {
 	if err != nil {
 		return nil, err
 	}
-	if user == nil {
+	if user == nil || user.ID != session.UserID || user.Status != models.UserStatusActive {
 		return nil, ErrInvalidCredentials
 	}
-	return user, nil
+
+	access := &AccessToken{User: user, SessionID: session.ID}
+	if act, ok := claims["act"]; ok {
+		access.Impersonation, err = s.impersonationFor(session.ID, act)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return access, nil
 }
 
-func (s *AuthService) ApproveShelter(user *models.User) error {
-	user.IsApproved = true
-	return s.users.Update(user)
+// Lockouts lists the accounts and IPs with failed attempts on record.
+func (s *AuthService) Lockouts() ([]lockout.Entry, error) {
+	return s.guard.Entries()
+}
+
+// ClearLockout forgets the failed attempts of an account (by email) or of a
+// client IP. The audit event keeps the entry that was cleared.
+func (s *AuthService) ClearLockout(admin *models.User, kind, value string, meta RequestMeta) error {
+	entry, _, err := s.guard.Entry(kind, value)
+	if err != nil {
+		return err
+	}
+	entry.Key = lockout.Key(kind, value)
+
+	if err := s.guard.Clear(kind, value); err != nil {
+		return err
+	}
+
+	s.audit.Record(admin, meta, AuditLockoutClear, AuditTargetLockout, 0, &entry, nil)
+	return nil
+}
+
+// reserveAttempt counts a login attempt as failed before its credentials are
+// checked, so concurrent guesses cannot all slip past the limit. Callers give
+// it back with releaseAttempt, or guard.Release, when the attempt did not
+// fail on the credentials.
+func (s *AuthService) reserveAttempt(email, clientIP string) error {
+	wait, err := s.guard.Attempt(email, clientIP, time.Now())
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &LoginThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// releaseAttempt gives back a reserved attempt and returns cause so callers
+// can write `return nil, s.releaseAttempt(...)`.
+func (s *AuthService) releaseAttempt(email, clientIP string, cause error) error {
+	if err := s.guard.Release(email, clientIP); err != nil {
+		return err
+	}
+	return cause
+}
+
+func (s *AuthService) startSession(user *models.User) (*LoginOutput, error) {
+	id, err := newOpaqueToken(24)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &models.Session{
+		ID:        id,
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(s.refreshTokenTTL),
+	}
+	if err := s.sessions.Create(session); err != nil {
+		return nil, err
+	}
+
+	return s.issueTokens(session, user)
 }
 
-func (s *AuthService) generateToken(user models.User) (string, error) {
+func (s *AuthService) rotateSession(session *models.Session, user *models.User) (*LoginOutput, error) {
+	expiresAt := time.Now().Add(s.refreshTokenTTL)
+	if err := s.sessions.Extend(session.ID, expiresAt); err != nil {
+		return nil, err
+	}
+	session.ExpiresAt = expiresAt
+
+	return s.issueTokens(session, user)
+}
+
+func (s *AuthService) issueTokens(session *models.Session, user *models.User) (*LoginOutput, error) {
+	if err := checkAccountStatus(user); err != nil {
+		return nil, err
+	}
+
+	rawRefresh, err := newOpaqueToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh := &models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(rawRefresh),
+		ExpiresAt: session.ExpiresAt,
+	}
+	if err := s.sessions.CreateRefreshToken(refresh); err != nil {
+		return nil, err
+	}
+
+	access, err := s.generateToken(*user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoginOutput{
+		Token:        access,
+		RefreshToken: rawRefresh,
+		ExpiresIn:    s.accessTokenTTL,
+		User:         *user,
+	}, nil
+}
+
+func (s *AuthService) generateToken(user models.User, sessionID string) (string, error) {
 	now := time.Now()
-	claims := jwt.MapClaims{
+	return s.keys.Sign(s.accessClaims(user, sessionID, now, now.Add(s.accessTokenTTL)))
+}
+
+func (s *AuthService) accessClaims(user models.User, sessionID string, issuedAt, expiresAt time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
 		"sub":   fmt.Sprint(user.ID),
+		"sid":   sessionID,
 		"role":  user.Role,
 		"name":  user.Name,
 		"email": user.Email,
-		"iat":   now.Unix(),
-		"exp":   now.Add(s.tokenExpiresIn).Unix(),
+		"iss":   s.issuer,
+		"iat":   issuedAt.Unix(),
+		"exp":   expiresAt.Unix(),
 	}
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(s.jwtSecret)
+func (s *AuthService) parseJWT(rawToken string) (*jwt.Token, error) {
+	token, err := jwt.Parse(rawToken, s.keys.Keyfunc, jwt.WithIssuer(s.issuer))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, ErrInvalidCredentials
+	}
+	return token, nil
+}
+
+// MaxTokenLifetime is the longest a JWT issued by AuthService stays valid.
+// Signing keys must keep verifying for at least this long after retirement.
+func MaxTokenLifetime(cfg config.Config) time.Duration {
+	lifetime := challengeTokenTTL
+	for _, ttl := range []time.Duration{cfg.AccessTokenTTL, cfg.ImpersonationTTL} {
+		if ttl > lifetime {
+			lifetime = ttl
+		}
+	}
+	return lifetime
 }
 
 func (s *AuthService) ensureDefaultAdmin() error {
@@ -202,12 +529,16 @@ func (s *AuthService) ensureDefaultAdmin() error {
 		return err
 	}
 
+	now := time.Now()
 	user := &models.User{
-		Name:         "Platform Admin",
-		Email:        strings.ToLower(s.adminEmail),
-		PasswordHash: string(hash),
-		Role:         models.RoleAdmin,
-		IsApproved:   true,
+		Name:            "Platform Admin",
+		Email:           strings.ToLower(s.adminEmail),
+		PasswordHash:    string(hash),
+		Role:            models.RoleAdmin,
+		IsApproved:      true,
+		Status:          models.UserStatusActive,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
 	}
 
 	return s.users.Create(user)
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"petmatch/internal/models"
+	"petmatch/internal/repositories"
+)
+
+var (
+	ErrCannotImpersonateSelf = errors.New("admins cannot impersonate themselves")
+	ErrCannotImpersonate     = errors.New("this account cannot be impersonated")
+	ErrImpersonationNotFound = errors.New("impersonation not found")
+)
+
+// impersonationListLimit caps how many impersonations the admin listing
+// returns.
+const impersonationListLimit = 100
+
+// ImpersonationOutput is the short-lived access token an admin uses to see
+// the API as another user.
+type ImpersonationOutput struct {
+	Token         string
+	ExpiresIn     time.Duration
+	Impersonation *models.Impersonation
+}
+
+// Impersonate starts a support session as the user. The token names the
+// admin in its "act" claim and cannot be refreshed; every request made with
+// it is recorded.
+func (s *AuthService) Impersonate(admin *models.User, userID uint, reason string, meta RequestMeta) (*ImpersonationOutput, error) {
+	if admin.ID == userID {
+		return nil, ErrCannotImpersonateSelf
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrStatusReasonRequired
+	}
+
+	user, err := s.users.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	// Impersonated tokens cannot reach admin routes anyway; refusing admins
+	// keeps one admin from acting under another's name.
+	if user.Role == models.RoleAdmin || user.Status != models.UserStatusActive {
+		return nil, ErrCannotImpersonate
+	}
+
+	id, err := newOpaqueToken(24)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		ID:        id,
+		UserID:    user.ID,
+		ExpiresAt: now.Add(s.impersonationTTL),
+	}
+	impersonation := &models.Impersonation{
+		ImpersonatorID: admin.ID,
+		UserID:         user.ID,
+		Reason:         reason,
+		ExpiresAt:      session.ExpiresAt,
+	}
+	if err := s.impersonations.Create(impersonation, session); err != nil {
+		return nil, err
+	}
+	impersonation.Impersonator = *admin
+	impersonation.User = *user
+	s.audit.Record(admin, meta, AuditUserImpersonate, AuditTargetUser, user.ID, nil, impersonation)
+
+	claims := s.accessClaims(*user, session.ID, now, session.ExpiresAt)
+	claims["act"] = map[string]interface{}{"sub": fmt.Sprint(admin.ID)}
+	token, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ImpersonationOutput{
+		Token:         token,
+		ExpiresIn:     s.impersonationTTL,
+		Impersonation: impersonation,
+	}, nil
+}
+
+// StopImpersonation ends the impersonation the session belongs to before it
+// expires.
+func (s *AuthService) StopImpersonation(sessionID string) error {
+	return s.sessions.Revoke(sessionID)
+}
+
+// RecordImpersonatedRequest adds a request to the impersonation's trail.
+func (s *AuthService) RecordImpersonatedRequest(impersonation *models.Impersonation, method, path string, status int, clientIP string) error {
+	return s.impersonations.RecordRequest(&models.ImpersonatedRequest{
+		ImpersonationID: impersonation.ID,
+		Method:          method,
+		Path:            path,
+		Status:          status,
+		ClientIP:        clientIP,
+	})
+}
+
+// Impersonations lists recent impersonations, newest first.
+func (s *AuthService) Impersonations(filter repositories.ImpersonationFilter) ([]models.Impersonation, error) {
+	return s.impersonations.List(filter, impersonationListLimit)
+}
+
+// ImpersonatedRequests returns the requests made during an impersonation in
+// the order they happened.
+func (s *AuthService) ImpersonatedRequests(impersonationID uint) ([]models.ImpersonatedRequest, error) {
+	impersonation, err := s.impersonations.FindByID(impersonationID)
+	if err != nil {
+		return nil, err
+	}
+	if impersonation == nil {
+		return nil, ErrImpersonationNotFound
+	}
+	return s.impersonations.ListRequests(impersonation.ID)
+}
+
+// impersonationFor checks the "act" claim of an access token against the
+// impersonation recorded for its session. The admin behind it must still be
+// active.
+func (s *AuthService) impersonationFor(sessionID string, act interface{}) (*models.Impersonation, error) {
+	actor, ok := act.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	sub, ok := actor["sub"].(string)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	impersonation, err := s.impersonations.FindBySessionID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if impersonation == nil || fmt.Sprint(impersonation.ImpersonatorID) != sub ||
+		impersonation.Impersonator.Status != models.UserStatusActive {
+		return nil, ErrInvalidCredentials
+	}
+	return impersonation, nil
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"petmatch/internal/models"
+	"petmatch/internal/repositories"
+)
+
+const (
+	maxMessageBody        = 5000
+	maxMessageAttachments = 5
+)
+
+var (
+	ErrMessageEmpty       = errors.New("a message needs text or an attachment")
+	ErrMessageTooLong     = errors.New("message must be at most 5000 characters")
+	ErrInvalidAttachment  = errors.New("attachments need a name and an http(s) url")
+	ErrTooManyAttachments = errors.New("a message can have at most 5 attachments")
+	ErrConversationClosed = errors.New("the conversation of a rejected or withdrawn request is closed")
+	ErrMessageNotFound    = errors.New("message not found")
+)
+
+// MessageService runs the conversation each adoption request has between
+// its adopter and the members of the pet's shelter.
+type MessageService struct {
+	messages  *repositories.MessageRepository
+	adoptions *repositories.AdoptionRepository
+	shelters  *repositories.ShelterRepository
+}
+
+type SendMessageInput struct {
+	Body        string
+	Attachments []AttachmentInput
+}
+
+type AttachmentInput struct {
+	Name        string
+	URL         string
+	ContentType string
+	Size        int64
+}
+
+// Conversation is one page of a request's messages, newest first, together
+// with the read receipts of its participants.
+type Conversation struct {
+	Messages []models.AdoptionMessage
+	Total    int64
+	Reads    []models.ConversationRead
+}
+
+// UnreadMessages is how many messages each conversation of a user has that
+// the user has not read.
+type UnreadMessages struct {
+	Total    int64
+	Requests []repositories.UnreadCount
+}
+
+func NewMessageService(
+	messages *repositories.MessageRepository,
+	adoptions *repositories.AdoptionRepository,
+	shelters *repositories.ShelterRepository,
+) *MessageService {
+	return &MessageService{
+		messages:  messages,
+		adoptions: adoptions,
+		shelters:  shelters,
+	}
+}
+
+func (s *MessageService) List(user *models.User, requestID uint, offset, limit int) (*Conversation, error) {
+	request, _, err := s.participant(user, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, total, err := s.messages.List(request.ID, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	reads, err := s.messages.ListReads(request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conversation{Messages: messages, Total: total, Reads: reads}, nil
+}
+
+// Send posts a message to the request's conversation. Sending marks the
+// conversation read for the sender.
+func (s *MessageService) Send(user *models.User, requestID uint, input SendMessageInput) (*models.AdoptionMessage, error) {
+	body := strings.TrimSpace(input.Body)
+	if utf8.RuneCountInString(body) > maxMessageBody {
+		return nil, ErrMessageTooLong
+	}
+	if body == "" && len(input.Attachments) == 0 {
+		return nil, ErrMessageEmpty
+	}
+	attachments, err := messageAttachments(input.Attachments)
+	if err != nil {
+		return nil, err
+	}
+
+	request, fromShelter, err := s.participant(user, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if request.Status == models.AdoptionStatusRejected || request.Status == models.AdoptionStatusWithdrawn {
+		return nil, ErrConversationClosed
+	}
+
+	message := &models.AdoptionMessage{
+		RequestID:   request.ID,
+		SenderID:    &user.ID,
+		FromShelter: fromShelter,
+		Body:        body,
+		Attachments: attachments,
+	}
+	if err := s.messages.Create(message); err != nil {
+		return nil, err
+	}
+	message.Sender = user
+
+	if err := s.messages.MarkRead(&models.ConversationRead{
+		RequestID:         request.ID,
+		UserID:            user.ID,
+		LastReadMessageID: message.ID,
+		ReadAt:            message.CreatedAt,
+	}); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
+
+// MarkRead records that the user has read the conversation up to messageID,
+// or up to its newest message when messageID is 0.
+func (s *MessageService) MarkRead(user *models.User, requestID, messageID uint) (*models.ConversationRead, error) {
+	request, _, err := s.participant(user, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := s.messages.LatestID(request.ID)
+	if err != nil {
+		return nil, err
+	}
+	if messageID == 0 {
+		messageID = latest
+	}
+	if messageID > latest {
+		return nil, ErrMessageNotFound
+	}
+
+	read := &models.ConversationRead{
+		RequestID:         request.ID,
+		UserID:            user.ID,
+		User:              *user,
+		LastReadMessageID: messageID,
+		ReadAt:            time.Now(),
+	}
+	if err := s.messages.MarkRead(read); err != nil {
+		return nil, err
+	}
+	return read, nil
+}
+
+// Unread counts the messages from the other side that the user has not
+// read, per conversation: the shelter's messages for an adopter, the
+// adopters' messages for a shelter member.
+func (s *MessageService) Unread(user *models.User) (*UnreadMessages, error) {
+	member, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var counts []repositories.UnreadCount
+	if member != nil {
+		counts, err = s.messages.UnreadForShelter(user.ID, member.ShelterID)
+	} else {
+		counts, err = s.messages.UnreadForAdopter(user.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	unread := &UnreadMessages{Requests: counts}
+	for _, count := range counts {
+		unread.Total += count.Unread
+	}
+	return unread, nil
+}
+
+// participant returns the request if the user takes part in its
+// conversation, and whether they do so for the shelter. Other users are told
+// the request does not exist.
+func (s *MessageService) participant(user *models.User, requestID uint) (*models.AdoptionRequest, bool, error) {
+	request, err := s.adoptions.FindByID(requestID)
+	if err != nil {
+		return nil, false, err
+	}
+	if request == nil {
+		return nil, false, ErrRequestNotFound
+	}
+	if request.AdopterID == user.ID {
+		return request, false, nil
+	}
+
+	member, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	if member == nil || member.ShelterID != request.Pet.ShelterID {
+		return nil, false, ErrRequestNotFound
+	}
+	return request, true, nil
+}
+
+func messageAttachments(inputs []AttachmentInput) ([]models.MessageAttachment, error) {
+	if len(inputs) > maxMessageAttachments {
+		return nil, ErrTooManyAttachments
+	}
+
+	attachments := make([]models.MessageAttachment, 0, len(inputs))
+	for _, input := range inputs {
+		name := strings.TrimSpace(input.Name)
+		link, err := url.Parse(strings.TrimSpace(input.URL))
+		if name == "" || utf8.RuneCountInString(name) > 255 || err != nil ||
+			(link.Scheme != "http" && link.Scheme != "https") || link.Host == "" ||
+			len(link.String()) > 1000 || len(input.ContentType) > 100 || input.Size < 0 {
+			return nil, ErrInvalidAttachment
+		}
+		attachments = append(attachments, models.MessageAttachment{
+			Name:        name,
+			URL:         link.String(),
+			ContentType: strings.TrimSpace(input.ContentType),
+			Size:        input.Size,
+		})
+	}
+	return attachments, nil
+}
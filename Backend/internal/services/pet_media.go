@@ -0,0 +1,328 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"petmatch/internal/images"
+	"petmatch/internal/models"
+)
+
+// Longest side, in pixels, of the sizes made for every photo of a gallery.
+const (
+	mediaWebSize       = 1280
+	mediaThumbnailSize = 320
+)
+
+// videoExtensions lists the video formats galleries accept.
+var videoExtensions = map[string]string{
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+var (
+	ErrPetMediaNotFound     = errors.New("media not found")
+	ErrPetMediaUnsupported  = errors.New("only JPEG and PNG photos and MP4 and WebM videos are accepted")
+	ErrPetMediaCoverVideo   = errors.New("only a photo can be the cover")
+	ErrPetMediaInvalidOrder = errors.New("the order must list every media of the pet once")
+)
+
+// MediaTooLargeError reports an upload to a gallery above the size limit
+// for its kind.
+type MediaTooLargeError struct {
+	Kind  models.PetMediaKind
+	Limit int
+}
+
+func (e *MediaTooLargeError) Error() string {
+	kind := string(e.Kind)
+	if kind == "" {
+		kind = "file"
+	}
+	return fmt.Sprintf("%s must be at most %d bytes", kind, e.Limit)
+}
+
+type UpdatePetMediaInput struct {
+	Caption *string
+	// Cover makes the photo the cover of the gallery.
+	Cover bool
+}
+
+// MediaLimit is the largest upload, in bytes, AddMedia accepts.
+func (s *PetService) MediaLimit() int {
+	return max(s.maxPhotoSize, s.maxVideoSize)
+}
+
+// Gallery lists every media of a pet of the user's shelter, including the
+// photos still being processed.
+func (s *PetService) Gallery(user *models.User, petID uint) ([]models.PetMedia, error) {
+	pet, err := s.managedPet(user, petID)
+	if err != nil {
+		return nil, err
+	}
+	return s.media.ListByPet(pet.ID)
+}
+
+// AddMedia adds a photo or video to the end of the pet's gallery. Photos are
+// stripped of their metadata and wait in the processing status until their
+// smaller sizes are ready; videos are kept as uploaded.
+func (s *PetService) AddMedia(user *models.User, petID uint, data []byte, caption string, meta RequestMeta) (*models.PetMedia, error) {
+	pet, err := s.managedPet(user, petID)
+	if err != nil {
+		return nil, err
+	}
+
+	media := &models.PetMedia{
+		PetID:   pet.ID,
+		Caption: strings.TrimSpace(caption),
+	}
+	var extension string
+	contentType := http.DetectContentType(data)
+	if ext, ok := videoExtensions[contentType]; ok {
+		if len(data) > s.maxVideoSize {
+			return nil, &MediaTooLargeError{Kind: models.PetMediaVideo, Limit: s.maxVideoSize}
+		}
+		media.Kind = models.PetMediaVideo
+		media.Status = models.PetMediaReady
+		extension = ext
+	} else {
+		if len(data) > s.maxPhotoSize {
+			return nil, &MediaTooLargeError{Kind: models.PetMediaPhoto, Limit: s.maxPhotoSize}
+		}
+		img, err := images.Prepare(data)
+		if errors.Is(err, images.ErrUnsupported) {
+			return nil, ErrPetMediaUnsupported
+		}
+		if err != nil {
+			return nil, err
+		}
+		media.Kind = models.PetMediaPhoto
+		media.Status = models.PetMediaProcessing
+		media.Width, media.Height = img.Width, img.Height
+		data, contentType, extension = img.Data, img.ContentType, img.Extension
+	}
+
+	token, err := newOpaqueToken(16)
+	if err != nil {
+		return nil, err
+	}
+	media.Key = fmt.Sprintf("pet-%d-media-%s%s", pet.ID, token, extension)
+	media.URL = s.photoURL(media.Key)
+	media.ContentType = contentType
+	media.Size = len(data)
+	if err := s.store.Put(media.Key, data, contentType); err != nil {
+		return nil, err
+	}
+	if err := s.media.Create(media); err != nil {
+		s.deletePhoto(media.Key)
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditPetMediaAdd, AuditTargetPetMedia, media.ID, nil, media)
+
+	if media.Status == models.PetMediaProcessing {
+		select {
+		case s.mediaQueued <- struct{}{}:
+		default:
+		}
+	}
+	return media, nil
+}
+
+// UpdateMedia changes the caption of a media or makes it the cover.
+func (s *PetService) UpdateMedia(user *models.User, petID, mediaID uint, input UpdatePetMediaInput, meta RequestMeta) (*models.PetMedia, error) {
+	media, err := s.managedMedia(user, petID, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Cover && media.Kind != models.PetMediaPhoto {
+		return nil, ErrPetMediaCoverVideo
+	}
+
+	before := *media
+	if input.Caption != nil {
+		media.Caption = strings.TrimSpace(*input.Caption)
+		if err := s.media.UpdateCaption(media); err != nil {
+			return nil, err
+		}
+	}
+	if input.Cover && !media.Cover {
+		if err := s.media.SetCover(media); err != nil {
+			return nil, err
+		}
+	}
+	s.audit.Record(user, meta, AuditPetMediaUpdate, AuditTargetPetMedia, media.ID, &before, media)
+	return media, nil
+}
+
+// ReorderMedia shows the pet's gallery in the order of ids, which must list
+// every media of the pet once.
+func (s *PetService) ReorderMedia(user *models.User, petID uint, ids []uint, meta RequestMeta) ([]models.PetMedia, error) {
+	pet, err := s.managedPet(user, petID)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return nil, ErrPetMediaInvalidOrder
+		}
+		seen[id] = true
+	}
+
+	before, err := s.media.ListByPet(pet.ID)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := s.media.Reorder(pet.ID, ids)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrPetMediaInvalidOrder
+	}
+	after, err := s.media.ListByPet(pet.ID)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditPetMediaReorder, AuditTargetPet, pet.ID, mediaIDs(before), mediaIDs(after))
+	return after, nil
+}
+
+// DeleteMedia removes a media and its files. Deleting the cover hands it to
+// the next photo of the gallery.
+func (s *PetService) DeleteMedia(user *models.User, petID, mediaID uint, meta RequestMeta) error {
+	media, err := s.managedMedia(user, petID, mediaID)
+	if err != nil {
+		return err
+	}
+	if err := s.media.Delete(media); err != nil {
+		return err
+	}
+	s.audit.Record(user, meta, AuditPetMediaDelete, AuditTargetPetMedia, media.ID, media, nil)
+
+	for _, key := range media.Keys() {
+		s.deletePhoto(key)
+	}
+	return nil
+}
+
+// ProcessMedia makes the web and thumbnail sizes of every photo waiting for
+// them. A photo that cannot be processed is marked as failed.
+func (s *PetService) ProcessMedia() error {
+	for {
+		pending, err := s.media.ListPending(20)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		for i := range pending {
+			if err := s.processPhoto(&pending[i]); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RunMediaProcessing processes uploaded photos as they arrive, and every
+// interval those left over, for as long as the process lives.
+func (s *PetService) RunMediaProcessing(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.ProcessMedia(); err != nil {
+			log.Printf("pets: process media: %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.mediaQueued:
+		}
+	}
+}
+
+// processPhoto stores the sizes of one photo. It only returns the errors
+// that leave the photo's status unchanged.
+func (s *PetService) processPhoto(media *models.PetMedia) error {
+	base := strings.TrimSuffix(media.Key, filepath.Ext(media.Key))
+	webKey, thumbnailKey := base+"-web.jpg", base+"-thumb.jpg"
+
+	if err := s.resizePhoto(media.Key, map[string]int{
+		webKey:       mediaWebSize,
+		thumbnailKey: mediaThumbnailSize,
+	}); err != nil {
+		log.Printf("pets: process media %d: %v", media.ID, err)
+		media.Status = models.PetMediaFailed
+	} else {
+		webURL, thumbnailURL := s.photoURL(webKey), s.photoURL(thumbnailKey)
+		media.Status = models.PetMediaReady
+		media.WebKey, media.WebURL = &webKey, &webURL
+		media.ThumbnailKey, media.ThumbnailURL = &thumbnailKey, &thumbnailURL
+	}
+
+	ok, err := s.media.FinishProcessing(media)
+	if err != nil || !ok {
+		// The photo is gone, or was handled elsewhere: drop the files made.
+		s.deletePhoto(webKey)
+		s.deletePhoto(thumbnailKey)
+	}
+	return err
+}
+
+// resizePhoto stores the photo at key scaled to each of sizes, by key.
+func (s *PetService) resizePhoto(key string, sizes map[string]int) error {
+	object, err := s.store.Get(key)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(object.Body)
+	object.Body.Close()
+	if err != nil {
+		return err
+	}
+	img, err := images.Decode(data)
+	if err != nil {
+		return err
+	}
+
+	for sizeKey, size := range sizes {
+		encoded, err := images.EncodeJPEG(images.Fit(img, size))
+		if err != nil {
+			return err
+		}
+		if err := s.store.Put(sizeKey, encoded, images.JPEG); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// managedMedia returns a media of a pet of the user's shelter.
+func (s *PetService) managedMedia(user *models.User, petID, mediaID uint) (*models.PetMedia, error) {
+	pet, err := s.managedPet(user, petID)
+	if err != nil {
+		return nil, err
+	}
+	media, err := s.media.Find(pet.ID, mediaID)
+	if err != nil {
+		return nil, err
+	}
+	if media == nil {
+		return nil, ErrPetMediaNotFound
+	}
+	return media, nil
+}
+
+func mediaIDs(media []models.PetMedia) []uint {
+	ids := make([]uint, len(media))
+	for i, item := range media {
+		ids[i] = item.ID
+	}
+	return ids
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"petmatch/internal/images"
+	"petmatch/internal/models"
+	"petmatch/internal/storage"
+)
+
+// photoURLTTL is how long the links to photos kept in a bucket stay valid.
+const photoURLTTL = 15 * time.Minute
+
+var ErrPhotoNotFound = errors.New("photo not found")
+
+// PhotoTooLargeError reports an upload above the configured size limit.
+type PhotoTooLargeError struct {
+	Limit int
+}
+
+func (e *PhotoTooLargeError) Error() string {
+	return fmt.Sprintf("photo must be at most %d bytes", e.Limit)
+}
+
+// PhotoLimit is the largest upload, in bytes, SetPhoto accepts.
+func (s *PetService) PhotoLimit() int {
+	return s.maxPhotoSize
+}
+
+// SetPhoto stores the uploaded picture as the pet's photo, replacing the
+// previous one. The picture is checked and stripped of its metadata first.
+func (s *PetService) SetPhoto(user *models.User, petID uint, data []byte, meta RequestMeta) (*models.Pet, error) {
+	if len(data) > s.maxPhotoSize {
+		return nil, &PhotoTooLargeError{Limit: s.maxPhotoSize}
+	}
+	pet, err := s.managedPet(user, petID)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := images.Prepare(data)
+	if err != nil {
+		return nil, err
+	}
+	token, err := newOpaqueToken(16)
+	if err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("pet-%d-%s%s", pet.ID, token, img.Extension)
+	if err := s.store.Put(key, img.Data, img.ContentType); err != nil {
+		return nil, err
+	}
+
+	before := *pet
+	url := s.photoURL(key)
+	pet.PhotoKey = &key
+	pet.PhotoURL = &url
+	if err := s.pets.Update(pet); err != nil {
+		s.deletePhoto(key)
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditPetUpdate, AuditTargetPet, pet.ID, &before, pet)
+
+	if before.PhotoKey != nil {
+		s.deletePhoto(*before.PhotoKey)
+	}
+	return pet, nil
+}
+
+// RemovePhoto clears the pet's photo, deleting the file if it was uploaded.
+func (s *PetService) RemovePhoto(user *models.User, petID uint, meta RequestMeta) (*models.Pet, error) {
+	pet, err := s.managedPet(user, petID)
+	if err != nil {
+		return nil, err
+	}
+	if pet.PhotoURL == nil && pet.PhotoKey == nil {
+		return nil, ErrPhotoNotFound
+	}
+
+	before := *pet
+	pet.PhotoKey = nil
+	pet.PhotoURL = nil
+	if err := s.pets.Update(pet); err != nil {
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditPetUpdate, AuditTargetPet, pet.ID, &before, pet)
+
+	if before.PhotoKey != nil {
+		s.deletePhoto(*before.PhotoKey)
+	}
+	return pet, nil
+}
+
+// OpenPhoto returns a stored photo by its key, or, when the store can sign
+// links, a temporary URL to fetch it from instead.
+func (s *PetService) OpenPhoto(key string) (*storage.Object, string, error) {
+	if signer, ok := s.store.(storage.Signer); ok {
+		url, err := signer.SignedURL(key, photoURLTTL)
+		if err != nil {
+			return nil, "", err
+		}
+		return nil, url, nil
+	}
+
+	object, err := s.store.Get(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, "", ErrPhotoNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return object, "", nil
+}
+
+// managedPet returns the pet if it belongs to the user's shelter.
+func (s *PetService) managedPet(user *models.User, petID uint) (*models.Pet, error) {
+	member, err := s.shelterMember(user)
+	if err != nil {
+		return nil, err
+	}
+
+	pet, err := s.pets.FindByID(petID)
+	if err != nil {
+		return nil, err
+	}
+	if pet == nil {
+		return nil, ErrPetNotFound
+	}
+	if pet.ShelterID != member.ShelterID {
+		return nil, ErrUnauthorizedPetAccess
+	}
+	return pet, nil
+}
+
+func (s *PetService) photoURL(key string) string {
+	return s.publicURL + "/api/v1/photos/" + key
+}
+
+// deletePhoto removes a file that is no longer referenced. Failures only
+// leave an orphan behind, so they are logged rather than returned.
+func (s *PetService) deletePhoto(key string) {
+	if err := s.store.Delete(key); err != nil {
+		log.Printf("pets: delete photo %s: %v", key, err)
+	}
+}
@@ -2,19 +2,37 @@ package services
 
 import (
 	"errors"
+	"log"
+	"math"
+	"strings"
 
+	"petmatch/internal/authz"
+	"petmatch/internal/config"
 	"petmatch/internal/models"
 	"petmatch/internal/repositories"
+	"petmatch/internal/storage"
 )
 
 var (
 	ErrUnauthorizedPetAccess = errors.New("pet does not belong to shelter")
 	ErrPetNotFound           = errors.New("pet not found")
 	ErrShelterRoleRequired   = errors.New("only shelters can manage pets")
+	ErrDistanceOrigin        = errors.New("sorting by distance needs lat and lng")
+	ErrInvalidCoordinates    = errors.New("latitude must be between -90 and 90 and longitude between -180 and 180")
 )
 
 type PetService struct {
-	pets *repositories.PetRepository
+	pets         *repositories.PetRepository
+	media        *repositories.PetMediaRepository
+	shelters     *repositories.ShelterRepository
+	authz        *authz.Authorizer
+	audit        *Auditor
+	store        storage.Store
+	publicURL    string
+	maxPhotoSize int
+	maxVideoSize int
+	// mediaQueued wakes RunMediaProcessing when photos are uploaded.
+	mediaQueued chan struct{}
 }
 
 type PetFilterInput struct {
@@ -25,6 +43,10 @@ type PetFilterInput struct {
 	ShelterID *uint
 	MinAge    *uint
 	MaxAge    *uint
+	// Near is where distances are measured from, needed to sort by them.
+	Near *repositories.Point
+	// Query searches the name, breed, description and location.
+	Query string
 }
 
 type CreatePetInput struct {
@@ -35,6 +57,8 @@ type CreatePetInput struct {
 	Description string
 	Location    string
 	PhotoURL    *string
+	Latitude    *float64
+	Longitude   *float64
 }
 
 type UpdatePetInput struct {
@@ -46,14 +70,44 @@ type UpdatePetInput struct {
 	Location    string
 	PhotoURL    *string
 	Status      models.PetStatus
+	Latitude    *float64
+	Longitude   *float64
 }
 
-func NewPetService(repo *repositories.PetRepository) *PetService {
-	return &PetService{pets: repo}
+func NewPetService(
+	repo *repositories.PetRepository,
+	media *repositories.PetMediaRepository,
+	shelters *repositories.ShelterRepository,
+	authorizer *authz.Authorizer,
+	auditor *Auditor,
+	store storage.Store,
+	cfg config.Config,
+) *PetService {
+	return &PetService{
+		pets:         repo,
+		media:        media,
+		shelters:     shelters,
+		authz:        authorizer,
+		audit:        auditor,
+		store:        store,
+		publicURL:    strings.TrimRight(cfg.PublicURL, "/"),
+		maxPhotoSize: cfg.MaxPhotoSize,
+		maxVideoSize: cfg.MaxVideoSize,
+		mediaQueued:  make(chan struct{}, 1),
+	}
 }
 
-func (s *PetService) List(filter PetFilterInput) ([]models.Pet, error) {
-	return s.pets.List(repositories.PetFilter{
+// List returns a page of the catalog. With filter.Near, every pet with a
+// location carries its distance from there.
+func (s *PetService) List(filter PetFilterInput, page repositories.PageRequest) ([]models.Pet, repositories.PageInfo, error) {
+	if page.Sort == "distance" && filter.Near == nil {
+		return nil, repositories.PageInfo{}, ErrDistanceOrigin
+	}
+	if filter.Near != nil && !validCoordinates(&filter.Near.Latitude, &filter.Near.Longitude) {
+		return nil, repositories.PageInfo{}, ErrInvalidCoordinates
+	}
+
+	pets, info, err := s.pets.List(repositories.PetFilter{
 		Species:   filter.Species,
 		Breed:     filter.Breed,
 		Location:  filter.Location,
@@ -61,11 +115,26 @@ func (s *PetService) List(filter PetFilterInput) ([]models.Pet, error) {
 		ShelterID: filter.ShelterID,
 		MinAge:    filter.MinAge,
 		MaxAge:    filter.MaxAge,
-	})
+		Near:      filter.Near,
+		Query:     filter.Query,
+	}, page)
+	if err != nil {
+		return nil, repositories.PageInfo{}, err
+	}
+
+	if filter.Near != nil {
+		for i := range pets {
+			if pets[i].Latitude != nil && pets[i].Longitude != nil {
+				distance := distanceKm(*filter.Near, *pets[i].Latitude, *pets[i].Longitude)
+				pets[i].Distance = &distance
+			}
+		}
+	}
+	return pets, info, nil
 }
 
 func (s *PetService) GetByID(id uint) (*models.Pet, error) {
-	pet, err := s.pets.FindByID(id)
+	pet, err := s.pets.FindWithMedia(id)
 	if err != nil {
 		return nil, err
 	}
@@ -75,13 +144,17 @@ func (s *PetService) GetByID(id uint) (*models.Pet, error) {
 	return pet, nil
 }
 
-func (s *PetService) Create(owner *models.User, input CreatePetInput) (*models.Pet, error) {
-	if owner.Role != models.RoleShelter {
-		return nil, ErrShelterRoleRequired
+func (s *PetService) Create(owner *models.User, input CreatePetInput, meta RequestMeta) (*models.Pet, error) {
+	member, err := s.shelterMember(owner)
+	if err != nil {
+		return nil, err
+	}
+	if !validCoordinates(input.Latitude, input.Longitude) {
+		return nil, ErrInvalidCoordinates
 	}
 
 	pet := &models.Pet{
-		ShelterID:   owner.ID,
+		ShelterID:   member.ShelterID,
 		Name:        input.Name,
 		Species:     input.Species,
 		Breed:       input.Breed,
@@ -90,18 +163,22 @@ func (s *PetService) Create(owner *models.User, input CreatePetInput) (*models.P
 		Location:    input.Location,
 		PhotoURL:    input.PhotoURL,
 		Status:      models.PetStatusAvailable,
+		Latitude:    input.Latitude,
+		Longitude:   input.Longitude,
 	}
 
 	if err := s.pets.Create(pet); err != nil {
 		return nil, err
 	}
+	s.audit.Record(owner, meta, AuditPetCreate, AuditTargetPet, pet.ID, nil, pet)
 
 	return pet, nil
 }
 
-func (s *PetService) Update(owner *models.User, id uint, input UpdatePetInput) (*models.Pet, error) {
-	if owner.Role != models.RoleShelter {
-		return nil, ErrShelterRoleRequired
+func (s *PetService) Update(owner *models.User, id uint, input UpdatePetInput, meta RequestMeta) (*models.Pet, error) {
+	member, err := s.shelterMember(owner)
+	if err != nil {
+		return nil, err
 	}
 
 	pet, err := s.pets.FindByID(id)
@@ -112,10 +189,14 @@ func (s *PetService) Update(owner *models.User, id uint, input UpdatePetInput) (
 		return nil, ErrPetNotFound
 	}
 
-	if pet.ShelterID != owner.ID {
+	if pet.ShelterID != member.ShelterID {
 		return nil, ErrUnauthorizedPetAccess
 	}
+	if !validCoordinates(input.Latitude, input.Longitude) {
+		return nil, ErrInvalidCoordinates
+	}
 
+	before := *pet
 	pet.Name = input.Name
 	pet.Species = input.Species
 	pet.Breed = input.Breed
@@ -124,17 +205,28 @@ func (s *PetService) Update(owner *models.User, id uint, input UpdatePetInput) (
 	pet.Location = input.Location
 	pet.PhotoURL = input.PhotoURL
 	pet.Status = input.Status
+	pet.Latitude = input.Latitude
+	pet.Longitude = input.Longitude
+	// Pointing the pet elsewhere lets go of its uploaded photo.
+	if pet.PhotoKey != nil && (pet.PhotoURL == nil || *pet.PhotoURL != s.photoURL(*pet.PhotoKey)) {
+		pet.PhotoKey = nil
+	}
 
 	if err := s.pets.Update(pet); err != nil {
 		return nil, err
 	}
+	s.audit.Record(owner, meta, AuditPetUpdate, AuditTargetPet, pet.ID, &before, pet)
 
+	if before.PhotoKey != nil && pet.PhotoKey == nil {
+		s.deletePhoto(*before.PhotoKey)
+	}
 	return pet, nil
 }
 
-func (s *PetService) Delete(owner *models.User, id uint) error {
-	if owner.Role != models.RoleShelter {
-		return ErrShelterRoleRequired
+func (s *PetService) Delete(owner *models.User, id uint, meta RequestMeta) error {
+	member, err := s.shelterMember(owner)
+	if err != nil {
+		return err
 	}
 
 	pet, err := s.pets.FindByID(id)
@@ -145,9 +237,61 @@ func (s *PetService) Delete(owner *models.User, id uint) error {
 		return ErrPetNotFound
 	}
 
-	if pet.ShelterID != owner.ID {
+	if pet.ShelterID != member.ShelterID {
 		return ErrUnauthorizedPetAccess
 	}
 
-	return s.pets.Delete(id)
+	if err := s.pets.Delete(id); err != nil {
+		return err
+	}
+	s.audit.Record(owner, meta, AuditPetDelete, AuditTargetPet, pet.ID, pet, nil)
+
+	if pet.PhotoKey != nil {
+		s.deletePhoto(*pet.PhotoKey)
+	}
+	media, err := s.media.DeleteByPet(pet.ID)
+	if err != nil {
+		log.Printf("pets: delete gallery of pet %d: %v", pet.ID, err)
+	}
+	for _, item := range media {
+		for _, key := range item.Keys() {
+			s.deletePhoto(key)
+		}
+	}
+	return nil
+}
+
+// shelterMember returns the membership through which the user manages pets.
+func (s *PetService) shelterMember(user *models.User) (*models.ShelterMember, error) {
+	if !s.authz.Can(user, authz.PetsWrite) {
+		return nil, ErrShelterRoleRequired
+	}
+
+	member, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrNotShelterMember
+	}
+	return member, nil
+}
+
+// validCoordinates reports whether a location is either missing altogether
+// or a real place.
+func validCoordinates(latitude, longitude *float64) bool {
+	if latitude == nil || longitude == nil {
+		return latitude == nil && longitude == nil
+	}
+	return *latitude >= -90 && *latitude <= 90 && *longitude >= -180 && *longitude <= 180
+}
+
+// distanceKm is the great-circle distance from origin to a place.
+func distanceKm(origin repositories.Point, latitude, longitude float64) float64 {
+	const earthRadiusKm = 6371.0
+	lat1, lat2 := origin.Latitude*math.Pi/180, latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLng := (longitude - origin.Longitude) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
 }
@@ -0,0 +1,467 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"petmatch/internal/config"
+	"petmatch/internal/mail"
+	"petmatch/internal/models"
+	"petmatch/internal/repositories"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrShelterNotFound         = errors.New("shelter not found")
+	ErrNotShelterMember        = errors.New("user does not belong to a shelter")
+	ErrShelterRoleForbidden    = errors.New("shelter role does not allow this action")
+	ErrInvalidShelterRole      = errors.New("shelter role must be owner, manager or staff")
+	ErrShelterMemberNotFound   = errors.New("shelter member not found")
+	ErrLastShelterOwner        = errors.New("a shelter needs at least one owner")
+	ErrAlreadyShelterMember    = errors.New("user already belongs to a shelter")
+	ErrInvalidInvitation       = errors.New("invalid or expired invitation")
+	ErrInvitationNotFound      = errors.New("invitation not found")
+	ErrInvitationEmailMismatch = errors.New("invitation was sent to a different email")
+	ErrInvitationNeedsLogin    = errors.New("an account already exists for this email, sign in to accept the invitation")
+)
+
+// shelterRoleRank orders member roles from least to most privileged.
+var shelterRoleRank = map[models.ShelterRole]int{
+	models.ShelterRoleStaff:   1,
+	models.ShelterRoleManager: 2,
+	models.ShelterRoleOwner:   3,
+}
+
+// ShelterService manages shelter organizations and their staff. Every member
+// can manage the shelter's pets and read its adoption requests; managers
+// also decide requests and handle staff, while owners manage every member.
+type ShelterService struct {
+	shelters      *repositories.ShelterRepository
+	users         *repositories.UserRepository
+	mailer        mail.Mailer
+	audit         *Auditor
+	appURL        string
+	invitationTTL time.Duration
+}
+
+type UpdateShelterInput struct {
+	Name  *string
+	Phone *string
+	City  *string
+}
+
+type InviteMemberInput struct {
+	Email string
+	Role  models.ShelterRole
+}
+
+type RegisterMemberInput struct {
+	Token    string
+	Name     string
+	Password string
+	Phone    *string
+	City     *string
+}
+
+// ShelterDetails is a shelter together with its staff, as seen by a member.
+type ShelterDetails struct {
+	Shelter     models.Shelter
+	Role        models.ShelterRole
+	Members     []models.ShelterMember
+	Invitations []models.ShelterInvitation
+}
+
+func NewShelterService(
+	shelters *repositories.ShelterRepository,
+	users *repositories.UserRepository,
+	mailer mail.Mailer,
+	auditor *Auditor,
+	cfg config.Config,
+) *ShelterService {
+	return &ShelterService{
+		shelters:      shelters,
+		users:         users,
+		mailer:        mailer,
+		audit:         auditor,
+		appURL:        strings.TrimRight(cfg.AppURL, "/"),
+		invitationTTL: cfg.ShelterInvitationTTL,
+	}
+}
+
+func ParseShelterRole(role string) (models.ShelterRole, error) {
+	parsed := models.ShelterRole(strings.ToLower(strings.TrimSpace(role)))
+	if _, ok := shelterRoleRank[parsed]; !ok {
+		return "", ErrInvalidShelterRole
+	}
+	return parsed, nil
+}
+
+// Mine returns the shelter of the user. Pending invitations are only listed
+// to members who can invite.
+func (s *ShelterService) Mine(user *models.User) (*ShelterDetails, error) {
+	member, err := s.membership(user)
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := s.shelters.ListMembers(member.ShelterID)
+	if err != nil {
+		return nil, err
+	}
+
+	details := &ShelterDetails{
+		Shelter: member.Shelter,
+		Role:    member.Role,
+		Members: members,
+	}
+
+	if atLeast(member, models.ShelterRoleManager) {
+		details.Invitations, err = s.shelters.ListPendingInvitations(member.ShelterID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return details, nil
+}
+
+func (s *ShelterService) Update(user *models.User, input UpdateShelterInput, meta RequestMeta) (*models.Shelter, error) {
+	member, err := s.membership(user)
+	if err != nil {
+		return nil, err
+	}
+	if !atLeast(member, models.ShelterRoleManager) {
+		return nil, ErrShelterRoleForbidden
+	}
+
+	shelter := member.Shelter
+	if input.Name != nil {
+		shelter.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Phone != nil {
+		shelter.Phone = optionalString(*input.Phone)
+	}
+	if input.City != nil {
+		shelter.City = optionalString(*input.City)
+	}
+
+	if err := s.shelters.Update(&shelter); err != nil {
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditShelterUpdate, AuditTargetShelter, shelter.ID, &member.Shelter, &shelter)
+	return &shelter, nil
+}
+
+// Invite mails an invitation to join the user's shelter. Owners can invite
+// any role, managers only staff.
+func (s *ShelterService) Invite(user *models.User, input InviteMemberInput, meta RequestMeta) (*models.ShelterInvitation, error) {
+	member, err := s.membership(user)
+	if err != nil {
+		return nil, err
+	}
+	if !canAssign(member, input.Role) {
+		return nil, ErrShelterRoleForbidden
+	}
+	if !member.Shelter.IsApproved {
+		return nil, ErrShelterNotApproved
+	}
+
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	existing, err := s.users.FindByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		current, err := s.shelters.FindMembership(existing.ID)
+		if err != nil {
+			return nil, err
+		}
+		if current != nil {
+			return nil, ErrAlreadyShelterMember
+		}
+	}
+
+	raw, err := newOpaqueToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	invitation := &models.ShelterInvitation{
+		ShelterID:   member.ShelterID,
+		Email:       email,
+		Role:        input.Role,
+		TokenHash:   hashToken(raw),
+		InvitedByID: user.ID,
+		ExpiresAt:   time.Now().Add(s.invitationTTL),
+	}
+	if err := s.shelters.CreateInvitation(invitation); err != nil {
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditShelterInvite, AuditTargetInvitation, invitation.ID, nil, invitation)
+
+	link := fmt.Sprintf("%s/shelter-invitation?token=%s", s.appURL, url.QueryEscape(raw))
+	if err := s.mailer.Send(mail.Message{
+		To:      email,
+		Subject: fmt.Sprintf("Te invitaron a %s en PetMatch", member.Shelter.Name),
+		Body: fmt.Sprintf(
+			"Hola,\n\n%s te invitó a unirte a %s en PetMatch como %s. Acepta la invitación con este enlace:\n\n%s\n\nLa invitación vence en %d días.",
+			user.Name, member.Shelter.Name, input.Role, link, int(s.invitationTTL.Hours()/24),
+		),
+	}); err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (s *ShelterService) RevokeInvitation(user *models.User, invitationID uint, meta RequestMeta) error {
+	member, err := s.membership(user)
+	if err != nil {
+		return err
+	}
+	if !atLeast(member, models.ShelterRoleManager) {
+		return ErrShelterRoleForbidden
+	}
+
+	deleted, err := s.shelters.DeleteInvitation(member.ShelterID, invitationID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrInvitationNotFound
+	}
+	s.audit.Record(user, meta, AuditShelterInvitationRevoke, AuditTargetInvitation, invitationID, nil, nil)
+	return nil
+}
+
+// AcceptInvitation adds a signed-in user to the shelter that invited their
+// email address. Adopters become shelter accounts; other roles are kept.
+func (s *ShelterService) AcceptInvitation(user *models.User, rawToken string, meta RequestMeta) (*models.ShelterMember, error) {
+	invitation, err := s.pendingInvitation(rawToken)
+	if err != nil {
+		return nil, err
+	}
+	if invitation.Email != user.Email {
+		return nil, ErrInvitationEmailMismatch
+	}
+
+	current, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, ErrAlreadyShelterMember
+	}
+
+	if user.Role == models.RoleAdopter {
+		user.Role = models.RoleShelter
+	}
+	user.IsApproved = true
+	// The invitation reached this address, which proves the user owns it.
+	if !user.EmailVerified {
+		now := time.Now()
+		user.EmailVerified = true
+		user.EmailVerifiedAt = &now
+	}
+
+	return s.accept(invitation, user, meta)
+}
+
+// RegisterMember creates the account of an invitee who has none yet and adds
+// it to the shelter.
+func (s *ShelterService) RegisterMember(input RegisterMemberInput, meta RequestMeta) (*models.User, error) {
+	invitation, err := s.pendingInvitation(input.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.users.FindByEmail(invitation.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrInvitationNeedsLogin
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	user := &models.User{
+		Name:            strings.TrimSpace(input.Name),
+		Email:           invitation.Email,
+		PasswordHash:    string(hash),
+		Role:            models.RoleShelter,
+		Phone:           input.Phone,
+		City:            input.City,
+		IsApproved:      true,
+		Status:          models.UserStatusActive,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	}
+
+	if _, err := s.accept(invitation, user, meta); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ChangeMemberRole is reserved to owners. The last owner cannot step down.
+func (s *ShelterService) ChangeMemberRole(user *models.User, memberUserID uint, role models.ShelterRole, meta RequestMeta) (*models.ShelterMember, error) {
+	member, err := s.membership(user)
+	if err != nil {
+		return nil, err
+	}
+	if member.Role != models.ShelterRoleOwner {
+		return nil, ErrShelterRoleForbidden
+	}
+
+	target, err := s.shelters.FindMember(member.ShelterID, memberUserID)
+	if err != nil {
+		return nil, err
+	}
+	if target == nil {
+		return nil, ErrShelterMemberNotFound
+	}
+
+	if target.Role == models.ShelterRoleOwner && role != models.ShelterRoleOwner {
+		if err := s.ensureAnotherOwner(member.ShelterID); err != nil {
+			return nil, err
+		}
+	}
+
+	before := *target
+	target.Role = role
+	if err := s.shelters.UpdateMemberRole(target); err != nil {
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditShelterMemberRole, AuditTargetUser, target.UserID, &before, target)
+	return target, nil
+}
+
+// RemoveMember takes a user out of the shelter. Members may always leave
+// themselves; removing someone else needs a higher role than theirs, except
+// for owners, who can remove each other.
+func (s *ShelterService) RemoveMember(user *models.User, memberUserID uint, meta RequestMeta) error {
+	member, err := s.membership(user)
+	if err != nil {
+		return err
+	}
+
+	target, err := s.shelters.FindMember(member.ShelterID, memberUserID)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		return ErrShelterMemberNotFound
+	}
+
+	if target.UserID != user.ID && !canAssign(member, target.Role) {
+		return ErrShelterRoleForbidden
+	}
+
+	if target.Role == models.ShelterRoleOwner {
+		if err := s.ensureAnotherOwner(member.ShelterID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.shelters.RemoveMember(target); err != nil {
+		return err
+	}
+	s.audit.Record(user, meta, AuditShelterMemberRemove, AuditTargetUser, target.UserID, target, nil)
+	return nil
+}
+
+func (s *ShelterService) List(approved *bool) ([]models.Shelter, error) {
+	return s.shelters.List(approved)
+}
+
+// Approve lets the shelter and its current members sign in.
+func (s *ShelterService) Approve(admin *models.User, shelterID uint, meta RequestMeta) (*models.Shelter, error) {
+	shelter, err := s.shelters.FindByID(shelterID)
+	if err != nil {
+		return nil, err
+	}
+	if shelter == nil {
+		return nil, ErrShelterNotFound
+	}
+
+	if err := s.shelters.Approve(shelter.ID); err != nil {
+		return nil, err
+	}
+	before := *shelter
+	shelter.IsApproved = true
+	s.audit.Record(admin, meta, AuditShelterApprove, AuditTargetShelter, shelter.ID, &before, shelter)
+	return shelter, nil
+}
+
+func (s *ShelterService) membership(user *models.User) (*models.ShelterMember, error) {
+	member, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrNotShelterMember
+	}
+	return member, nil
+}
+
+func (s *ShelterService) pendingInvitation(rawToken string) (*models.ShelterInvitation, error) {
+	invitation, err := s.shelters.FindInvitationByHash(hashToken(rawToken))
+	if err != nil {
+		return nil, err
+	}
+	if invitation == nil || invitation.AcceptedAt != nil || !time.Now().Before(invitation.ExpiresAt) {
+		return nil, ErrInvalidInvitation
+	}
+	return invitation, nil
+}
+
+func (s *ShelterService) accept(invitation *models.ShelterInvitation, user *models.User, meta RequestMeta) (*models.ShelterMember, error) {
+	accepted, err := s.shelters.AcceptInvitation(invitation, user, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !accepted {
+		return nil, ErrInvalidInvitation
+	}
+
+	member := &models.ShelterMember{
+		ShelterID: invitation.ShelterID,
+		Shelter:   invitation.Shelter,
+		UserID:    user.ID,
+		Role:      invitation.Role,
+	}
+	s.audit.Record(user, meta, AuditShelterJoin, AuditTargetShelter, invitation.ShelterID, nil, member)
+	return member, nil
+}
+
+func (s *ShelterService) ensureAnotherOwner(shelterID uint) error {
+	owners, err := s.shelters.CountOwners(shelterID)
+	if err != nil {
+		return err
+	}
+	if owners <= 1 {
+		return ErrLastShelterOwner
+	}
+	return nil
+}
+
+func atLeast(member *models.ShelterMember, role models.ShelterRole) bool {
+	return member != nil && shelterRoleRank[member.Role] >= shelterRoleRank[role]
+}
+
+// canAssign reports whether member may invite, or remove, someone with role.
+func canAssign(member *models.ShelterMember, role models.ShelterRole) bool {
+	if member.Role == models.ShelterRoleOwner {
+		return true
+	}
+	return member.Role == models.ShelterRoleManager && role == models.ShelterRoleStaff
+}
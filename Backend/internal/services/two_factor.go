@@ -0,0 +1,341 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"petmatch/internal/models"
+	"petmatch/internal/totp"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidChallenge        = errors.New("invalid or expired two-factor challenge")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication not enabled")
+	ErrTwoFactorSetupMissing   = errors.New("two-factor setup has not been started")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is required for this role")
+)
+
+const (
+	challengeTokenTTL  = 5 * time.Minute
+	recoveryCodeCount  = 10
+	totpAllowedSkew    = 1
+	challengeTypeLogin = "2fa_login"
+	challengeTypeSetup = "2fa_enroll"
+)
+
+// TwoFactorChallenge is returned by Login instead of a session when the
+// password was correct but a second factor is still needed. Enrollment is
+// set when the role requires 2FA and the user has not configured it yet.
+type TwoFactorChallenge struct {
+	Token      string
+	Enrollment bool
+	ExpiresIn  time.Duration
+}
+
+type TwoFactorSetup struct {
+	Secret string
+	URI    string
+}
+
+type TwoFactorEnrollment struct {
+	Session       *LoginOutput
+	RecoveryCodes []string
+}
+
+// CompleteTwoFactorLogin exchanges a login challenge and a TOTP or recovery
+// code for a session.
+func (s *AuthService) CompleteTwoFactorLogin(challengeToken, code, clientIP string) (*LoginOutput, error) {
+	user, err := s.parseChallenge(challengeToken, challengeTypeLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.reserveAttempt(user.Email, clientIP); err != nil {
+		return nil, err
+	}
+
+	if err := s.verifySecondFactor(user, code); err != nil {
+		if err == ErrInvalidTwoFactorCode {
+			return nil, err
+		}
+		return nil, s.releaseAttempt(user.Email, clientIP, err)
+	}
+
+	if err := s.guard.Release(user.Email, clientIP); err != nil {
+		return nil, err
+	}
+	if err := s.guard.Succeed(user.Email); err != nil {
+		return nil, err
+	}
+
+	return s.startSession(user)
+}
+
+// BeginTwoFactorEnrollment starts setup for a user who was stopped at login
+// because their role requires 2FA.
+func (s *AuthService) BeginTwoFactorEnrollment(challengeToken string) (*TwoFactorSetup, error) {
+	user, err := s.parseChallenge(challengeToken, challengeTypeSetup)
+	if err != nil {
+		return nil, err
+	}
+	return s.BeginTwoFactorSetup(user)
+}
+
+// ConfirmTwoFactorEnrollment finishes an enrollment challenge and signs the
+// user in.
+func (s *AuthService) ConfirmTwoFactorEnrollment(challengeToken, code string) (*TwoFactorEnrollment, error) {
+	user, err := s.parseChallenge(challengeToken, challengeTypeSetup)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := s.ConfirmTwoFactorSetup(user, code)
+	if err != nil {
+		return nil, err
+	}
+	user.TwoFactorEnabled = true
+
+	session, err := s.startSession(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{Session: session, RecoveryCodes: codes}, nil
+}
+
+// BeginTwoFactorSetup generates a new, unconfirmed TOTP secret for the user.
+// Calling it again before confirming replaces the previous secret.
+func (s *AuthService) BeginTwoFactorSetup(user *models.User) (*TwoFactorSetup, error) {
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.twoFactors.Save(&models.TwoFactor{UserID: user.ID, Secret: secret}); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorSetup{
+		Secret: secret,
+		URI:    totp.URI(s.totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactorSetup enables 2FA once the user proves their authenticator
+// produces valid codes. The returned recovery codes are never shown again.
+func (s *AuthService) ConfirmTwoFactorSetup(user *models.User, code string) ([]string, error) {
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	twoFactor, err := s.twoFactors.FindByUser(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor == nil {
+		return nil, ErrTwoFactorSetupMissing
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, code, time.Now(), totpAllowedSkew)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	twoFactor.ConfirmedAt = &now
+	twoFactor.LastUsedStep = step
+	if err := s.twoFactors.Enable(twoFactor, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor turns 2FA off after checking a current code. Users whose
+// role requires 2FA cannot disable it.
+func (s *AuthService) DisableTwoFactor(user *models.User, code string, meta RequestMeta) error {
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if s.twoFactorRequired(user.Role) {
+		return ErrTwoFactorRequired
+	}
+
+	if err := s.verifySecondFactor(user, code); err != nil {
+		return err
+	}
+
+	before := *user
+	if err := s.twoFactors.Disable(user.ID); err != nil {
+		return err
+	}
+	user.TwoFactorEnabled = false
+
+	s.audit.Record(user, meta, AuditUserTwoFactorDisable, AuditTargetUser, user.ID, &before, user)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces every recovery code of the user.
+func (s *AuthService) RegenerateRecoveryCodes(user *models.User, code string, meta RequestMeta) ([]string, error) {
+	if !user.TwoFactorEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	if err := s.verifySecondFactor(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.twoFactors.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		return nil, err
+	}
+
+	s.audit.Record(user, meta, AuditUserRecoveryCodesReset, AuditTargetUser, user.ID, nil, nil)
+	return codes, nil
+}
+
+func (s *AuthService) twoFactorRequired(role models.UserRole) bool {
+	return s.twoFactorRoles[role]
+}
+
+// twoFactorChallenge returns the challenge Login must answer with for the
+// user, or nil when the password alone is enough.
+func (s *AuthService) twoFactorChallenge(user *models.User) (*TwoFactorChallenge, error) {
+	var challengeType string
+	switch {
+	case user.TwoFactorEnabled:
+		challengeType = challengeTypeLogin
+	case s.twoFactorRequired(user.Role):
+		challengeType = challengeTypeSetup
+	default:
+		return nil, nil
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub": fmt.Sprint(user.ID),
+		"typ": challengeType,
+		"iss": s.issuer,
+		"iat": now.Unix(),
+		"exp": now.Add(challengeTokenTTL).Unix(),
+	}
+
+	token, err := s.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorChallenge{
+		Token:      token,
+		Enrollment: challengeType == challengeTypeSetup,
+		ExpiresIn:  challengeTokenTTL,
+	}, nil
+}
+
+func (s *AuthService) parseChallenge(rawToken, challengeType string) (*models.User, error) {
+	token, err := s.parseJWT(rawToken)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != challengeType {
+		return nil, ErrInvalidChallenge
+	}
+
+	sub, ok := claims["sub"].(string)
+	if !ok {
+		return nil, ErrInvalidChallenge
+	}
+
+	id, err := strconv.Atoi(sub)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+
+	user, err := s.users.FindByID(uint(id))
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidChallenge
+	}
+	if err := checkAccountStatus(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code.
+func (s *AuthService) verifySecondFactor(user *models.User, code string) error {
+	twoFactor, err := s.twoFactors.FindByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	if twoFactor == nil || twoFactor.ConfirmedAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	if step, ok := totp.Validate(twoFactor.Secret, code, time.Now(), totpAllowedSkew); ok {
+		fresh, err := s.twoFactors.MarkStepUsed(user.ID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	consumed, err := s.twoFactors.ConsumeRecoveryCode(user.ID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !consumed {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.EncodeToString(buf))
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
@@ -0,0 +1,525 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"petmatch/internal/config"
+	"petmatch/internal/ical"
+	"petmatch/internal/mail"
+	"petmatch/internal/models"
+	"petmatch/internal/repositories"
+)
+
+const (
+	minVisitLength = 15 * time.Minute
+	maxVisitLength = 8 * time.Hour
+	visitTimeFmt   = "02/01/2006 15:04"
+)
+
+var (
+	ErrVisitSlotNotFound  = errors.New("visit slot not found")
+	ErrVisitSlotTime      = errors.New("a visit slot must start in the future and last between 15 minutes and 8 hours")
+	ErrVisitSlotLocation  = errors.New("location must be at most 255 characters")
+	ErrVisitSlotBooked    = errors.New("visit slot is already booked")
+	ErrVisitNotFound      = errors.New("the request has no booked visit")
+	ErrVisitAlreadyBooked = errors.New("the request already has a booked visit; reschedule it instead")
+	ErrVisitRequestClosed = errors.New("visits can only be booked for open requests")
+	ErrVisitStarted       = errors.New("the visit has already started")
+)
+
+// VisitService lets shelters publish the times they can receive adopters and
+// adopters with an open request book one of them. Both sides get the visit
+// by mail as an iCalendar file, and a reminder before it starts.
+type VisitService struct {
+	visits       *repositories.VisitRepository
+	adoptions    *repositories.AdoptionRepository
+	shelters     *repositories.ShelterRepository
+	audit        *Auditor
+	mailer       mail.Mailer
+	appURL       string
+	reminderLead time.Duration
+}
+
+type VisitSlotInput struct {
+	StartsAt time.Time
+	EndsAt   time.Time
+	Location string
+}
+
+// ShelterVisitSlot is a slot as the shelter sees it, with the booking
+// holding it, if any.
+type ShelterVisitSlot struct {
+	Slot    models.VisitSlot
+	Booking *models.VisitBooking
+}
+
+func NewVisitService(
+	visits *repositories.VisitRepository,
+	adoptions *repositories.AdoptionRepository,
+	shelters *repositories.ShelterRepository,
+	auditor *Auditor,
+	mailer mail.Mailer,
+	cfg config.Config,
+) *VisitService {
+	return &VisitService{
+		visits:       visits,
+		adoptions:    adoptions,
+		shelters:     shelters,
+		audit:        auditor,
+		mailer:       mailer,
+		appURL:       strings.TrimRight(cfg.AppURL, "/"),
+		reminderLead: cfg.VisitReminderLead,
+	}
+}
+
+// ListSlots returns the shelter's slots that have not ended yet.
+func (s *VisitService) ListSlots(user *models.User) ([]ShelterVisitSlot, error) {
+	member, err := s.member(user)
+	if err != nil {
+		return nil, err
+	}
+
+	slots, err := s.visits.ListSlots(member.ShelterID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, len(slots))
+	for i, slot := range slots {
+		ids[i] = slot.ID
+	}
+	bookings, err := s.visits.ListBookingsForSlots(ids)
+	if err != nil {
+		return nil, err
+	}
+	bySlot := make(map[uint]*models.VisitBooking, len(bookings))
+	for i := range bookings {
+		bySlot[bookings[i].SlotID] = &bookings[i]
+	}
+
+	result := make([]ShelterVisitSlot, len(slots))
+	for i, slot := range slots {
+		result[i] = ShelterVisitSlot{Slot: slot, Booking: bySlot[slot.ID]}
+	}
+	return result, nil
+}
+
+func (s *VisitService) CreateSlot(user *models.User, input VisitSlotInput, meta RequestMeta) (*models.VisitSlot, error) {
+	member, err := s.member(user)
+	if err != nil {
+		return nil, err
+	}
+
+	length := input.EndsAt.Sub(input.StartsAt)
+	if !input.StartsAt.After(time.Now()) || length < minVisitLength || length > maxVisitLength {
+		return nil, ErrVisitSlotTime
+	}
+	location := strings.TrimSpace(input.Location)
+	if len(location) > 255 {
+		return nil, ErrVisitSlotLocation
+	}
+
+	slot := &models.VisitSlot{
+		ShelterID:   member.ShelterID,
+		StartsAt:    input.StartsAt,
+		EndsAt:      input.EndsAt,
+		Location:    location,
+		CreatedByID: &user.ID,
+	}
+	if err := s.visits.CreateSlot(slot); err != nil {
+		return nil, err
+	}
+	s.audit.Record(user, meta, AuditVisitSlotCreate, AuditTargetVisitSlot, slot.ID, nil, slot)
+
+	return slot, nil
+}
+
+// DeleteSlot removes a slot nobody has booked. Booked slots have to be freed
+// by cancelling the visit first, so the adopter is told.
+func (s *VisitService) DeleteSlot(user *models.User, slotID uint, meta RequestMeta) error {
+	member, err := s.member(user)
+	if err != nil {
+		return err
+	}
+
+	slot, err := s.visits.FindSlot(member.ShelterID, slotID)
+	if err != nil {
+		return err
+	}
+	if slot == nil {
+		return ErrVisitSlotNotFound
+	}
+	deleted, err := s.visits.DeleteSlot(slot.ID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrVisitSlotBooked
+	}
+	s.audit.Record(user, meta, AuditVisitSlotDelete, AuditTargetVisitSlot, slot.ID, slot, nil)
+
+	return nil
+}
+
+// AvailableSlots returns the free upcoming slots of the shelter of the
+// request's pet, for its adopter to pick one.
+func (s *VisitService) AvailableSlots(user *models.User, requestID uint) ([]models.VisitSlot, error) {
+	request, err := s.bookable(user, requestID)
+	if err != nil {
+		return nil, err
+	}
+	return s.visits.ListFreeSlots(request.Pet.ShelterID, time.Now())
+}
+
+// Get returns the request's booked visit to its adopter or the pet's
+// shelter.
+func (s *VisitService) Get(user *models.User, requestID uint) (*models.VisitBooking, error) {
+	request, _, err := s.participant(user, requestID)
+	if err != nil {
+		return nil, err
+	}
+	booking, err := s.visits.FindActiveBooking(request.ID)
+	if err != nil {
+		return nil, err
+	}
+	if booking == nil {
+		return nil, ErrVisitNotFound
+	}
+	return booking, nil
+}
+
+// Book reserves slotID for the request. A request has at most one booked
+// visit, and a slot at most one booking.
+func (s *VisitService) Book(user *models.User, requestID, slotID uint, meta RequestMeta) (*models.VisitBooking, error) {
+	request, err := s.bookable(user, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	slot, err := s.freeSlot(request, slotID)
+	if err != nil {
+		return nil, err
+	}
+
+	booking := &models.VisitBooking{
+		RequestID: request.ID,
+		SlotID:    slot.ID,
+		Status:    models.VisitStatusBooked,
+	}
+	booked, err := s.visits.Book(booking)
+	if errors.Is(err, repositories.ErrActiveBookingExists) {
+		return nil, ErrVisitAlreadyBooked
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !booked {
+		return nil, ErrVisitSlotBooked
+	}
+	booking.Slot = *slot
+	booking.Slot.BookingID = &booking.ID
+	booking.Request = *request
+	s.audit.Record(user, meta, AuditVisitBook, AuditTargetVisit, booking.ID, nil, booking)
+
+	s.announce(booking, ical.MethodPublish,
+		fmt.Sprintf("Visita confirmada para conocer a %s", request.Pet.Name),
+		"La visita para conocer a %s quedó agendada para el %s.")
+
+	return booking, nil
+}
+
+// Reschedule moves the request's booked visit to slotID.
+func (s *VisitService) Reschedule(user *models.User, requestID, slotID uint, meta RequestMeta) (*models.VisitBooking, error) {
+	request, err := s.bookable(user, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	booking, err := s.visits.FindActiveBooking(request.ID)
+	if err != nil {
+		return nil, err
+	}
+	if booking == nil {
+		return nil, ErrVisitNotFound
+	}
+	now := time.Now()
+	if !booking.Slot.StartsAt.After(now) {
+		return nil, ErrVisitStarted
+	}
+
+	slot, err := s.freeSlot(request, slotID)
+	if err != nil {
+		return nil, err
+	}
+
+	moved, err := s.visits.Reschedule(booking, slot.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	if !moved {
+		// Either the slot was taken or the visit changed under us.
+		current, err := s.visits.FindActiveBooking(request.ID)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil || current.ID != booking.ID {
+			return nil, ErrVisitNotFound
+		}
+		return nil, ErrVisitSlotBooked
+	}
+
+	before := *booking
+	booking.SlotID = slot.ID
+	booking.Slot = *slot
+	booking.Slot.BookingID = &booking.ID
+	booking.Sequence++
+	booking.ReminderSentAt = nil
+	booking.UpdatedAt = now
+	booking.Request = *request
+	s.audit.Record(user, meta, AuditVisitReschedule, AuditTargetVisit, booking.ID, &before, booking)
+
+	s.announce(booking, ical.MethodPublish,
+		fmt.Sprintf("Visita reprogramada para conocer a %s", request.Pet.Name),
+		"La visita para conocer a %s se reprogramó para el %s.")
+
+	return booking, nil
+}
+
+// Cancel cancels the request's booked visit and frees its slot. The adopter
+// and the pet's shelter can both cancel.
+func (s *VisitService) Cancel(user *models.User, requestID uint, meta RequestMeta) error {
+	request, _, err := s.participant(user, requestID)
+	if err != nil {
+		return err
+	}
+
+	booking, err := s.visits.FindActiveBooking(request.ID)
+	if err != nil {
+		return err
+	}
+	if booking == nil {
+		return ErrVisitNotFound
+	}
+	now := time.Now()
+	if !booking.Slot.StartsAt.After(now) {
+		return ErrVisitStarted
+	}
+
+	cancelled, err := s.visits.Cancel(booking, now)
+	if err != nil {
+		return err
+	}
+	if !cancelled {
+		return ErrVisitNotFound
+	}
+
+	before := *booking
+	booking.Status = models.VisitStatusCancelled
+	booking.Sequence++
+	booking.CancelledAt = &now
+	booking.UpdatedAt = now
+	booking.Request = *request
+	s.audit.Record(user, meta, AuditVisitCancel, AuditTargetVisit, booking.ID, &before, booking)
+
+	s.announce(booking, ical.MethodCancel,
+		fmt.Sprintf("Visita cancelada para conocer a %s", request.Pet.Name),
+		"La visita para conocer a %s del %s fue cancelada.")
+
+	return nil
+}
+
+// Calendar returns the request's booked visit as an iCalendar file.
+func (s *VisitService) Calendar(user *models.User, requestID uint) ([]byte, error) {
+	request, _, err := s.participant(user, requestID)
+	if err != nil {
+		return nil, err
+	}
+	booking, err := s.visits.FindActiveBooking(request.ID)
+	if err != nil {
+		return nil, err
+	}
+	if booking == nil {
+		return nil, ErrVisitNotFound
+	}
+	booking.Request = *request
+
+	shelter, err := s.shelters.FindByID(booking.Slot.ShelterID)
+	if err != nil {
+		return nil, err
+	}
+	if shelter == nil {
+		return nil, ErrVisitNotFound
+	}
+	return ical.Calendar(ical.MethodPublish, s.event(booking, shelter)), nil
+}
+
+// SendReminders mails the adopter and the shelter about the visits starting
+// within the reminder lead time. Each visit is reminded once, even with
+// several servers running.
+func (s *VisitService) SendReminders(now time.Time) error {
+	bookings, err := s.visits.ListDueReminders(now, now.Add(s.reminderLead))
+	if err != nil {
+		return err
+	}
+
+	for i := range bookings {
+		booking := &bookings[i]
+		claimed, err := s.visits.MarkReminded(booking.ID, now)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			continue
+		}
+		s.announce(booking, ical.MethodPublish,
+			fmt.Sprintf("Recordatorio: visita para conocer a %s", booking.Request.Pet.Name),
+			"Te recordamos la visita para conocer a %s el %s.")
+	}
+	return nil
+}
+
+// RunReminders sends the due reminders every interval, for as long as the
+// process lives.
+func (s *VisitService) RunReminders(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if err := s.SendReminders(now); err != nil {
+			log.Printf("visits: send reminders: %v", err)
+		}
+	}
+}
+
+// announce mails the adopter and every member of the shelter about the
+// visit, with the visit attached as an iCalendar file. line is formatted
+// with the pet's name and the start of the visit.
+func (s *VisitService) announce(booking *models.VisitBooking, method ical.Method, subject, line string) {
+	shelter, err := s.shelters.FindByID(booking.Slot.ShelterID)
+	if err != nil || shelter == nil {
+		log.Printf("visits: announce booking %d: shelter %d: %v", booking.ID, booking.Slot.ShelterID, err)
+		return
+	}
+	members, err := s.shelters.ListMembers(shelter.ID)
+	if err != nil {
+		log.Printf("visits: announce booking %d: %v", booking.ID, err)
+		return
+	}
+
+	request := booking.Request
+	body := fmt.Sprintf(line, request.Pet.Name, booking.Slot.StartsAt.Local().Format(visitTimeFmt))
+	if booking.Slot.Location != "" {
+		body += fmt.Sprintf("\nLugar: %s", booking.Slot.Location)
+	}
+	body += fmt.Sprintf("\nRefugio: %s\nAdoptante: %s\n\nPuedes ver la solicitud en %s/adoption-requests", shelter.Name, request.Adopter.Name, s.appURL)
+
+	attachment := mail.Attachment{
+		Filename:    fmt.Sprintf("visita-%d.ics", booking.ID),
+		ContentType: ical.ContentType + "; method=" + string(method),
+		Data:        ical.Calendar(method, s.event(booking, shelter)),
+	}
+
+	recipients := []models.User{request.Adopter}
+	for _, member := range members {
+		recipients = append(recipients, member.User)
+	}
+	for _, recipient := range recipients {
+		if err := s.mailer.Send(mail.Message{
+			To:          recipient.Email,
+			Subject:     subject,
+			Body:        fmt.Sprintf("Hola %s,\n\n%s", recipient.Name, body),
+			Attachments: []mail.Attachment{attachment},
+		}); err != nil {
+			log.Printf("visits: notify user %d: %v", recipient.ID, err)
+		}
+	}
+}
+
+func (s *VisitService) event(booking *models.VisitBooking, shelter *models.Shelter) ical.Event {
+	location := booking.Slot.Location
+	if location == "" && shelter.City != nil {
+		location = *shelter.City
+	}
+	return ical.Event{
+		UID:         fmt.Sprintf("visit-%d@petmatch", booking.ID),
+		Sequence:    booking.Sequence,
+		Start:       booking.Slot.StartsAt,
+		End:         booking.Slot.EndsAt,
+		Summary:     fmt.Sprintf("Visita a %s en %s", booking.Request.Pet.Name, shelter.Name),
+		Description: fmt.Sprintf("Visita de %s para conocer a %s.\n%s/adoption-requests", booking.Request.Adopter.Name, booking.Request.Pet.Name, s.appURL),
+		Location:    location,
+		Stamp:       booking.UpdatedAt,
+	}
+}
+
+// bookable returns the request if the user is its adopter and it is still
+// open.
+func (s *VisitService) bookable(user *models.User, requestID uint) (*models.AdoptionRequest, error) {
+	request, fromShelter, err := s.participant(user, requestID)
+	if err != nil {
+		return nil, err
+	}
+	if fromShelter {
+		return nil, ErrPermissionDenied
+	}
+	for _, status := range openAdoptionStatuses {
+		if request.Status == status {
+			return request, nil
+		}
+	}
+	return nil, ErrVisitRequestClosed
+}
+
+// freeSlot returns slotID if it belongs to the shelter of the request's pet,
+// is still ahead and nobody has booked it.
+func (s *VisitService) freeSlot(request *models.AdoptionRequest, slotID uint) (*models.VisitSlot, error) {
+	slot, err := s.visits.FindSlot(request.Pet.ShelterID, slotID)
+	if err != nil {
+		return nil, err
+	}
+	if slot == nil || !slot.StartsAt.After(time.Now()) {
+		return nil, ErrVisitSlotNotFound
+	}
+	if slot.BookingID != nil {
+		return nil, ErrVisitSlotBooked
+	}
+	return slot, nil
+}
+
+// participant returns the request if the user is its adopter or a member of
+// its pet's shelter, and whether they are the latter. Other users are told
+// the request does not exist.
+func (s *VisitService) participant(user *models.User, requestID uint) (*models.AdoptionRequest, bool, error) {
+	request, err := s.adoptions.FindByID(requestID)
+	if err != nil {
+		return nil, false, err
+	}
+	if request == nil {
+		return nil, false, ErrRequestNotFound
+	}
+	if request.AdopterID == user.ID {
+		return request, false, nil
+	}
+
+	member, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	if member == nil || member.ShelterID != request.Pet.ShelterID {
+		return nil, false, ErrRequestNotFound
+	}
+	return request, true, nil
+}
+
+func (s *VisitService) member(user *models.User) (*models.ShelterMember, error) {
+	member, err := s.shelters.FindMembership(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrNotShelterMember
+	}
+	return member, nil
+}
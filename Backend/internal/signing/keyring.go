@@ -0,0 +1,373 @@
+// Package signing manages the keys used to sign and verify PetMatch JWTs.
+//
+// Asymmetric keys (RS256, EdDSA) are generated on demand, stored in the
+// database encrypted with a key-encryption secret and rotated once they
+// reach the configured age. A retired key
+// keeps verifying tokens for a grace period long enough for every token it
+// signed to expire, and is published in the JWKS document meanwhile.
+package signing
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"petmatch/internal/models"
+	"petmatch/internal/repositories"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	rsaKeyBits = 2048
+	// reloadInterval bounds how often an unknown kid triggers a reload, so
+	// another instance's freshly rotated key is picked up without letting
+	// garbage tokens hammer the database.
+	reloadInterval = 30 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type key struct {
+	id        string
+	algorithm string
+	method    jwt.SigningMethod
+	private   crypto.PrivateKey
+	public    crypto.PublicKey
+	createdAt time.Time
+	retiredAt *time.Time
+}
+
+type KeyRing struct {
+	mu          sync.RWMutex
+	repo        *repositories.SigningKeyRepository
+	sealer      cipher.AEAD
+	algorithm   string
+	rotation    time.Duration
+	verifyGrace time.Duration
+	keys        map[string]*key
+	current     *key
+	lastReload  time.Time
+}
+
+// NewKeyRing loads the stored keys for an asymmetric algorithm, creating the
+// first one if needed. The private keys are stored encrypted with secret.
+// verifyGrace must cover the longest lifetime of a token signed by the ring.
+func NewKeyRing(repo *repositories.SigningKeyRepository, algorithm string, secret []byte, rotation, verifyGrace time.Duration) (*KeyRing, error) {
+	if algorithm != AlgorithmRS256 && algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", algorithm)
+	}
+	sealer, err := newSealer(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &KeyRing{
+		repo:        repo,
+		sealer:      sealer,
+		algorithm:   algorithm,
+		rotation:    rotation,
+		verifyGrace: verifyGrace,
+		keys:        make(map[string]*key),
+	}
+
+	ring.mu.Lock()
+	defer ring.mu.Unlock()
+	if err := ring.reload(time.Now()); err != nil {
+		return nil, err
+	}
+	if err := ring.rotateIfDue(time.Now()); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// NewHMACKeyRing wraps a shared secret. It never rotates and publishes no
+// JWKS keys, since the secret can't be shared with verifiers.
+func NewHMACKeyRing(secret []byte) *KeyRing {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("petmatch-kid"))
+	id := "hs256-" + hex.EncodeToString(mac.Sum(nil))[:16]
+
+	current := &key{
+		id:        id,
+		algorithm: AlgorithmHS256,
+		method:    jwt.SigningMethodHS256,
+		private:   secret,
+		public:    secret,
+	}
+	return &KeyRing{
+		algorithm: AlgorithmHS256,
+		keys:      map[string]*key{id: current},
+		current:   current,
+	}
+}
+
+// Sign signs claims with the current key, rotating it first when it has
+// reached the configured age.
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	current, err := r.signingKey(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(current.method, claims)
+	token.Header["kid"] = current.id
+	return token.SignedString(current.private)
+}
+
+// Keyfunc resolves the verification key from the token's kid header and
+// checks that the token uses that key's algorithm.
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownKey
+	}
+
+	k, err := r.lookup(kid, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return k.public, nil
+}
+
+func (r *KeyRing) signingKey(now time.Time) (*key, error) {
+	r.mu.RLock()
+	current := r.current
+	due := r.rotationDue(now)
+	r.mu.RUnlock()
+	if !due {
+		return current, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.rotateIfDue(now); err != nil {
+		return nil, err
+	}
+	return r.current, nil
+}
+
+func (r *KeyRing) lookup(kid string, now time.Time) (*key, error) {
+	r.mu.RLock()
+	k, ok := r.keys[kid]
+	verifiable := ok && r.verifiable(k, now)
+	canReload := r.repo != nil && now.Sub(r.lastReload) > reloadInterval
+	r.mu.RUnlock()
+
+	if ok {
+		if !verifiable {
+			return nil, ErrUnknownKey
+		}
+		return k, nil
+	}
+	if !canReload {
+		return nil, ErrUnknownKey
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.reload(now); err != nil {
+		return nil, err
+	}
+	if k, ok = r.keys[kid]; !ok || !r.verifiable(k, now) {
+		return nil, ErrUnknownKey
+	}
+	return k, nil
+}
+
+// verifiable must be called with the lock held.
+func (r *KeyRing) verifiable(k *key, now time.Time) bool {
+	return k.retiredAt == nil || now.Before(k.retiredAt.Add(r.verifyGrace))
+}
+
+// usable returns the keys that still verify tokens, in no particular order.
+func (r *KeyRing) usable(now time.Time) []*key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]*key, 0, len(r.keys))
+	for _, k := range r.keys {
+		if r.verifiable(k, now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+func (r *KeyRing) rotationDue(now time.Time) bool {
+	if r.repo == nil {
+		return false
+	}
+	return r.current == nil ||
+		r.current.algorithm != r.algorithm ||
+		(r.rotation > 0 && now.Sub(r.current.createdAt) >= r.rotation)
+}
+
+// rotateIfDue must be called with the write lock held.
+func (r *KeyRing) rotateIfDue(now time.Time) error {
+	if !r.rotationDue(now) {
+		return nil
+	}
+
+	next, stored, err := generateKey(r.sealer, r.algorithm, now)
+	if err != nil {
+		return err
+	}
+	if err := r.repo.Create(stored); err != nil {
+		return err
+	}
+
+	if previous := r.current; previous != nil {
+		if err := r.repo.Retire(previous.id, now); err != nil {
+			return err
+		}
+		previous.retiredAt = &now
+	}
+	r.keys[next.id] = next
+	r.current = next
+
+	return r.repo.DeleteRetiredBefore(now.Add(-r.verifyGrace))
+}
+
+// reload must be called with the write lock held.
+func (r *KeyRing) reload(now time.Time) error {
+	stored, err := r.repo.ListUsable(now.Add(-r.verifyGrace))
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*key, len(stored))
+	var current *key
+	for i := range stored {
+		k, err := decodeKey(r.sealer, stored[i])
+		if err != nil {
+			return err
+		}
+		// Keys stored before they were encrypted are sealed on load.
+		if !strings.HasPrefix(stored[i].PrivateKey, sealedPrefix) {
+			sealed, err := seal(r.sealer, stored[i].ID, []byte(stored[i].PrivateKey))
+			if err != nil {
+				return err
+			}
+			if err := r.repo.SealPrivateKey(stored[i].ID, stored[i].PrivateKey, sealed); err != nil {
+				return err
+			}
+		}
+		keys[k.id] = k
+		if k.retiredAt == nil && (current == nil || k.createdAt.After(current.createdAt)) {
+			current = k
+		}
+	}
+
+	r.keys = keys
+	r.current = current
+	r.lastReload = now
+	return nil
+}
+
+func generateKey(sealer cipher.AEAD, algorithm string, now time.Time) (*key, *models.SigningKey, error) {
+	var (
+		private crypto.Signer
+		err     error
+	)
+	switch algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("unsupported jwt algorithm %q", algorithm)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(publicDER)
+	id := strings.ToLower(algorithm) + "-" + hex.EncodeToString(sum[:])[:16]
+
+	sealed, err := seal(sealer, id, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		return nil, nil, err
+	}
+	stored := &models.SigningKey{
+		ID:         id,
+		Algorithm:  algorithm,
+		PrivateKey: sealed,
+		CreatedAt:  now,
+	}
+
+	k, err := decodeKey(sealer, *stored)
+	if err != nil {
+		return nil, nil, err
+	}
+	return k, stored, nil
+}
+
+func decodeKey(sealer cipher.AEAD, stored models.SigningKey) (*key, error) {
+	pemBytes, err := unseal(sealer, stored.ID, stored.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, fmt.Errorf("signing key %s: invalid PEM", stored.ID)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", stored.ID, err)
+	}
+
+	k := &key{
+		id:        stored.ID,
+		algorithm: stored.Algorithm,
+		createdAt: stored.CreatedAt,
+		retiredAt: stored.RetiredAt,
+	}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		k.method = jwt.SigningMethodRS256
+		k.private = private
+		k.public = &private.PublicKey
+	case ed25519.PrivateKey:
+		k.method = jwt.SigningMethodEdDSA
+		k.private = private
+		k.public = private.Public()
+	default:
+		return nil, fmt.Errorf("signing key %s: unsupported key type %T", stored.ID, parsed)
+	}
+
+	if k.method.Alg() != stored.Algorithm {
+		return nil, fmt.Errorf("signing key %s: algorithm mismatch", stored.ID)
+	}
+	return k, nil
+}
@@ -0,0 +1,225 @@
+package signing
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"petmatch/internal/models"
+	"petmatch/internal/repositories"
+	"petmatch/internal/testdb"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testRotation = time.Hour
+	testGrace    = 2 * time.Hour
+)
+
+var testSecret = []byte("key-encryption secret")
+
+func newTestRepo(t *testing.T) *repositories.SigningKeyRepository {
+	t.Helper()
+	return repositories.NewSigningKeyRepository(testdb.Open(t, &models.SigningKey{}))
+}
+
+func signTestToken(t *testing.T, ring *KeyRing) string {
+	t.Helper()
+
+	token, err := ring.Sign(jwt.MapClaims{"sub": "1", "exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmEdDSA, AlgorithmRS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			repo := newTestRepo(t)
+			ring, err := NewKeyRing(repo, algorithm, testSecret, testRotation, testGrace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			first := ring.current
+			token := signTestToken(t, ring)
+
+			rotatedAt := first.createdAt.Add(testRotation)
+			second, err := ring.signingKey(rotatedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if second.id == first.id {
+				t.Fatal("the key was not rotated once it reached the rotation age")
+			}
+			if again, _ := ring.signingKey(rotatedAt.Add(time.Minute)); again.id != second.id {
+				t.Fatal("the key was rotated again before reaching the rotation age")
+			}
+
+			tests := []struct {
+				name string
+				kid  string
+				at   time.Time
+				want error
+			}{
+				{"current key", second.id, rotatedAt, nil},
+				{"retired key within grace", first.id, rotatedAt.Add(testGrace - time.Minute), nil},
+				{"retired key after grace", first.id, rotatedAt.Add(testGrace + time.Minute), ErrUnknownKey},
+				{"unknown key", "missing", rotatedAt, ErrUnknownKey},
+			}
+			for _, tt := range tests {
+				if _, err := ring.lookup(tt.kid, tt.at); !errors.Is(err, tt.want) {
+					t.Errorf("%s: lookup error = %v, want %v", tt.name, err, tt.want)
+				}
+			}
+
+			// A token signed before the rotation still verifies while its
+			// key is retired but within the grace period.
+			if _, err := jwt.Parse(token, ring.Keyfunc); err != nil {
+				t.Errorf("token signed by the retired key: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyRingReloadsStoredKeys(t *testing.T) {
+	repo := newTestRepo(t)
+	ring, err := NewKeyRing(repo, AlgorithmEdDSA, testSecret, testRotation, testGrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := ring.current
+	token := signTestToken(t, ring)
+	rotatedAt := first.createdAt.Add(testRotation)
+	second, err := ring.signingKey(rotatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance sharing the database signs with the newest key and
+	// verifies with the retired one.
+	other, err := NewKeyRing(repo, AlgorithmEdDSA, testSecret, testRotation, testGrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.current.id != second.id {
+		t.Errorf("other instance signs with %s, want %s", other.current.id, second.id)
+	}
+	if _, err := jwt.Parse(token, other.Keyfunc); err != nil {
+		t.Errorf("other instance rejected a token of the retired key: %v", err)
+	}
+
+	// Rotating once the grace period is over deletes the retired key.
+	if _, err := ring.signingKey(rotatedAt.Add(testGrace + testRotation)); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := repo.ListUsable(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range stored {
+		if key.ID == first.id {
+			t.Errorf("key %s was kept after its grace period", first.id)
+		}
+	}
+}
+
+func TestKeyRingSealsStoredKeys(t *testing.T) {
+	repo := newTestRepo(t)
+	ring, err := NewKeyRing(repo, AlgorithmEdDSA, testSecret, testRotation, testGrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A key stored in plaintext before keys were encrypted.
+	sealer, err := newSealer(testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, legacy, err := generateKey(sealer, AlgorithmEdDSA, ring.current.createdAt.Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemBytes, err := unseal(sealer, legacy.ID, legacy.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy.PrivateKey = string(pemBytes)
+	retired := ring.current.createdAt
+	legacy.RetiredAt = &retired
+	if err := repo.Create(legacy); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewKeyRing(repo, AlgorithmEdDSA, testSecret, testRotation, testGrace); err != nil {
+		t.Fatalf("loading a plaintext key: %v", err)
+	}
+	stored, err := repo.ListUsable(time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("%d stored keys, want 2", len(stored))
+	}
+	for _, key := range stored {
+		if !strings.HasPrefix(key.PrivateKey, sealedPrefix) || strings.Contains(key.PrivateKey, "PRIVATE KEY") {
+			t.Errorf("key %s is stored in plaintext", key.ID)
+		}
+	}
+
+	if _, err := NewKeyRing(repo, AlgorithmEdDSA, []byte("another secret"), testRotation, testGrace); err == nil {
+		t.Error("a ring with another secret loaded the stored keys")
+	}
+
+	// A sealed key copied to another row doesn't decrypt.
+	moved := stored[0]
+	moved.ID = "eddsa-moved"
+	if _, err := decodeKey(sealer, moved); err == nil {
+		t.Error("a sealed key decrypted under another id")
+	}
+}
+
+func TestKeyRingRejectsAlgorithmMismatch(t *testing.T) {
+	ring, err := NewKeyRing(newTestRepo(t), AlgorithmEdDSA, testSecret, testRotation, testGrace)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		kid  string
+	}{
+		{"HS256 token naming an EdDSA key", ring.current.id},
+		{"token without kid", ""},
+	}
+	for _, tt := range tests {
+		forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "1"})
+		if tt.kid != "" {
+			forged.Header["kid"] = tt.kid
+		}
+		raw, err := forged.SignedString([]byte("guessed"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := jwt.Parse(raw, ring.Keyfunc); err == nil {
+			t.Errorf("%s: verified", tt.name)
+		}
+	}
+}
+
+func TestHMACKeyRing(t *testing.T) {
+	ring := NewHMACKeyRing([]byte("secret"))
+	token := signTestToken(t, ring)
+
+	if _, err := jwt.Parse(token, ring.Keyfunc); err != nil {
+		t.Fatalf("HMAC ring rejected its own token: %v", err)
+	}
+	if _, err := jwt.Parse(token, NewHMACKeyRing([]byte("other")).Keyfunc); err == nil {
+		t.Fatal("a ring with another secret verified the token")
+	}
+	if again, _ := ring.signingKey(time.Now().Add(24 * 365 * time.Hour)); again != ring.current {
+		t.Fatal("the HMAC key rotated")
+	}
+}
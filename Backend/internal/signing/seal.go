@@ -0,0 +1,64 @@
+package signing
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// sealedPrefix marks a private key encrypted with the key-encryption
+// secret. Rows without it hold the PEM written before keys were encrypted.
+const sealedPrefix = "sealed:v1:"
+
+// newSealer derives the AES-256-GCM key that encrypts the stored private
+// keys from secret.
+func newSealer(secret []byte) (cipher.AEAD, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("signing: empty key-encryption secret")
+	}
+	derived := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte("petmatch signing keys")), derived); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(derived)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the PEM of a key. The key id is authenticated along with
+// it, so a sealed key can't be moved to another row.
+func seal(aead cipher.AEAD, id string, pemBytes []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, pemBytes, []byte(id))
+	return sealedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// unseal returns the PEM of a stored key, sealed or not.
+func unseal(aead cipher.AEAD, id, stored string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(stored, sealedPrefix)
+	if !ok {
+		return []byte(stored), nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("signing key %s: invalid sealed key", id)
+	}
+	pemBytes, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: cannot decrypt it with the key-encryption secret", id)
+	}
+	return pemBytes, nil
+}
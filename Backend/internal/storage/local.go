@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// contentTypes covers the extensions of stored files that the system's MIME
+// table may not know.
+var contentTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".png":  "image/png",
+	".mp4":  "video/mp4",
+	".webm": "video/webm",
+}
+
+// LocalStore keeps files in a directory of the server's disk.
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore stores files in dir, creating it if needed.
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &LocalStore{dir: dir}, nil
+}
+
+// Put writes the file to a temporary name first, so readers never see it
+// half written.
+func (s *LocalStore) Put(key string, data []byte, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o640); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, key))
+}
+
+// Get opens the file. Its content type comes from the key's extension.
+func (s *LocalStore) Get(key string) (*Object, error) {
+	if !validKey(key) {
+		return nil, ErrNotFound
+	}
+
+	file, err := os.Open(filepath.Join(s.dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	contentType, ok := contentTypes[filepath.Ext(key)]
+	if !ok {
+		contentType = mime.TypeByExtension(filepath.Ext(key))
+	}
+	return &Object{
+		Body:        file,
+		ContentType: contentType,
+		Size:        info.Size(),
+		ModTime:     info.ModTime(),
+	}, nil
+}
+
+// Delete removes the file. Removing a missing file is not an error.
+func (s *LocalStore) Delete(key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	err := os.Remove(filepath.Join(s.dir, key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
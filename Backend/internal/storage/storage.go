@@ -0,0 +1,76 @@
+// Package storage keeps uploaded files behind a small interface, so the API
+// can store them on the local disk or in an S3-compatible bucket.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"petmatch/internal/config"
+)
+
+var (
+	ErrNotFound   = errors.New("storage: object not found")
+	ErrInvalidKey = errors.New("storage: invalid object key")
+)
+
+// Object is a stored file being read. Callers must close Body.
+type Object struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// Store saves, reads and removes files by key. Keys are flat names made of
+// letters, digits, dots, dashes and underscores.
+type Store interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) (*Object, error)
+	Delete(key string) error
+}
+
+// Signer is implemented by stores that can hand clients a temporary URL to
+// fetch an object directly, instead of streaming it through the API.
+type Signer interface {
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// New builds the store selected by PETMATCH_STORAGE_DRIVER.
+func New(cfg config.Config) (Store, error) {
+	switch strings.ToLower(cfg.StorageDriver) {
+	case "local", "":
+		return NewLocalStore(cfg.StorageDir)
+	case "s3":
+		return NewS3Store(S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PathStyle: cfg.S3PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported storage driver %q", cfg.StorageDriver)
+	}
+}
+
+// validKey rejects keys that could escape the store's directory or bucket
+// prefix.
+func validKey(key string) bool {
+	if key == "" || len(key) > 200 || strings.HasPrefix(key, ".") {
+		return false
+	}
+	for _, r := range key {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '.', r == '-', r == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,32 @@
+import { HttpErrorResponse, HttpInterceptorFn } from '@angular/common/http';
+import { inject } from '@angular/core';
+import { catchError, switchMap, throwError } from 'rxjs';
+
+import { AuthService } from '../services/auth.service';
+
+// Requests that must not trigger a refresh: they either have no session yet
+// or are the refresh itself.
+const sessionPaths = ['/auth/login', '/auth/refresh', '/auth/logout'];
+
+/**
+ * Access tokens are short-lived: when an authenticated request is answered
+ * with 401, renews the session with the refresh token and retries it once.
+ */
+export const authInterceptor: HttpInterceptorFn = (req, next) => {
+  if (!req.headers.has('Authorization') || sessionPaths.some((path) => req.url.endsWith(path))) {
+    return next(req);
+  }
+
+  const auth = inject(AuthService);
+  return next(req).pipe(
+    catchError((error: unknown) => {
+      if (!(error instanceof HttpErrorResponse) || error.status !== 401) {
+        return throwError(() => error);
+      }
+      return auth.refreshSession().pipe(
+        catchError(() => throwError(() => error)),
+        switchMap((token) => next(req.clone({ setHeaders: { Authorization: `Bearer ${token}` } }))),
+      );
+    }),
+  );
+};
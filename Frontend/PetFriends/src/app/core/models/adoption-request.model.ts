@@ -1,7 +1,28 @@
 import { Pet } from './pet.model';
 import { User } from './user.model';
 
-export type AdoptionStatus = 'pending' | 'approved' | 'rejected';
+export type AdoptionStatus =
+  | 'submitted'
+  | 'under_review'
+  | 'interview_scheduled'
+  | 'approved'
+  | 'rejected'
+  | 'withdrawn'
+  | 'completed';
+
+/**
+ * Statuses a request can move to from each status, mirroring the API's
+ * workflow. Rejected, withdrawn and completed requests are final.
+ */
+export const adoptionTransitions: Record<AdoptionStatus, readonly AdoptionStatus[]> = {
+  submitted: ['under_review', 'approved', 'rejected', 'withdrawn'],
+  under_review: ['interview_scheduled', 'approved', 'rejected', 'withdrawn'],
+  interview_scheduled: ['under_review', 'approved', 'rejected', 'withdrawn'],
+  approved: ['completed', 'withdrawn'],
+  rejected: [],
+  withdrawn: [],
+  completed: [],
+};
 
 export interface AdoptionRequest {
   id: number;
@@ -9,6 +30,7 @@ export interface AdoptionRequest {
   adopterId: number;
   status: AdoptionStatus;
   message?: string | null;
+  answers?: Record<string, unknown> | null;
   createdAt?: string;
   updatedAt?: string;
   pet?: Pet;
@@ -2,9 +2,16 @@ import { User } from './user.model';
 
 export interface LoginResponse {
   token: string;
+  refreshToken: string;
+  expiresIn: number;
   user: User;
 }
 
+export interface StoredSession {
+  token: string;
+  refreshToken: string | null;
+}
+
 export interface RegisterPayload {
   name: string;
   email: string;
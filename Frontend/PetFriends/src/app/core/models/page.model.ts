@@ -0,0 +1,13 @@
+/** Fields the API adds to every paged list, next to the items. */
+export interface PageInfo {
+  pageSize: number;
+  total: number;
+  next: string | null;
+}
+
+/** One page of a list: its items, the size of the whole list and the cursor of the following page. */
+export interface Page<T> {
+  items: T[];
+  total: number;
+  next: string | null;
+}
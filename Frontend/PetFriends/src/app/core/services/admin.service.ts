@@ -1,6 +1,7 @@
 import { Injectable } from '@angular/core';
 import { map, Observable } from 'rxjs';
 
+import { Page } from '../models/page.model';
 import { User } from '../models/user.model';
 import { ApiService } from './api.service';
 import { AuthService } from './auth.service';
@@ -9,13 +10,12 @@ import { AuthService } from './auth.service';
 export class AdminService {
   constructor(private readonly api: ApiService, private readonly auth: AuthService) {}
 
-  listUsers(params: { role?: string; approved?: boolean } = {}): Observable<User[]> {
-    return this.api
-      .get<{ users: User[] }>('/admin/users', {
-        params,
-        headers: this.auth.authHeaders(),
-      })
-      .pipe(map((response) => response.users));
+  listUsers(params: { role?: string; approved?: boolean } = {}, cursor?: string | null): Observable<Page<User>> {
+    return this.api.getPage<User>('/admin/users', 'users', {
+      params,
+      headers: this.auth.authHeaders(),
+      cursor,
+    });
   }
 
   approveShelter(id: number): Observable<User> {
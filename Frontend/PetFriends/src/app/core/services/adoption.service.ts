@@ -2,11 +2,13 @@ import { Injectable } from '@angular/core';
 import { map, Observable } from 'rxjs';
 
 import { AdoptionRequest, AdoptionStatus } from '../models/adoption-request.model';
+import { Page } from '../models/page.model';
 import { ApiService } from './api.service';
 import { AuthService } from './auth.service';
 
 export interface CreateAdoptionPayload {
   message?: string;
+  answers?: Record<string, unknown>;
 }
 
 @Injectable({ providedIn: 'root' })
@@ -21,18 +23,18 @@ export class AdoptionService {
       .pipe(map((response) => response.request));
   }
 
-  listForAdopter(): Observable<AdoptionRequest[]> {
-    return this.api
-      .get<{ requests: AdoptionRequest[] }>('/adoption-requests', { headers: this.auth.authHeaders() })
-      .pipe(map((response) => response.requests));
+  listForAdopter(cursor?: string | null): Observable<Page<AdoptionRequest>> {
+    return this.api.getPage<AdoptionRequest>('/adoption-requests', 'requests', {
+      headers: this.auth.authHeaders(),
+      cursor,
+    });
   }
 
-  listForShelter(): Observable<AdoptionRequest[]> {
-    return this.api
-      .get<{ requests: AdoptionRequest[] }>('/adoption-requests', {
-        headers: this.auth.authHeaders(),
-      })
-      .pipe(map((response) => response.requests));
+  listForShelter(cursor?: string | null): Observable<Page<AdoptionRequest>> {
+    return this.api.getPage<AdoptionRequest>('/adoption-requests', 'requests', {
+      headers: this.auth.authHeaders(),
+      cursor,
+    });
   }
 
   updateStatus(id: number, status: AdoptionStatus): Observable<AdoptionRequest> {
@@ -40,4 +42,10 @@ export class AdoptionService {
       .patch<{ request: AdoptionRequest }>(`/adoption-requests/${id}`, { status }, { headers: this.auth.authHeaders() })
       .pipe(map((response) => response.request));
   }
+
+  withdraw(id: number): Observable<AdoptionRequest> {
+    return this.api
+      .post<{ request: AdoptionRequest }>(`/adoption-requests/${id}/withdraw`, {}, { headers: this.auth.authHeaders() })
+      .pipe(map((response) => response.request));
+  }
 }
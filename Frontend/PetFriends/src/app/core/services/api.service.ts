@@ -1,8 +1,9 @@
 import { HttpClient, HttpParams } from '@angular/common/http';
 import { Inject, Injectable } from '@angular/core';
-import { Observable } from 'rxjs';
+import { Observable, map } from 'rxjs';
 
 import { API_BASE_URL } from '../config/api.tokens';
+import { Page, PageInfo } from '../models/page.model';
 
 @Injectable({ providedIn: 'root' })
 export class ApiService {
@@ -25,6 +26,32 @@ export class ApiService {
     });
   }
 
+  /**
+   * Loads one page of a paged list, the first one or the one after `cursor`,
+   * in the endpoint's default page size, and returns the items found under
+   * `key` with the list total and the cursor of the following page.
+   */
+  getPage<T>(
+    path: string,
+    key: string,
+    options: {
+      params?: Record<string, string | number | boolean | undefined | null>;
+      headers?: Record<string, string>;
+      cursor?: string | null;
+    } = {},
+  ): Observable<Page<T>> {
+    return this.get<PageInfo & Record<string, unknown>>(path, {
+      params: { ...options.params, cursor: options.cursor },
+      headers: options.headers,
+    }).pipe(
+      map((response) => ({
+        items: (response[key] as T[] | undefined) ?? [],
+        total: response.total,
+        next: response.next,
+      })),
+    );
+  }
+
   post<T>(path: string, body: unknown, options: { headers?: Record<string, string> } = {}): Observable<T> {
     return this.http.post<T>(this.resolve(path), body, { headers: options.headers });
   }
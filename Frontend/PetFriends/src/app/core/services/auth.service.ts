@@ -1,7 +1,7 @@
 import { Injectable, computed, signal } from '@angular/core';
-import { Observable, tap } from 'rxjs';
+import { Observable, finalize, map, shareReplay, tap, throwError } from 'rxjs';
 
-import { LoginPayload, LoginResponse, RegisterPayload } from '../models/auth.model';
+import { LoginPayload, LoginResponse, RegisterPayload, StoredSession } from '../models/auth.model';
 import { User, UserRole } from '../models/user.model';
 import { ApiService } from './api.service';
 
@@ -10,6 +10,8 @@ export class AuthService {
   private readonly storageKey = 'petmatch.session';
   private readonly token = signal<string | null>(null);
   private readonly userSignal = signal<User | null>(null);
+  private refreshToken: string | null = null;
+  private refreshing: Observable<string> | null = null;
 
   readonly isAuthenticated = computed(() => !!this.token());
   readonly currentUser = computed(() => this.userSignal());
@@ -26,13 +28,41 @@ export class AuthService {
   login(payload: LoginPayload): Observable<LoginResponse> {
     return this.api.post<LoginResponse>('/auth/login', payload).pipe(
       tap((response) => {
-        this.setSession(response.token, response.user);
+        this.setSession(response.token, response.refreshToken, response.user);
       }),
     );
   }
 
   logout(): void {
+    const refreshToken = this.refreshToken;
     this.clearSession();
+    if (refreshToken) {
+      this.api.post<void>('/auth/logout', { refreshToken }).subscribe({ error: () => undefined });
+    }
+  }
+
+  /**
+   * Trades the refresh token for a new session and emits the new access token.
+   * Concurrent callers share one request, since the refresh token is rotated
+   * and reusing it revokes the session.
+   */
+  refreshSession(): Observable<string> {
+    const refreshToken = this.refreshToken;
+    if (!refreshToken) {
+      return throwError(() => new Error('No hay una sesion que renovar.'));
+    }
+    if (!this.refreshing) {
+      this.refreshing = this.api.post<LoginResponse>('/auth/refresh', { refreshToken }).pipe(
+        tap({
+          next: (response) => this.setSession(response.token, response.refreshToken, response.user),
+          error: () => this.clearSession(),
+        }),
+        map((response) => response.token),
+        finalize(() => (this.refreshing = null)),
+        shareReplay(1),
+      );
+    }
+    return this.refreshing;
   }
 
   authHeaders(): Record<string, string> | undefined {
@@ -56,11 +86,13 @@ export class AuthService {
       );
   }
 
-  private setSession(token: string, user: User): void {
+  private setSession(token: string, refreshToken: string | null, user: User): void {
     this.token.set(token);
+    this.refreshToken = refreshToken;
     this.userSignal.set(user);
     if (typeof window !== 'undefined') {
-      window.localStorage.setItem(this.storageKey, token);
+      const session: StoredSession = { token, refreshToken };
+      window.localStorage.setItem(this.storageKey, JSON.stringify(session));
     }
   }
 
@@ -68,23 +100,43 @@ export class AuthService {
     if (typeof window === 'undefined') {
       return;
     }
-    const storedToken = window.localStorage.getItem(this.storageKey);
-    if (!storedToken) {
+    const session = this.readStoredSession();
+    if (!session) {
       return;
     }
-    this.token.set(storedToken);
-    this.api
-      .get<{ user: User }>('/auth/me', {
-        headers: this.authHeaders(),
-      })
-      .subscribe({
-        next: (response) => this.userSignal.set(response.user),
-        error: () => this.clearSession(),
-      });
+    this.token.set(session.token);
+    this.refreshToken = session.refreshToken;
+    // Deferred so that the auth interceptor, which needs this service to renew
+    // an expired token, can be created once the constructor has returned.
+    queueMicrotask(() =>
+      this.api
+        .get<{ user: User }>('/auth/me', {
+          headers: this.authHeaders(),
+        })
+        .subscribe({
+          next: (response) => this.userSignal.set(response.user),
+          error: () => this.clearSession(),
+        }),
+    );
+  }
+
+  private readStoredSession(): StoredSession | null {
+    const stored = window.localStorage.getItem(this.storageKey);
+    if (!stored) {
+      return null;
+    }
+    try {
+      const session = JSON.parse(stored) as StoredSession;
+      return session?.token ? session : null;
+    } catch {
+      // Sessions saved before refresh tokens hold only the access token.
+      return { token: stored, refreshToken: null };
+    }
   }
 
   private clearSession(): void {
     this.token.set(null);
+    this.refreshToken = null;
     this.userSignal.set(null);
     if (typeof window !== 'undefined') {
       window.localStorage.removeItem(this.storageKey);
@@ -1,6 +1,7 @@
 import { Injectable } from '@angular/core';
 import { map, Observable } from 'rxjs';
 
+import { Page } from '../models/page.model';
 import { Pet, PetStatus } from '../models/pet.model';
 import { ApiService } from './api.service';
 import { AuthService } from './auth.service';
@@ -29,7 +30,7 @@ export interface PetPayload {
 export class PetService {
   constructor(private readonly api: ApiService, private readonly auth: AuthService) {}
 
-  list(filters: PetFilters = {}): Observable<Pet[]> {
+  list(filters: PetFilters = {}, cursor?: string | null): Observable<Page<Pet>> {
     const params: Record<string, string | number> = {};
     if (filters.species) {
       params['species'] = filters.species;
@@ -49,7 +50,7 @@ export class PetService {
     if (filters.status) {
       params['status'] = filters.status;
     }
-    return this.api.get<{ pets: Pet[] }>('/pets', { params }).pipe(map((response) => response.pets));
+    return this.api.getPage<Pet>('/pets', 'pets', { params, cursor });
   }
 
   getById(id: number): Observable<Pet> {
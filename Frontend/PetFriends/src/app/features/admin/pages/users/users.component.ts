@@ -1,7 +1,9 @@
 import { CommonModule } from '@angular/common';
 import { ChangeDetectionStrategy, Component, OnInit, inject, signal } from '@angular/core';
 import { FormBuilder, ReactiveFormsModule } from '@angular/forms';
+import { Observable } from 'rxjs';
 
+import { Page } from '../../../../core/models/page.model';
 import { User } from '../../../../core/models/user.model';
 import { AdminService } from '../../../../core/services/admin.service';
 
@@ -18,7 +20,10 @@ export class UsersComponent implements OnInit {
   private readonly fb = inject(FormBuilder);
 
   readonly users = signal<User[]>([]);
+  readonly total = signal<number>(0);
+  readonly next = signal<string | null>(null);
   readonly loading = signal<boolean>(true);
+  readonly loadingMore = signal<boolean>(false);
   readonly error = signal<string | null>(null);
   readonly success = signal<string | null>(null);
 
@@ -27,6 +32,10 @@ export class UsersComponent implements OnInit {
     approved: [''],
   });
 
+  // Filters of the list on screen, so "load more" keeps them even if the
+  // form was edited without applying it.
+  private applied: { role?: string; approved?: boolean } = {};
+
   ngOnInit(): void {
     this.fetchUsers();
   }
@@ -36,16 +45,40 @@ export class UsersComponent implements OnInit {
     this.loading.set(true);
     this.error.set(null);
     const values = this.filters.getRawValue();
-    this.adminService
-      .listUsers({
-        role: values.role || undefined,
-        approved: values.approved === '' ? undefined : values.approved === 'true',
-      })
-      .subscribe({
-        next: (users) => this.users.set(users),
-        error: () => this.error.set('No pudimos cargar los usuarios.'),
-        complete: () => this.loading.set(false),
-      });
+    this.applied = {
+      role: values.role || undefined,
+      approved: values.approved === '' ? undefined : values.approved === 'true',
+    };
+    this.page().subscribe({
+      next: (page) => {
+        this.users.set(page.items);
+        this.total.set(page.total);
+        this.next.set(page.next);
+      },
+      error: () => this.error.set('No pudimos cargar los usuarios.'),
+      complete: () => this.loading.set(false),
+    });
+  }
+
+  loadMore(): void {
+    const cursor = this.next();
+    if (!cursor || this.loadingMore()) {
+      return;
+    }
+
+    this.loadingMore.set(true);
+    this.page(cursor).subscribe({
+      next: (page) => {
+        this.users.update((users) => users.concat(page.items));
+        this.total.set(page.total);
+        this.next.set(page.next);
+        this.loadingMore.set(false);
+      },
+      error: () => {
+        this.error.set('No pudimos cargar más usuarios.');
+        this.loadingMore.set(false);
+      },
+    });
   }
 
   approve(user: User): void {
@@ -60,4 +93,8 @@ export class UsersComponent implements OnInit {
       error: () => this.error.set('No pudimos aprobar el refugio.'),
     });
   }
+
+  private page(cursor?: string): Observable<Page<User>> {
+    return this.adminService.listUsers(this.applied, cursor);
+  }
 }
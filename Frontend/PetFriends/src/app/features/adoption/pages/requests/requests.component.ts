@@ -1,8 +1,10 @@
 import { CommonModule } from '@angular/common';
 import { ChangeDetectionStrategy, Component, computed, inject, OnInit, signal } from '@angular/core';
 import { RouterLink } from '@angular/router';
+import { Observable } from 'rxjs';
 
-import { AdoptionRequest, AdoptionStatus } from '../../../../core/models/adoption-request.model';
+import { AdoptionRequest, AdoptionStatus, adoptionTransitions } from '../../../../core/models/adoption-request.model';
+import { Page } from '../../../../core/models/page.model';
 import { AuthService } from '../../../../core/services/auth.service';
 import { AdoptionService } from '../../../../core/services/adoption.service';
 
@@ -19,7 +21,10 @@ export class RequestsComponent implements OnInit {
   private readonly auth = inject(AuthService);
 
   readonly requests = signal<AdoptionRequest[]>([]);
+  readonly total = signal<number>(0);
+  readonly next = signal<string | null>(null);
   readonly loading = signal<boolean>(true);
+  readonly loadingMore = signal<boolean>(false);
   readonly error = signal<string | null>(null);
   readonly success = signal<string | null>(null);
 
@@ -33,15 +38,43 @@ export class RequestsComponent implements OnInit {
   fetchRequests(): void {
     this.loading.set(true);
     this.error.set(null);
-    const source = this.isShelter() ? this.adoptionService.listForShelter() : this.adoptionService.listForAdopter();
 
-    source.subscribe({
-      next: (requests) => this.requests.set(requests),
+    this.page().subscribe({
+      next: (page) => {
+        this.requests.set(page.items);
+        this.total.set(page.total);
+        this.next.set(page.next);
+      },
       error: () => this.error.set('No pudimos cargar las solicitudes.'),
       complete: () => this.loading.set(false),
     });
   }
 
+  loadMore(): void {
+    const cursor = this.next();
+    if (!cursor || this.loadingMore()) {
+      return;
+    }
+
+    this.loadingMore.set(true);
+    this.page(cursor).subscribe({
+      next: (page) => {
+        this.requests.update((requests) => requests.concat(page.items));
+        this.total.set(page.total);
+        this.next.set(page.next);
+        this.loadingMore.set(false);
+      },
+      error: () => {
+        this.error.set('No pudimos cargar más solicitudes.');
+        this.loadingMore.set(false);
+      },
+    });
+  }
+
+  canMoveTo(request: AdoptionRequest, status: AdoptionStatus): boolean {
+    return adoptionTransitions[request.status]?.includes(status) ?? false;
+  }
+
   updateStatus(request: AdoptionRequest, status: AdoptionStatus): void {
     if (!this.isShelter()) {
       return;
@@ -58,4 +91,8 @@ export class RequestsComponent implements OnInit {
       error: () => this.error.set('No pudimos actualizar la solicitud.'),
     });
   }
+
+  private page(cursor?: string): Observable<Page<AdoptionRequest>> {
+    return this.isShelter() ? this.adoptionService.listForShelter(cursor) : this.adoptionService.listForAdopter(cursor);
+  }
 }
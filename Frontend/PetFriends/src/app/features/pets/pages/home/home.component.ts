@@ -23,9 +23,14 @@ export class HomeComponent implements OnInit {
   private readonly fb = inject(FormBuilder);
 
   readonly pets = signal<Pet[]>([]);
+  readonly total = signal<number>(0);
+  readonly next = signal<string | null>(null);
   readonly loading = signal<boolean>(true);
+  readonly loadingMore = signal<boolean>(false);
   readonly error = signal<string | null>(null);
 
+  private filters: PetFilters = {};
+
   readonly filterForm = this.fb.nonNullable.group({
     species: [''],
     location: [''],
@@ -38,15 +43,41 @@ export class HomeComponent implements OnInit {
   }
 
   loadPets(filters: PetFilters = {}): void {
+    this.filters = filters;
     this.loading.set(true);
     this.error.set(null);
     this.petService.list(filters).subscribe({
-      next: (pets) => this.pets.set(pets),
+      next: (page) => {
+        this.pets.set(page.items);
+        this.total.set(page.total);
+        this.next.set(page.next);
+      },
       error: () => this.error.set('No pudimos cargar las mascotas. Inténtalo más tarde.'),
       complete: () => this.loading.set(false),
     });
   }
 
+  loadMore(): void {
+    const cursor = this.next();
+    if (!cursor || this.loadingMore()) {
+      return;
+    }
+
+    this.loadingMore.set(true);
+    this.petService.list(this.filters, cursor).subscribe({
+      next: (page) => {
+        this.pets.update((pets) => pets.concat(page.items));
+        this.total.set(page.total);
+        this.next.set(page.next);
+        this.loadingMore.set(false);
+      },
+      error: () => {
+        this.error.set('No pudimos cargar más mascotas. Inténtalo más tarde.');
+        this.loadingMore.set(false);
+      },
+    });
+  }
+
   onSearch(): void {
     const values = this.filterForm.getRawValue();
     this.loadPets({